@@ -2,15 +2,30 @@ package mapstructure
 
 import (
 	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"net"
+	"net/netip"
+	"net/url"
+	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// ErrHookNotApplicable can be returned by a decode hook to signal that it
+// doesn't handle the given types. It is never returned to the caller:
+// DecodeHookExec treats it as if the hook had returned its input unchanged.
+var ErrHookNotApplicable = errors.New("decode hook not applicable")
+
 // typedDecodeHook takes a raw DecodeHookFunc (an interface{}) and turns
 // it into the proper DecodeHookFunc type, such as DecodeHookFuncType.
 func typedDecodeHook(h DecodeHookFunc) DecodeHookFunc {
@@ -18,10 +33,13 @@ func typedDecodeHook(h DecodeHookFunc) DecodeHookFunc {
 	var f1 DecodeHookFuncType
 	var f2 DecodeHookFuncKind
 	var f3 DecodeHookFuncValue
+	var f4 DecodeHookFuncValueNamed
+	var f5 decodeHookFuncDepth
+	var f6 DecodeHookFuncReflect
 
 	// Fill in the variables into this interface and the rest is done
 	// automatically using the reflect package.
-	potential := []interface{}{f1, f2, f3}
+	potential := []interface{}{f1, f2, f3, f4, f5, f6}
 
 	v := reflect.ValueOf(h)
 	vt := v.Type()
@@ -41,17 +59,59 @@ func typedDecodeHook(h DecodeHookFunc) DecodeHookFunc {
 func DecodeHookExec(
 	raw DecodeHookFunc,
 	from reflect.Value, to reflect.Value) (interface{}, error) {
+	return decodeHookExec(raw, from, to, "", 0)
+}
+
+// decodeHookFuncDepth is the hook signature used internally by hooks that
+// need the decode depth of the value, such as composed hooks passing it on.
+type decodeHookFuncDepth func(from reflect.Value, to reflect.Value, name string, depth int) (interface{}, error)
+
+// decodeHookExec is the same as DecodeHookExec, but also passes the name
+// and depth of the value being decoded to hooks that accept them.
+func decodeHookExec(
+	raw DecodeHookFunc,
+	from reflect.Value, to reflect.Value, name string, depth int) (interface{}, error) {
+	out, err := decodeHookExecValue(raw, from, to, name, depth)
+	if !out.IsValid() {
+		return nil, err
+	}
+	return out.Interface(), err
+}
+
+// decodeHookExecValue is the same as decodeHookExec, but returns the
+// result as a reflect.Value, so that the result of a DecodeHookFuncReflect
+// can be passed on without being converted.
+func decodeHookExecValue(
+	raw DecodeHookFunc,
+	from reflect.Value, to reflect.Value, name string, depth int) (reflect.Value, error) {
 
+	var out interface{}
+	var err error
 	switch f := typedDecodeHook(raw).(type) {
+	case DecodeHookFuncReflect:
+		v, err := f(from.Type(), to.Type(), from)
+		if errors.Is(err, ErrHookNotApplicable) {
+			return from, nil
+		}
+		return v, err
 	case DecodeHookFuncType:
-		return f(from.Type(), to.Type(), from.Interface())
+		out, err = f(from.Type(), to.Type(), from.Interface())
 	case DecodeHookFuncKind:
-		return f(from.Kind(), to.Kind(), from.Interface())
+		out, err = f(from.Kind(), to.Kind(), from.Interface())
 	case DecodeHookFuncValue:
-		return f(from, to)
+		out, err = f(from, to)
+	case DecodeHookFuncValueNamed:
+		out, err = f(from, to, name)
+	case decodeHookFuncDepth:
+		out, err = f(from, to, name, depth)
 	default:
-		return nil, errors.New("invalid decode hook signature")
+		return reflect.Value{}, errors.New("invalid decode hook signature")
+	}
+
+	if errors.Is(err, ErrHookNotApplicable) {
+		return from, nil
 	}
+	return reflect.ValueOf(out), err
 }
 
 // ComposeDecodeHookFunc creates a single DecodeHookFunc that
@@ -60,47 +120,89 @@ func DecodeHookExec(
 // The composed funcs are called in order, with the result of the
 // previous transformation.
 func ComposeDecodeHookFunc(fs ...DecodeHookFunc) DecodeHookFunc {
-	return func(f reflect.Value, t reflect.Value) (interface{}, error) {
+	return decodeHookFuncDepth(func(f reflect.Value, t reflect.Value, name string, depth int) (interface{}, error) {
 		var err error
-		data := f.Interface()
 
 		newFrom := f
 		for _, f1 := range fs {
-			data, err = DecodeHookExec(f1, newFrom, t)
+			newFrom, err = decodeHookExecValue(f1, newFrom, t, name, depth)
 			if err != nil {
 				return nil, err
 			}
-			newFrom = reflect.ValueOf(data)
 		}
 
-		return data, nil
-	}
+		if !newFrom.IsValid() {
+			return nil, nil
+		}
+		return newFrom.Interface(), nil
+	})
 }
 
-// OrComposeDecodeHookFunc executes all input hook functions until one of them returns no error. In that case its value is returned.
-// If all hooks return an error, OrComposeDecodeHookFunc returns an error concatenating all error messages.
+// DepthScopedHookFunc returns a DecodeHookFunc that only runs inner for
+// values whose decode depth is between minDepth and maxDepth, inclusive.
+// The depth is the number of structs, maps, slices and arrays the value is
+// nested in: the input passed to Decode is at depth 0 and the values of
+// its fields or elements are at depth 1. Other values are left alone.
+//
+// DecodeHookExec has no depth to pass, so it runs hooks as if at depth 0.
+func DepthScopedHookFunc(minDepth, maxDepth int, inner DecodeHookFunc) DecodeHookFunc {
+	return decodeHookFuncDepth(func(f reflect.Value, t reflect.Value, name string, depth int) (interface{}, error) {
+		if depth < minDepth || depth > maxDepth {
+			return f.Interface(), nil
+		}
+
+		return decodeHookExec(inner, f, t, name, depth)
+	})
+}
+
+// OrComposeDecodeHookFunc executes the input hook functions in order until
+// one of them converts the value, and returns that hook's result.
+//
+// A hook declines a value by returning it unchanged or by returning
+// ErrHookNotApplicable, and the next hook is tried. Any other error stops
+// the chain and is returned right away. If every hook declines, the input
+// is returned as is.
+//
+// Because an unchanged result counts as declining, a hook whose conversion
+// happens to produce a value equal to its input doesn't stop the chain.
 func OrComposeDecodeHookFunc(ff ...DecodeHookFunc) DecodeHookFunc {
-	return func(a, b reflect.Value) (interface{}, error) {
-		var allErrs string
-		var out interface{}
-		var err error
+	return decodeHookFuncDepth(func(a, b reflect.Value, name string, depth int) (interface{}, error) {
+		data := a.Interface()
 
 		for _, f := range ff {
-			out, err = DecodeHookExec(f, a, b)
+			out, err := decodeHookExec(f, a, b, name, depth)
 			if err != nil {
-				allErrs += err.Error() + "\n"
+				return nil, err
+			}
+
+			if hookDeclined(data, out) {
 				continue
 			}
 
 			return out, nil
 		}
 
-		return nil, errors.New(allErrs)
+		return data, nil
+	})
+}
+
+// hookDeclined reports whether a hook returned its input unchanged.
+func hookDeclined(in, out interface{}) bool {
+	if reflect.TypeOf(in) != reflect.TypeOf(out) {
+		return false
 	}
+	return reflect.DeepEqual(in, out)
 }
 
 // StringToSliceHookFunc returns a DecodeHookFunc that converts
-// string to []string by splitting on the given sep.
+// string to []string by splitting on the given sep. An empty string
+// becomes an empty, non-nil slice.
+//
+// Only the splitting is done by the hook; each part is then decoded into
+// the element type of the target slice like any other value. Combined
+// with WeaklyTypedInput this means "1,2,3" can be decoded into []int.
+// When composing with other hooks that operate on strings, put this hook
+// first so that later hooks see the individual parts.
 func StringToSliceHookFunc(sep string) DecodeHookFunc {
 	return func(
 		f reflect.Kind,
@@ -119,6 +221,75 @@ func StringToSliceHookFunc(sep string) DecodeHookFunc {
 	}
 }
 
+// UnquoteStringHookFunc returns a DecodeHookFunc that unquotes strings
+// holding a Go or JSON quoted string, such as `"hello"`, with
+// strconv.Unquote when the target is a string. Only values that start and
+// end with the same double quote or backquote are unquoted; other strings
+// are left untouched. A quoted value that isn't valid, such as one with an
+// unknown escape sequence, is an error.
+func UnquoteStringHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t.Kind() != reflect.String {
+			return data, nil
+		}
+
+		str := reflect.ValueOf(data).String()
+		if len(str) < 2 {
+			return data, nil
+		}
+		if q := str[0]; (q != '"' && q != '`') || str[len(str)-1] != q {
+			return data, nil
+		}
+
+		unquoted, err := strconv.Unquote(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s: %w", str, err)
+		}
+
+		return unquoted, nil
+	}
+}
+
+// StringToStringMapHookFunc returns a DecodeHookFunc that converts
+// strings such as "env=prod,team=core" to map[string]string by splitting
+// on pairSep and then splitting each pair on kvSep. Whitespace around keys
+// and values is trimmed and later duplicate keys win. An empty string
+// becomes an empty, non-nil map.
+func StringToStringMapHookFunc(pairSep, kvSep string) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String || t.Elem().Kind() != reflect.String {
+			return data, nil
+		}
+
+		raw := data.(string)
+		result := make(map[string]string)
+		if raw == "" {
+			return result, nil
+		}
+
+		for i, pair := range strings.Split(raw, pairSep) {
+			kv := strings.SplitN(pair, kvSep, 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf(
+					"invalid map entry %q at position %d: missing %q", pair, i, kvSep)
+			}
+
+			result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+
+		return result, nil
+	}
+}
+
 // StringToTimeDurationHookFunc returns a DecodeHookFunc that converts
 // strings to time.Duration.
 func StringToTimeDurationHookFunc() DecodeHookFunc {
@@ -138,6 +309,194 @@ func StringToTimeDurationHookFunc() DecodeHookFunc {
 	}
 }
 
+// DurationToStringHookFunc returns a DecodeHookFunc that is the inverse of
+// StringToTimeDurationHookFunc: when a time.Duration is decoded into a
+// string or an empty interface, such as when encoding a struct into a
+// map[string]interface{}, it is replaced by Duration.String, so that 90
+// minutes becomes "1h30m0s" rather than a number of nanoseconds.
+func DurationToStringHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f != reflect.TypeOf(time.Duration(5)) {
+			return data, nil
+		}
+		if t.Kind() != reflect.String && !(t.Kind() == reflect.Interface && t.NumMethod() == 0) {
+			return data, nil
+		}
+
+		return data.(time.Duration).String(), nil
+	}
+}
+
+// ISO8601DurationHookFunc returns a DecodeHookFunc that converts ISO 8601
+// duration strings such as "PT1H30M" or "P1DT2H" to time.Duration. Weeks
+// and days are taken to be exactly 168 and 24 hours. Years and months have
+// no fixed length, so they are an error. A leading "-" negates the
+// duration and the smallest unit may have a fraction, as in "PT0.5S".
+func ISO8601DurationHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(time.Duration(5)) {
+			return data, nil
+		}
+
+		raw := reflect.ValueOf(data).String()
+		d, err := parseISO8601Duration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ISO 8601 duration %q: %w", raw, err)
+		}
+
+		return d, nil
+	}
+}
+
+// iso8601DateUnits and iso8601TimeUnits are the units allowed before and
+// after the "T" of an ISO 8601 duration, in the order they must appear.
+// Years and months are listed with a zero length so that they are
+// recognized but rejected.
+var (
+	iso8601DateUnits = []iso8601Unit{{'Y', 0}, {'M', 0}, {'W', 168 * time.Hour}, {'D', 24 * time.Hour}}
+	iso8601TimeUnits = []iso8601Unit{{'H', time.Hour}, {'M', time.Minute}, {'S', time.Second}}
+)
+
+type iso8601Unit struct {
+	designator byte
+	length     time.Duration
+}
+
+func parseISO8601Duration(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, errors.New(`missing "P" designator`)
+	}
+
+	datePart, timePart, hasTime := strings.Cut(s[1:], "T")
+	if datePart == "" && timePart == "" {
+		return 0, errors.New("no components")
+	}
+	if hasTime && timePart == "" {
+		return 0, errors.New(`no components after "T"`)
+	}
+
+	var total time.Duration
+	fraction := false
+	for _, part := range []struct {
+		s     string
+		units []iso8601Unit
+	}{{datePart, iso8601DateUnits}, {timePart, iso8601TimeUnits}} {
+		rest, units := part.s, part.units
+		for rest != "" {
+			if fraction {
+				return 0, errors.New("only the smallest unit may have a fraction")
+			}
+
+			idx := strings.IndexFunc(rest, func(r rune) bool {
+				return (r < '0' || r > '9') && r != '.' && r != ','
+			})
+			if idx <= 0 {
+				return 0, fmt.Errorf("expected a number followed by a unit in %q", rest)
+			}
+			number, designator := strings.Replace(rest[:idx], ",", ".", 1), rest[idx]
+			rest = rest[idx+1:]
+
+			i := 0
+			for i < len(units) && units[i].designator != designator {
+				i++
+			}
+			if i == len(units) {
+				return 0, fmt.Errorf("unexpected unit %q", designator)
+			}
+			unit := units[i]
+			units = units[i+1:]
+			if unit.length == 0 {
+				return 0, fmt.Errorf("unit %q has no fixed length", designator)
+			}
+
+			whole, frac, _ := strings.Cut(number, ".")
+			fraction = frac != ""
+
+			n, err := strconv.ParseInt(whole, 10, 64)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				return 0, fmt.Errorf("invalid number %q", number)
+			}
+			if err != nil || n > math.MaxInt64/int64(unit.length) {
+				return 0, errors.New("duration out of range")
+			}
+			total += time.Duration(n) * unit.length
+			if fraction {
+				f, err := strconv.ParseFloat("0."+frac, 64)
+				if err != nil {
+					return 0, err
+				}
+				total += time.Duration(math.Round(f * float64(unit.length)))
+			}
+			if total < 0 {
+				return 0, errors.New("duration out of range")
+			}
+		}
+	}
+
+	if neg {
+		total = -total
+	}
+	return total, nil
+}
+
+// NumberToDurationHookFunc returns a DecodeHookFunc that converts bare
+// numbers to time.Duration by multiplying them by defaultUnit, so that
+// with time.Second, 30 becomes 30 seconds rather than 30 nanoseconds.
+// Values that are already a time.Duration are left alone.
+//
+// Strings are not handled; compose this hook with
+// StringToTimeDurationHookFunc to accept both "30s" and 30.
+func NumberToDurationHookFunc(defaultUnit time.Duration) DecodeHookFunc {
+	durationType := reflect.TypeOf(time.Duration(0))
+
+	return func(
+		f reflect.Value,
+		t reflect.Value) (interface{}, error) {
+		if t.Type() != durationType || f.Type() == durationType {
+			return f.Interface(), nil
+		}
+
+		switch getKind(f) {
+		case reflect.Int:
+			v := f.Int()
+			d := v * int64(defaultUnit)
+			if defaultUnit != 0 && d/int64(defaultUnit) != v {
+				return nil, fmt.Errorf("%d%s overflows time.Duration", v, defaultUnit)
+			}
+			return time.Duration(d), nil
+		case reflect.Uint:
+			v := f.Uint()
+			if v > math.MaxInt64 {
+				return nil, fmt.Errorf("%d%s overflows time.Duration", v, defaultUnit)
+			}
+			d := int64(v) * int64(defaultUnit)
+			if defaultUnit != 0 && d/int64(defaultUnit) != int64(v) {
+				return nil, fmt.Errorf("%d%s overflows time.Duration", v, defaultUnit)
+			}
+			return time.Duration(d), nil
+		case reflect.Float32:
+			d := f.Float() * float64(defaultUnit)
+			if math.IsNaN(d) || d >= math.MaxInt64 || d < math.MinInt64 {
+				return nil, fmt.Errorf("%v%s overflows time.Duration", f.Float(), defaultUnit)
+			}
+			return time.Duration(d), nil
+		default:
+			return f.Interface(), nil
+		}
+	}
+}
+
 // StringToIPHookFunc returns a DecodeHookFunc that converts
 // strings to net.IP
 func StringToIPHookFunc() DecodeHookFunc {
@@ -162,6 +521,33 @@ func StringToIPHookFunc() DecodeHookFunc {
 	}
 }
 
+// BytesToIPHookFunc returns a DecodeHookFunc that converts 4 and 16 byte
+// slices to net.IP. The bytes are copied. Slices of any other length are
+// an error.
+func BytesToIPHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.Slice || f.Elem().Kind() != reflect.Uint8 || f == t {
+			return data, nil
+		}
+		if t != reflect.TypeOf(net.IP{}) {
+			return data, nil
+		}
+
+		b := reflect.ValueOf(data).Bytes()
+		if len(b) != net.IPv4len && len(b) != net.IPv6len {
+			return net.IP{}, fmt.Errorf("invalid ip length %d, expected %d or %d bytes",
+				len(b), net.IPv4len, net.IPv6len)
+		}
+
+		ip := make(net.IP, len(b))
+		copy(ip, b)
+		return ip, nil
+	}
+}
+
 // StringToIPNetHookFunc returns a DecodeHookFunc that converts
 // strings to net.IPNet
 func StringToIPNetHookFunc() DecodeHookFunc {
@@ -182,9 +568,10 @@ func StringToIPNetHookFunc() DecodeHookFunc {
 	}
 }
 
-// StringToTimeHookFunc returns a DecodeHookFunc that converts
-// strings to time.Time.
-func StringToTimeHookFunc(layout string) DecodeHookFunc {
+// StringToMACHookFunc returns a DecodeHookFunc that converts strings to
+// net.HardwareAddr using net.ParseMAC, which accepts the colon, hyphen and
+// dotted notations.
+func StringToMACHookFunc() DecodeHookFunc {
 	return func(
 		f reflect.Type,
 		t reflect.Type,
@@ -192,73 +579,71 @@ func StringToTimeHookFunc(layout string) DecodeHookFunc {
 		if f.Kind() != reflect.String {
 			return data, nil
 		}
-		if t != reflect.TypeOf(time.Time{}) {
+		if t != reflect.TypeOf(net.HardwareAddr{}) {
 			return data, nil
 		}
 
-		// Convert it by parsing
-		return time.Parse(layout, data.(string))
+		str := reflect.ValueOf(data).String()
+		mac, err := net.ParseMAC(str)
+		if err != nil {
+			return net.HardwareAddr{}, fmt.Errorf("failed parsing mac address '%s': %w", str, err)
+		}
+
+		return mac, nil
 	}
 }
 
-// WeaklyTypedHook is a DecodeHookFunc which adds support for weak typing to
-// the decoder.
-//
-// Note that this is significantly different from the WeaklyTypedInput option
-// of the DecoderConfig.
-func WeaklyTypedHook(
-	f reflect.Kind,
-	t reflect.Kind,
-	data interface{}) (interface{}, error) {
-	dataVal := reflect.ValueOf(data)
-	switch t {
-	case reflect.String:
-		switch f {
-		case reflect.Bool:
-			if dataVal.Bool() {
-				return "1", nil
-			}
-			return "0", nil
-		case reflect.Float32:
-			return strconv.FormatFloat(dataVal.Float(), 'f', -1, 64), nil
-		case reflect.Int:
-			return strconv.FormatInt(dataVal.Int(), 10), nil
-		case reflect.Slice:
-			dataType := dataVal.Type()
-			elemKind := dataType.Elem().Kind()
-			if elemKind == reflect.Uint8 {
-				return string(dataVal.Interface().([]uint8)), nil
-			}
-		case reflect.Uint:
-			return strconv.FormatUint(dataVal.Uint(), 10), nil
+// StringToNetipAddrHookFunc returns a DecodeHookFunc that converts
+// strings to netip.Addr.
+func StringToNetipAddrHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(netip.Addr{}) {
+			return data, nil
 		}
-	}
 
-	return data, nil
+		// Convert it by parsing
+		addr, err := netip.ParseAddr(data.(string))
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("failed parsing addr %q: %w", data, err)
+		}
+
+		return addr, nil
+	}
 }
 
-func RecursiveStructToMapHookFunc() DecodeHookFunc {
-	return func(f reflect.Value, t reflect.Value) (interface{}, error) {
-		if f.Kind() != reflect.Struct {
-			return f.Interface(), nil
+// StringToNetipPrefixHookFunc returns a DecodeHookFunc that converts
+// strings to netip.Prefix.
+func StringToNetipPrefixHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
 		}
-
-		var i interface{} = struct{}{}
-		if t.Type() != reflect.TypeOf(&i).Elem() {
-			return f.Interface(), nil
+		if t != reflect.TypeOf(netip.Prefix{}) {
+			return data, nil
 		}
 
-		m := make(map[string]interface{})
-		t.Set(reflect.ValueOf(m))
+		// Convert it by parsing
+		prefix, err := netip.ParsePrefix(data.(string))
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("failed parsing prefix %q: %w", data, err)
+		}
 
-		return f.Interface(), nil
+		return prefix, nil
 	}
 }
 
-// TextUnmarshallerHookFunc returns a DecodeHookFunc that applies
-// strings to the UnmarshalText function, when the target type
-// implements the encoding.TextUnmarshaler interface
-func TextUnmarshallerHookFunc() DecodeHookFuncType {
+// StringToURLHookFunc returns a DecodeHookFunc that converts
+// strings to *url.URL. Empty strings decode to a nil *url.URL.
+func StringToURLHookFunc() DecodeHookFunc {
 	return func(
 		f reflect.Type,
 		t reflect.Type,
@@ -266,18 +651,1127 @@ func TextUnmarshallerHookFunc() DecodeHookFuncType {
 		if f.Kind() != reflect.String {
 			return data, nil
 		}
-		result := reflect.New(t).Interface()
-		unmarshaller, ok := result.(encoding.TextUnmarshaler)
-		if !ok {
+		if t != reflect.TypeOf(&url.URL{}) {
 			return data, nil
 		}
-		str, ok := data.(string)
-		if !ok {
-			str = reflect.Indirect(reflect.ValueOf(&data)).Elem().String()
+
+		raw := data.(string)
+		if raw == "" {
+			return (*url.URL)(nil), nil
 		}
-		if err := unmarshaller.UnmarshalText([]byte(str)); err != nil {
-			return nil, err
+
+		// Convert it by parsing
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing url %q: %w", raw, err)
 		}
-		return result, nil
+
+		return u, nil
+	}
+}
+
+// byteSizeUnits maps the lower-cased byte size suffixes understood by
+// StringToByteSizeHookFunc to their multipliers.
+var byteSizeUnits = map[string]uint64{
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"pb":  1000 * 1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// StringToByteSizeHookFunc returns a DecodeHookFunc that converts
+// human-readable sizes such as "256MB" or "1.5GiB" to a number of bytes
+// when the target is an integer. Both SI (kB, MB, GB, ...) and IEC (KiB,
+// MiB, GiB, ...) units are supported. Strings that don't end in one of
+// these units or whose number isn't a plain decimal, such as "-5", "0x10"
+// or "0x1b", are passed through unchanged. Targets of type time.Duration
+// are ignored so that this hook can be composed with
+// StringToTimeDurationHookFunc.
+func StringToByteSizeHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t == reflect.TypeOf(time.Duration(5)) {
+			return data, nil
+		}
+
+		var max uint64
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			max = math.MaxInt64 >> (64 - t.Bits())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			max = math.MaxUint64 >> (64 - t.Bits())
+		default:
+			return data, nil
+		}
+
+		raw := strings.TrimSpace(data.(string))
+		if hasBasePrefix(raw) {
+			// Integer literals such as "0x1b" are left to the rest of the
+			// decoder, even though they end in a unit.
+			return data, nil
+		}
+
+		idx := strings.LastIndexFunc(raw, func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z')
+		}) + 1
+		multiplier, ok := byteSizeUnits[strings.ToLower(raw[idx:])]
+		if !ok {
+			// No unit, let the rest of the decoder handle it
+			return data, nil
+		}
+
+		number := strings.TrimSpace(raw[:idx])
+		if number == "" {
+			return nil, fmt.Errorf("invalid byte size %q", data)
+		}
+		if strings.IndexFunc(number, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		}) != -1 {
+			// Not a decimal number, so not a byte size either
+			return data, nil
+		}
+
+		var size uint64
+		if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+			if n > math.MaxUint64/multiplier {
+				return nil, fmt.Errorf("byte size %q overflows %s", data, t)
+			}
+			size = n * multiplier
+		} else {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid byte size %q: %w", data, err)
+			}
+
+			result := math.Round(n * float64(multiplier))
+			if result >= math.MaxUint64 {
+				return nil, fmt.Errorf("byte size %q overflows %s", data, t)
+			}
+			size = uint64(result)
+		}
+
+		if size > max {
+			return nil, fmt.Errorf("byte size %q overflows %s", data, t)
+		}
+
+		return reflect.ValueOf(size).Convert(t).Interface(), nil
+	}
+}
+
+// hasBasePrefix reports whether s, ignoring its sign, is a number with a
+// hexadecimal, octal or binary prefix, such as "0x1b".
+func hasBasePrefix(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	if len(s) <= 2 || s[0] != '0' {
+		return false
+	}
+
+	switch s[1] {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+// StringToRegexpHookFunc returns a DecodeHookFunc that converts
+// strings to *regexp.Regexp using regexp.Compile. Empty strings decode to
+// a nil *regexp.Regexp.
+func StringToRegexpHookFunc() DecodeHookFunc {
+	return stringToRegexpHookFunc(regexp.Compile)
+}
+
+// StringToRegexpPOSIXHookFunc is the same as StringToRegexpHookFunc, but
+// compiles the expressions with regexp.CompilePOSIX.
+func StringToRegexpPOSIXHookFunc() DecodeHookFunc {
+	return stringToRegexpHookFunc(regexp.CompilePOSIX)
+}
+
+func stringToRegexpHookFunc(compile func(string) (*regexp.Regexp, error)) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(&regexp.Regexp{}) {
+			return data, nil
+		}
+
+		raw := data.(string)
+		if raw == "" {
+			return (*regexp.Regexp)(nil), nil
+		}
+
+		// Convert it by compiling
+		re, err := compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed compiling regexp %q: %w", raw, err)
+		}
+
+		return re, nil
+	}
+}
+
+// StringToBase64BytesHookFunc returns a DecodeHookFunc that decodes
+// standard base64 strings into []byte or [N]byte. For array targets the
+// decoded length must match the array length exactly.
+func StringToBase64BytesHookFunc() DecodeHookFunc {
+	return stringToBytesHookFunc("base64", base64.StdEncoding.DecodeString)
+}
+
+// StringToHexBytesHookFunc returns a DecodeHookFunc that decodes hex
+// strings such as "deadbeef" into []byte or [N]byte. For array targets the
+// decoded length must match the array length exactly.
+//
+// Both this hook and StringToBase64BytesHookFunc convert strings into byte
+// slices, so only one of them should be registered for a given decoder. In a
+// ComposeDecodeHookFunc chain the first one would consume the string and the
+// second would never see it.
+func StringToHexBytesHookFunc() DecodeHookFunc {
+	return stringToBytesHookFunc("hex", hex.DecodeString)
+}
+
+func stringToBytesHookFunc(encoding string, decode func(string) ([]byte, error)) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) ||
+			t.Elem().Kind() != reflect.Uint8 {
+			return data, nil
+		}
+
+		raw := data.(string)
+		b, err := decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed decoding %s %q: %w", encoding, raw, err)
+		}
+
+		if t.Kind() == reflect.Slice {
+			return reflect.ValueOf(b).Convert(t).Interface(), nil
+		}
+
+		if len(b) != t.Len() {
+			return nil, fmt.Errorf(
+				"decoded %s %q is %d bytes, expected %d", encoding, raw, len(b), t.Len())
+		}
+		arr := reflect.New(t).Elem()
+		reflect.Copy(arr, reflect.ValueOf(b))
+		return arr.Interface(), nil
+	}
+}
+
+// EnvExpandHookFunc returns a DecodeHookFunc that expands ${VAR} and $VAR
+// references in strings against the process environment. Referencing an
+// undefined variable is an error. "$$" expands to a literal "$".
+func EnvExpandHookFunc() DecodeHookFunc {
+	return ExpandHookFunc(nil, false)
+}
+
+// ExpandHookFunc returns a DecodeHookFunc that expands ${VAR} and $VAR
+// references in strings using vars, or the process environment if vars is
+// nil. If allowUndefined is true, undefined variables expand to the empty
+// string instead of returning an error. "$$" expands to a literal "$".
+//
+// Only the contents of the string change, not its type, so hooks composed
+// after this one still see a string.
+func ExpandHookFunc(vars map[string]string, allowUndefined bool) DecodeHookFunc {
+	lookup := os.LookupEnv
+	if vars != nil {
+		lookup = func(key string) (string, bool) {
+			v, ok := vars[key]
+			return v, ok
+		}
+	}
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+
+		raw := reflect.ValueOf(data).String()
+		var undefined []string
+		expanded := os.Expand(raw, func(key string) string {
+			if key == "$" {
+				return "$"
+			}
+			v, ok := lookup(key)
+			if !ok && !allowUndefined {
+				undefined = append(undefined, key)
+			}
+			return v
+		})
+		if len(undefined) > 0 {
+			return nil, fmt.Errorf("undefined variable %q in %q", undefined[0], raw)
+		}
+
+		return reflect.ValueOf(expanded).Convert(f).Interface(), nil
+	}
+}
+
+// StringToBigIntHookFunc returns a DecodeHookFunc that converts strings
+// and numbers to *big.Int. Strings are parsed with a base prefix, so "0x1f"
+// is accepted, and empty strings decode to a nil *big.Int. Floats must be
+// whole numbers.
+func StringToBigIntHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Value,
+		t reflect.Value) (interface{}, error) {
+		if t.Type() != reflect.TypeOf(&big.Int{}) {
+			return f.Interface(), nil
+		}
+
+		switch getKind(f) {
+		case reflect.String:
+			raw := f.String()
+			if raw == "" {
+				return (*big.Int)(nil), nil
+			}
+			i, ok := new(big.Int).SetString(raw, 0)
+			if !ok {
+				return nil, fmt.Errorf("failed parsing big.Int %q", raw)
+			}
+			return i, nil
+		case reflect.Int:
+			return big.NewInt(f.Int()), nil
+		case reflect.Uint:
+			return new(big.Int).SetUint64(f.Uint()), nil
+		case reflect.Float32:
+			v := f.Float()
+			if math.IsInf(v, 0) || math.IsNaN(v) || v != math.Trunc(v) {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			i, _ := big.NewFloat(v).Int(nil)
+			return i, nil
+		default:
+			return f.Interface(), nil
+		}
+	}
+}
+
+// StringToBigRatHookFunc returns a DecodeHookFunc that converts strings
+// and numbers to *big.Rat. Strings may be fractions such as "1/3" or
+// decimals such as "0.333", and empty strings decode to a nil *big.Rat.
+// Floats are converted from their shortest decimal representation, so 0.1
+// becomes exactly 1/10.
+func StringToBigRatHookFunc() DecodeHookFunc {
+	return stringToBigRatHookFunc(false)
+}
+
+// StringToBigRatExactHookFunc is the same as StringToBigRatHookFunc, but
+// returns an error for floats whose binary value differs from their decimal
+// representation, such as 0.1. Such values should be given as strings.
+func StringToBigRatExactHookFunc() DecodeHookFunc {
+	return stringToBigRatHookFunc(true)
+}
+
+func stringToBigRatHookFunc(exact bool) DecodeHookFunc {
+	return func(
+		f reflect.Value,
+		t reflect.Value) (interface{}, error) {
+		if t.Type() != reflect.TypeOf(&big.Rat{}) {
+			return f.Interface(), nil
+		}
+
+		switch getKind(f) {
+		case reflect.String:
+			raw := f.String()
+			if raw == "" {
+				return (*big.Rat)(nil), nil
+			}
+			r, ok := new(big.Rat).SetString(raw)
+			if !ok {
+				return nil, fmt.Errorf("failed parsing big.Rat %q", raw)
+			}
+			return r, nil
+		case reflect.Int:
+			return new(big.Rat).SetInt64(f.Int()), nil
+		case reflect.Uint:
+			return new(big.Rat).SetInt(new(big.Int).SetUint64(f.Uint())), nil
+		case reflect.Float32:
+			v := f.Float()
+			raw := strconv.FormatFloat(v, 'g', -1, f.Type().Bits())
+			r, ok := new(big.Rat).SetString(raw)
+			if !ok {
+				return nil, fmt.Errorf("failed converting %v to big.Rat", v)
+			}
+			if exact && r.Cmp(new(big.Rat).SetFloat64(v)) != 0 {
+				return nil, fmt.Errorf("%v cannot be represented exactly as a big.Rat", v)
+			}
+			return r, nil
+		default:
+			return f.Interface(), nil
+		}
+	}
+}
+
+// StringToEnumHookFunc returns a DecodeHookFunc that converts strings to
+// values of type T by looking them up in mapping, for example
+// map[string]LogLevel{"info": LevelInfo}. It only applies when the target
+// type is T. Unknown strings are an error that lists the valid options. If
+// caseInsensitive is true, strings that don't match a key exactly are
+// matched using strings.EqualFold.
+func StringToEnumHookFunc[T ~int | ~string](mapping map[string]T, caseInsensitive bool) DecodeHookFunc {
+	enumType := reflect.TypeOf((*T)(nil)).Elem()
+
+	options := make([]string, 0, len(mapping))
+	for k := range mapping {
+		options = append(options, k)
+	}
+	sort.Strings(options)
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != enumType {
+			return data, nil
+		}
+
+		raw := reflect.ValueOf(data).String()
+		if v, ok := mapping[raw]; ok {
+			return v, nil
+		}
+		if caseInsensitive {
+			for _, k := range options {
+				if strings.EqualFold(k, raw) {
+					return mapping[k], nil
+				}
+			}
+		}
+
+		return nil, fmt.Errorf(
+			"invalid value %q for %s, expected one of: %s",
+			raw, enumType, strings.Join(options, ", "))
+	}
+}
+
+// EnumToStringHookFunc returns a DecodeHookFunc that is the inverse of
+// StringToEnumHookFunc: when a value of type T is decoded into a string or
+// an empty interface, it is replaced by its name from mapping. Use it as
+// the EncodeHook to encode the fields of a struct decoded into a map. Values
+// missing from mapping are an error, unless allowUnknown is true, in which
+// case they are left as they are.
+func EnumToStringHookFunc[T comparable](mapping map[T]string, allowUnknown bool) DecodeHookFunc {
+	enumType := reflect.TypeOf((*T)(nil)).Elem()
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f != enumType || t == enumType {
+			return data, nil
+		}
+		if t.Kind() != reflect.String && !(t.Kind() == reflect.Interface && t.NumMethod() == 0) {
+			return data, nil
+		}
+
+		if name, ok := mapping[data.(T)]; ok {
+			return name, nil
+		}
+		if allowUnknown {
+			return data, nil
+		}
+
+		return nil, fmt.Errorf("no name for %s value %v", enumType, data)
+	}
+}
+
+// TaggedUnionHookFunc returns a DecodeHookFunc for variants encoded as a
+// map with a single key, such as {"circle": {"radius": 5}}. When such a
+// map is decoded into an interface, the key selects the concrete type from
+// registry and the key's value is decoded into a new value of that type,
+// which replaces the map. If field isn't empty, the key is also decoded
+// into the field of that name. The inner value is decoded with the
+// default DecoderConfig. Interfaces that none of the registered types
+// implement are left alone; for the rest, keys missing from registry are
+// an error that lists the valid options.
+func TaggedUnionHookFunc(registry map[string]reflect.Type, field string) DecodeHookFunc {
+	options := make([]string, 0, len(registry))
+	for k := range registry {
+		options = append(options, k)
+	}
+	sort.Strings(options)
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.Map || t.Kind() != reflect.Interface {
+			return data, nil
+		}
+		if !anyAssignableTo(registry, t) {
+			return data, nil
+		}
+
+		dataVal := reflect.ValueOf(data)
+		if dataVal.Len() != 1 {
+			return data, nil
+		}
+
+		key := dataVal.MapKeys()[0]
+		inner := dataVal.MapIndex(key).Interface()
+		if key.Kind() == reflect.Interface {
+			key = key.Elem()
+		}
+		if key.Kind() != reflect.String {
+			return data, nil
+		}
+
+		tag := key.String()
+		typ, ok := registry[tag]
+		if !ok {
+			return nil, fmt.Errorf(
+				"unknown variant %q for %s, expected one of: %s",
+				tag, t, strings.Join(options, ", "))
+		}
+		if !typ.AssignableTo(t) {
+			return nil, fmt.Errorf("variant %q: %s is not assignable to %s", tag, typ, t)
+		}
+
+		if field != "" {
+			m := map[string]interface{}{field: tag}
+			if innerVal := reflect.ValueOf(inner); innerVal.Kind() == reflect.Map {
+				for _, k := range innerVal.MapKeys() {
+					m[fmt.Sprint(k.Interface())] = innerVal.MapIndex(k).Interface()
+				}
+			}
+			inner = m
+		}
+
+		result := reflect.New(typ)
+		if err := Decode(inner, result.Interface()); err != nil {
+			return nil, fmt.Errorf("variant %q: %w", tag, err)
+		}
+
+		return result.Elem().Interface(), nil
+	}
+}
+
+func anyAssignableTo(types map[string]reflect.Type, t reflect.Type) bool {
+	for _, typ := range types {
+		if typ.AssignableTo(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SliceToMapByFieldHookFunc returns a DecodeHookFunc that converts a slice
+// of maps into a map when the target is a map, using the value of keyField
+// in each element as its key, so that [{"id": "a", ...}] can be decoded
+// into a map[string]Thing. The rest of each element, without keyField, is
+// used as the value. Elements that aren't maps or don't have keyField are
+// an error. Two elements with the same key are an error too, unless
+// lastWins is true, in which case the later element is used.
+func SliceToMapByFieldHookFunc(keyField string, lastWins bool) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.Slice && f.Kind() != reflect.Array {
+			return data, nil
+		}
+		if t.Kind() != reflect.Map {
+			return data, nil
+		}
+
+		dataVal := reflect.ValueOf(data)
+		result := make(map[interface{}]interface{}, dataVal.Len())
+		for i := 0; i < dataVal.Len(); i++ {
+			elem := dataVal.Index(i)
+			if elem.Kind() == reflect.Interface {
+				elem = elem.Elem()
+			}
+			if elem.Kind() != reflect.Map {
+				return nil, fmt.Errorf("element %d: expected a map, got '%s'", i, elem.Kind())
+			}
+
+			var key interface{}
+			value := reflect.MakeMapWithSize(elem.Type(), elem.Len())
+			found := false
+			for _, k := range elem.MapKeys() {
+				name := k
+				if name.Kind() == reflect.Interface {
+					name = name.Elem()
+				}
+				if name.Kind() == reflect.String && name.String() == keyField {
+					key = elem.MapIndex(k).Interface()
+					found = true
+					continue
+				}
+				value.SetMapIndex(k, elem.MapIndex(k))
+			}
+
+			if !found {
+				return nil, fmt.Errorf("element %d: missing key field '%s'", i, keyField)
+			}
+			if key != nil && !reflect.TypeOf(key).Comparable() {
+				return nil, fmt.Errorf("element %d: key field '%s' has invalid type %T", i, keyField, key)
+			}
+			if _, ok := result[key]; ok && !lastWins {
+				return nil, fmt.Errorf("element %d: duplicate key '%v'", i, key)
+			}
+
+			result[key] = value.Interface()
+		}
+
+		return result, nil
+	}
+}
+
+// MapToSliceWithKeyHookFunc returns a DecodeHookFunc that is the inverse
+// of SliceToMapByFieldHookFunc: when a map is decoded into a slice, each
+// entry becomes a map[string]interface{} element holding the entry's value
+// with its key added as keyField. Struct values are converted to maps with
+// the default DecoderConfig first. The elements are sorted by key, and
+// values that aren't maps or structs are an error.
+//
+// Maps of structs or maps, such as a map[string]Thing, are also converted
+// when decoded into an empty interface, so that used as the EncodeHook the
+// hook applies when encoding a struct into a map[string]interface{}.
+func MapToSliceWithKeyHookFunc(keyField string) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.Map {
+			return data, nil
+		}
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+		case reflect.Interface:
+			elem := f.Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if t.NumMethod() != 0 || (elem.Kind() != reflect.Struct && elem.Kind() != reflect.Map) {
+				return data, nil
+			}
+		default:
+			return data, nil
+		}
+
+		dataVal := reflect.ValueOf(data)
+		keys := dataVal.MapKeys()
+		sortMapKeys(keys)
+
+		result := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			value := reflect.Indirect(dataVal.MapIndex(k))
+			if value.Kind() == reflect.Interface {
+				value = reflect.Indirect(value.Elem())
+			}
+			if value.Kind() != reflect.Map && value.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("key '%v': expected a map or struct, got '%s'", k, value.Kind())
+			}
+
+			elem := make(map[string]interface{})
+			if err := Decode(value.Interface(), &elem); err != nil {
+				return nil, fmt.Errorf("key '%v': %w", k, err)
+			}
+			elem[keyField] = k.Interface()
+
+			result = append(result, elem)
+		}
+
+		return result, nil
+	}
+}
+
+// ToJSONRawMessageHookFunc returns a DecodeHookFunc that converts any
+// value to a json.RawMessage by marshaling it with encoding/json when the
+// target is a json.RawMessage. This allows part of the input, such as the
+// body of a plugin's configuration, to be kept and decoded later. Values
+// encoding/json can't marshal, such as funcs and channels, are an error.
+func ToJSONRawMessageHookFunc() DecodeHookFunc {
+	rawMessageType := reflect.TypeOf(json.RawMessage{})
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if t != rawMessageType || f == rawMessageType {
+			return data, nil
+		}
+
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal %T to JSON: %w", data, err)
+		}
+
+		return json.RawMessage(b), nil
+	}
+}
+
+// RegisterStringParser returns a DecodeHookFunc that converts strings to T
+// using parse, such as a package's ParseX function. It only fires when the
+// target type is exactly T. Hooks for several types can be combined with
+// ComposeDecodeHookFunc or listed in DecoderConfig.TypeHooks.
+func RegisterStringParser[T any](parse func(string) (T, error)) DecodeHookFunc {
+	targetType := reflect.TypeOf((*T)(nil)).Elem()
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != targetType {
+			return data, nil
+		}
+
+		str := reflect.ValueOf(data).String()
+		v, err := parse(str)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse '%s' as %s: %w", str, targetType, err)
+		}
+
+		return v, nil
+	}
+}
+
+// StringToComplexHookFunc returns a DecodeHookFunc that converts strings
+// such as "1+2i" to complex64 or complex128 using strconv.ParseComplex.
+// Numbers are converted too, and are used as the real part.
+func StringToComplexHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if t.Kind() != reflect.Complex64 && t.Kind() != reflect.Complex128 {
+			return data, nil
+		}
+
+		var c complex128
+		v := reflect.ValueOf(data)
+		switch f.Kind() {
+		case reflect.String:
+			var err error
+			c, err = strconv.ParseComplex(v.String(), t.Bits())
+			if err != nil {
+				return nil, fmt.Errorf("invalid complex number '%s': %w", v.String(), err)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			c = complex(float64(v.Int()), 0)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			c = complex(float64(v.Uint()), 0)
+		case reflect.Float32, reflect.Float64:
+			c = complex(v.Float(), 0)
+		default:
+			return data, nil
+		}
+
+		result := reflect.New(t).Elem()
+		if result.OverflowComplex(c) {
+			return nil, fmt.Errorf("value %v overflows %s", data, t)
+		}
+		result.SetComplex(c)
+
+		return result.Interface(), nil
+	}
+}
+
+// FloatOptions configures StringToFloatHookFunc.
+type FloatOptions struct {
+	// ThousandsSeparator is removed from the string before it is parsed,
+	// so that "1,234.5" can be read with a separator of ",". Empty means
+	// no separator is accepted.
+	ThousandsSeparator string
+
+	// Percent allows a trailing "%", in which case the number is divided
+	// by 100 so that "75%" becomes 0.75.
+	Percent bool
+}
+
+// StringToFloatHookFunc returns a DecodeHookFunc that converts strings to
+// float32 or float64, accepting the thousands separator and percent
+// suffix configured in opts.
+func StringToFloatHookFunc(opts FloatOptions) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64 {
+			return data, nil
+		}
+
+		raw := strings.TrimSpace(reflect.ValueOf(data).String())
+		percent := false
+		if opts.Percent && strings.HasSuffix(raw, "%") {
+			percent = true
+			raw = strings.TrimSpace(strings.TrimSuffix(raw, "%"))
+		}
+		if opts.ThousandsSeparator != "" {
+			raw = strings.ReplaceAll(raw, opts.ThousandsSeparator, "")
+		}
+
+		n, err := strconv.ParseFloat(raw, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s': %w", data, err)
+		}
+		if percent {
+			n /= 100
+		}
+
+		return reflect.ValueOf(n).Convert(t).Interface(), nil
+	}
+}
+
+// StringToTimeHookFunc returns a DecodeHookFunc that converts
+// strings to time.Time.
+func StringToTimeHookFunc(layout string) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(time.Time{}) {
+			return data, nil
+		}
+
+		// Convert it by parsing
+		return time.Parse(layout, data.(string))
+	}
+}
+
+// StringToDateHookFunc returns a DecodeHookFunc that converts date-only
+// strings in the "2006-01-02" layout to time.Time at midnight in loc. A
+// nil loc is treated as UTC. Empty strings become the zero time.
+func StringToDateHookFunc(loc *time.Location) DecodeHookFunc {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(time.Time{}) {
+			return data, nil
+		}
+
+		str := reflect.ValueOf(data).String()
+		if str == "" {
+			return time.Time{}, nil
+		}
+
+		date, err := time.ParseInLocation("2006-01-02", str, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date '%s': %w", str, err)
+		}
+
+		return date, nil
+	}
+}
+
+// autoTimeLayouts are the layouts tried by AutoTimeHookFunc, in order.
+var autoTimeLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	time.RFC1123,
+}
+
+// AutoTimeHookFunc returns a DecodeHookFunc that converts strings to
+// time.Time without a fixed layout. It tries RFC 3339, RFC 3339 with
+// nanoseconds, "2006-01-02", "2006-01-02 15:04:05" and RFC 1123, in that
+// order, and uses the first one that parses. Strings that match none of
+// them are an error that lists the layouts tried.
+func AutoTimeHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		if t != reflect.TypeOf(time.Time{}) {
+			return data, nil
+		}
+
+		str := reflect.ValueOf(data).String()
+		for _, layout := range autoTimeLayouts {
+			if v, err := time.Parse(layout, str); err == nil {
+				return v, nil
+			}
+		}
+
+		return nil, fmt.Errorf("cannot parse '%s' as time, tried layouts: %s",
+			str, strings.Join(autoTimeLayouts, ", "))
+	}
+}
+
+// UnixEpochToTimeHookFunc returns a DecodeHookFunc that converts numbers
+// into time.Time, treating them as a count of unit since the Unix epoch.
+// unit is typically time.Second or time.Millisecond. Negative values are
+// times before 1970.
+//
+// Strings are left alone, so this hook can be combined with
+// StringToTimeHookFunc, for example by OrComposeDecodeHookFunc, to accept
+// both epoch and formatted times.
+func UnixEpochToTimeHookFunc(unit time.Duration) DecodeHookFunc {
+	return func(
+		f reflect.Value,
+		t reflect.Value) (interface{}, error) {
+		if t.Type() != reflect.TypeOf(time.Time{}) {
+			return f.Interface(), nil
+		}
+
+		switch getKind(f) {
+		case reflect.Int:
+			return unixEpochToTime(f.Int(), unit), nil
+		case reflect.Uint:
+			return unixEpochToTime(int64(f.Uint()), unit), nil
+		case reflect.Float32:
+			sec, frac := math.Modf(f.Float() * float64(unit) / float64(time.Second))
+			return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+		default:
+			return f.Interface(), nil
+		}
+	}
+}
+
+func unixEpochToTime(v int64, unit time.Duration) time.Time {
+	if unit >= time.Second {
+		return time.Unix(v*int64(unit/time.Second), 0)
+	}
+
+	perSecond := int64(time.Second / unit)
+	return time.Unix(v/perSecond, (v%perSecond)*int64(unit))
+}
+
+// WeaklyTypedHook is a DecodeHookFunc which adds support for weak typing to
+// the decoder.
+//
+// Note that this is significantly different from the WeaklyTypedInput option
+// of the DecoderConfig.
+func WeaklyTypedHook(
+	f reflect.Kind,
+	t reflect.Kind,
+	data interface{}) (interface{}, error) {
+	dataVal := reflect.ValueOf(data)
+	switch t {
+	case reflect.String:
+		switch f {
+		case reflect.Bool:
+			if dataVal.Bool() {
+				return "1", nil
+			}
+			return "0", nil
+		case reflect.Float32:
+			return strconv.FormatFloat(dataVal.Float(), 'f', -1, 64), nil
+		case reflect.Int:
+			return strconv.FormatInt(dataVal.Int(), 10), nil
+		case reflect.Slice:
+			dataType := dataVal.Type()
+			elemKind := dataType.Elem().Kind()
+			if elemKind == reflect.Uint8 {
+				return string(dataVal.Interface().([]uint8)), nil
+			}
+		case reflect.Uint:
+			return strconv.FormatUint(dataVal.Uint(), 10), nil
+		}
+	}
+
+	return data, nil
+}
+
+// StringToBoolExtendedHookFunc returns a DecodeHookFunc that converts
+// strings to bool, accepting "yes", "y" and "on" as true and "no", "n" and
+// "off" as false in addition to the values strconv.ParseBool accepts.
+// Matching is case-insensitive and any other string is an error.
+func StringToBoolExtendedHookFunc() DecodeHookFunc {
+	return func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		if f != reflect.String || t != reflect.Bool {
+			return data, nil
+		}
+
+		str := reflect.ValueOf(data).String()
+		switch strings.ToLower(strings.TrimSpace(str)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+
+		return nil, fmt.Errorf("cannot parse '%s' as bool", str)
+	}
+}
+
+// UnwrapValueHookFunc returns a DecodeHookFunc that unwraps scalars that
+// were encoded as a map with a single key, such as {"value": 42}. When the
+// input is a map[string]interface{} whose only key is key and the target is
+// a bool, number or string, the value under key is decoded instead. Any
+// other map is left alone.
+func UnwrapValueHookFunc(key string) DecodeHookFunc {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		switch t.Kind() {
+		case reflect.Bool, reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		default:
+			return data, nil
+		}
+
+		m, ok := data.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return data, nil
+		}
+
+		if v, ok := m[key]; ok {
+			return v, nil
+		}
+
+		return data, nil
+	}
+}
+
+// RecursiveStructToMapHookFunc returns a DecodeHookFunc that decodes
+// nested structs into map[string]interface{} values when the target is an
+// interface, instead of copying the struct as-is. Fields tagged with
+// ",omitempty" are left out of the resulting maps when they are empty,
+// the same as at the top level.
+func RecursiveStructToMapHookFunc() DecodeHookFunc {
+	return func(f reflect.Value, t reflect.Value) (interface{}, error) {
+		if f.Kind() != reflect.Struct {
+			return f.Interface(), nil
+		}
+
+		var i interface{} = struct{}{}
+		if t.Type() != reflect.TypeOf(&i).Elem() {
+			return f.Interface(), nil
+		}
+
+		m := make(map[string]interface{})
+		t.Set(reflect.ValueOf(m))
+
+		return f.Interface(), nil
+	}
+}
+
+// TextUnmarshallerHookFunc returns a DecodeHookFunc that applies
+// strings to the UnmarshalText function, when the target type
+// implements the encoding.TextUnmarshaler interface
+func TextUnmarshallerHookFunc() DecodeHookFuncType {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		result := reflect.New(t).Interface()
+		unmarshaller, ok := result.(encoding.TextUnmarshaler)
+		if !ok {
+			return data, nil
+		}
+		str, ok := data.(string)
+		if !ok {
+			str = reflect.Indirect(reflect.ValueOf(&data)).Elem().String()
+		}
+		if err := unmarshaller.UnmarshalText([]byte(str)); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// BinaryUnmarshallerHookFunc returns a DecodeHookFunc that applies
+// byte slices and strings to the UnmarshalBinary function, when the target
+// type implements the encoding.BinaryUnmarshaler interface
+func BinaryUnmarshallerHookFunc() DecodeHookFuncType {
+	return func(
+		f reflect.Type,
+		t reflect.Type,
+		data interface{}) (interface{}, error) {
+		var raw []byte
+		switch {
+		case f.Kind() == reflect.String:
+			raw = []byte(reflect.ValueOf(data).String())
+		case f.Kind() == reflect.Slice && f.Elem().Kind() == reflect.Uint8:
+			raw = reflect.ValueOf(data).Bytes()
+		default:
+			return data, nil
+		}
+
+		result := reflect.New(t).Interface()
+		unmarshaller, ok := result.(encoding.BinaryUnmarshaler)
+		if !ok {
+			return data, nil
+		}
+		if err := unmarshaller.UnmarshalBinary(raw); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling %s: %w", t, err)
+		}
+		return result, nil
+	}
+}
+
+// TextMarshallerHookFunc returns a DecodeHookFunc that converts values
+// implementing the encoding.TextMarshaler interface to strings using their
+// MarshalText function. It only applies when the target is a string or an
+// empty interface. It is meant to be used as the EncodeHook, so that it
+// only runs on the fields of structs decoded into a map and doesn't turn
+// values in a map decoded into a struct into strings.
+func TextMarshallerHookFunc() DecodeHookFuncValue {
+	return func(f reflect.Value, t reflect.Value) (interface{}, error) {
+		switch t.Kind() {
+		case reflect.String:
+		case reflect.Interface:
+			if t.NumMethod() != 0 {
+				return f.Interface(), nil
+			}
+		default:
+			return f.Interface(), nil
+		}
+
+		if (f.Kind() == reflect.Ptr || f.Kind() == reflect.Interface) && f.IsNil() {
+			return f.Interface(), nil
+		}
+
+		marshaller, ok := f.Interface().(encoding.TextMarshaler)
+		if !ok {
+			return f.Interface(), nil
+		}
+
+		text, err := marshaller.MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("failed marshalling %s: %w", f.Type(), err)
+		}
+
+		return string(text), nil
 	}
 }
@@ -1,11 +1,21 @@
 package mapstructure
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"math/big"
 	"net"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -113,6 +123,40 @@ func TestOrComposeDecodeHookFunc(t *testing.T) {
 }
 
 func TestOrComposeDecodeHookFunc_correctValueIsLast(t *testing.T) {
+	f1 := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("f1: %w", ErrHookNotApplicable)
+	}
+
+	f2 := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return nil, ErrHookNotApplicable
+	}
+
+	f3 := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return data.(string) + "bar", nil
+	}
+
+	f := OrComposeDecodeHookFunc(f1, f2, f3)
+
+	result, err := DecodeHookExec(
+		f, reflect.ValueOf(""), reflect.ValueOf([]byte("")))
+	if err != nil {
+		t.Fatalf("bad: %s", err)
+	}
+	if result.(string) != "bar" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestOrComposeDecodeHookFunc_err(t *testing.T) {
 	f1 := func(
 		f reflect.Kind,
 		t reflect.Kind,
@@ -127,111 +171,2253 @@ func TestOrComposeDecodeHookFunc_correctValueIsLast(t *testing.T) {
 		return nil, errors.New("f2 error")
 	}
 
-	f3 := func(
+	f := OrComposeDecodeHookFunc(f1, f2)
+
+	_, err := DecodeHookExec(
+		f, reflect.ValueOf(""), reflect.ValueOf([]byte("")))
+	if err == nil {
+		t.Fatalf("bad: should return an error")
+	}
+	if err.Error() != "f1 error" {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestOrComposeDecodeHookFunc_declined(t *testing.T) {
+	unchanged := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return data, nil
+	}
+
+	notApplicable := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return nil, ErrHookNotApplicable
+	}
+
+	convert := func(
 		f reflect.Kind,
 		t reflect.Kind,
 		data interface{}) (interface{}, error) {
 		return data.(string) + "bar", nil
 	}
 
-	f := OrComposeDecodeHookFunc(f1, f2, f3)
+	fail := func(
+		f reflect.Kind,
+		t reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return nil, errors.New("fail error")
+	}
+
+	cases := []struct {
+		hooks  []DecodeHookFunc
+		result interface{}
+		err    string
+	}{
+		{[]DecodeHookFunc{unchanged, convert}, "foobar", ""},
+		{[]DecodeHookFunc{notApplicable, convert}, "foobar", ""},
+		{[]DecodeHookFunc{convert, fail}, "foobar", ""},
+		{[]DecodeHookFunc{unchanged, notApplicable}, "foo", ""},
+		{[]DecodeHookFunc{unchanged, fail}, nil, "fail error"},
+		{[]DecodeHookFunc{fail, convert}, nil, "fail error"},
+		{[]DecodeHookFunc{notApplicable, fail, convert}, nil, "fail error"},
+	}
+
+	for i, tc := range cases {
+		f := OrComposeDecodeHookFunc(tc.hooks...)
+		actual, err := DecodeHookExec(
+			f, reflect.ValueOf("foo"), reflect.ValueOf([]byte("")))
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("case %d: expected err %q, got %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected err: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf("case %d: expected %#v, got %#v", i, tc.result, actual)
+		}
+	}
+}
+
+func TestDecodeHookExec_notApplicable(t *testing.T) {
+	f := func(reflect.Type, reflect.Type, interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("skipping: %w", ErrHookNotApplicable)
+	}
+
+	actual, err := DecodeHookExec(f, reflect.ValueOf("foo"), reflect.ValueOf(""))
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if actual != "foo" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestOrComposeDecodeHookFunc_epochOrLayout(t *testing.T) {
+	type Event struct {
+		Created time.Time
+		Updated time.Time
+		Name    string
+	}
+
+	input := map[string]interface{}{
+		"created": 1700000000,
+		"updated": "2023-11-14T22:13:20Z",
+		"name":    "launch",
+	}
+
+	var result Event
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: OrComposeDecodeHookFunc(
+			UnixEpochToTimeHookFunc(time.Second),
+			StringToTimeHookFunc(time.RFC3339),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := time.Unix(1700000000, 0)
+	if !result.Created.Equal(expected) || !result.Updated.Equal(expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result.Name != "launch" {
+		t.Fatalf("bad name: %q", result.Name)
+	}
+}
+
+func TestDecodeHookFuncValueNamed(t *testing.T) {
+	type Config struct {
+		Created time.Time
+		Timeout time.Duration
+		Nested  struct {
+			Name string
+		}
+	}
+
+	input := map[string]interface{}{
+		"created": "2020-01-02",
+		"timeout": "5s",
+		"nested": map[string]interface{}{
+			"name": "foo",
+		},
+	}
+
+	var names []string
+	named := func(f reflect.Value, t reflect.Value, name string) (interface{}, error) {
+		names = append(names, name)
+		switch name {
+		case "Created":
+			return time.Parse("2006-01-02", f.Interface().(string))
+		case "Timeout":
+			return time.ParseDuration(f.Interface().(string))
+		}
+		return f.Interface(), nil
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			func(f reflect.Kind, t reflect.Kind, data interface{}) (interface{}, error) {
+				return data, nil
+			},
+			named,
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if !result.Created.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad created: %s", result.Created)
+	}
+	if result.Timeout != 5*time.Second {
+		t.Fatalf("bad timeout: %s", result.Timeout)
+	}
+	if result.Nested.Name != "foo" {
+		t.Fatalf("bad nested: %#v", result.Nested)
+	}
+
+	sort.Strings(names)
+	expected := []string{"", "Created", "Nested", "Nested.Name", "Timeout"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, names)
+	}
+}
+
+func TestDecodeHookFuncReflect(t *testing.T) {
+	upper := DecodeHookFuncReflect(func(f reflect.Type, t reflect.Type, data reflect.Value) (reflect.Value, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		return reflect.ValueOf(strings.ToUpper(data.String())), nil
+	})
+	exclaim := func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		return data.(string) + "!", nil
+	}
+
+	actual, err := DecodeHookExec(upper, reflect.ValueOf("foo"), reflect.ValueOf(""))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "FOO" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	var result []string
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(upper, exclaim),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode([]interface{}{"foo", "bar"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, []string{"FOO!", "BAR!"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	notApplicable := DecodeHookFuncReflect(func(f reflect.Type, t reflect.Type, data reflect.Value) (reflect.Value, error) {
+		return reflect.Value{}, ErrHookNotApplicable
+	})
+	actual, err = DecodeHookExec(notApplicable, reflect.ValueOf("foo"), reflect.ValueOf(""))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "foo" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDepthScopedHookFunc(t *testing.T) {
+	type Config struct {
+		Name   string
+		Nested struct {
+			Name string
+		}
+		Tags []string
+	}
+
+	input := map[string]interface{}{
+		"name": "foo",
+		"nested": map[string]interface{}{
+			"name": "bar",
+		},
+		"tags": []string{"baz"},
+	}
+
+	upper := func(f reflect.Kind, t reflect.Kind, data interface{}) (interface{}, error) {
+		if f != reflect.String {
+			return data, nil
+		}
+		return strings.ToUpper(data.(string)), nil
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			DepthScopedHookFunc(1, 1, upper),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.Name != "FOO" {
+		t.Fatalf("bad name: %q", result.Name)
+	}
+	if result.Nested.Name != "bar" {
+		t.Fatalf("bad nested: %#v", result.Nested)
+	}
+	if !reflect.DeepEqual(result.Tags, []string{"baz"}) {
+		t.Fatalf("bad tags: %#v", result.Tags)
+	}
+
+	// The value passed to Decode is at depth 0.
+	var top string
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: DepthScopedHookFunc(0, 0, upper),
+		Result:     &top,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode("foo"); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if top != "FOO" {
+		t.Fatalf("bad: %q", top)
+	}
+}
+
+func TestComposeDecodeHookFunc_safe_nofuncs(t *testing.T) {
+	f := ComposeDecodeHookFunc()
+	type myStruct2 struct {
+		MyInt int
+	}
+
+	type myStruct1 struct {
+		Blah map[string]myStruct2
+	}
+
+	src := &myStruct1{Blah: map[string]myStruct2{
+		"test": {
+			MyInt: 1,
+		},
+	}}
+
+	dst := &myStruct1{}
+	dConf := &DecoderConfig{
+		Result:      dst,
+		ErrorUnused: true,
+		DecodeHook:  f,
+	}
+	d, err := NewDecoder(dConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Decode(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStringToSliceHookFunc(t *testing.T) {
+	f := StringToSliceHookFunc(",")
+
+	strValue := reflect.ValueOf("42")
+	sliceValue := reflect.ValueOf([]byte("42"))
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{sliceValue, sliceValue, []byte("42"), false},
+		{strValue, strValue, "42", false},
+		{
+			reflect.ValueOf("foo,bar,baz"),
+			sliceValue,
+			[]string{"foo", "bar", "baz"},
+			false,
+		},
+		{
+			reflect.ValueOf(""),
+			sliceValue,
+			[]string{},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToSliceHookFunc_decode(t *testing.T) {
+	type Target struct {
+		Names []string
+		Ports []int
+		Empty []string
+	}
+
+	input := map[string]interface{}{
+		"names": "a,b,c",
+		"ports": "1,2,3",
+		"empty": "",
+	}
+
+	var result Target
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:       StringToSliceHookFunc(","),
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := Target{
+		Names: []string{"a", "b", "c"},
+		Ports: []int{1, 2, 3},
+		Empty: []string{},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
+func TestUnquoteStringHookFunc(t *testing.T) {
+	f := UnquoteStringHookFunc()
+
+	strValue := reflect.ValueOf("")
+	intValue := reflect.ValueOf(0)
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf(`"hello"`), strValue, "hello", false},
+		{reflect.ValueOf(`"tab\there \"quoted\""`), strValue, "tab\there \"quoted\"", false},
+		{reflect.ValueOf("`raw\\n`"), strValue, `raw\n`, false},
+		{reflect.ValueOf(`hello`), strValue, "hello", false},
+		{reflect.ValueOf(`"hello`), strValue, `"hello`, false},
+		{reflect.ValueOf(`'h'`), strValue, `'h'`, false},
+		{reflect.ValueOf(`"`), strValue, `"`, false},
+		{reflect.ValueOf(`""`), strValue, "", false},
+		{reflect.ValueOf(`"bad\q"`), strValue, nil, true},
+		{reflect.ValueOf(`"a"b"`), strValue, nil, true},
+		{reflect.ValueOf(`"42"`), intValue, `"42"`, false},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v, got %v", i, tc.err, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToStringMapHookFunc(t *testing.T) {
+	f := StringToStringMapHookFunc(",", "=")
+
+	type Labels map[string]string
+
+	strValue := reflect.ValueOf("42")
+	mapValue := reflect.ValueOf(map[string]string{})
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{strValue, strValue, "42", false},
+		{
+			reflect.ValueOf("env=prod,team=core"),
+			mapValue,
+			map[string]string{"env": "prod", "team": "core"},
+			false,
+		},
+		{
+			reflect.ValueOf(" env = prod , team= core "),
+			reflect.ValueOf(Labels{}),
+			map[string]string{"env": "prod", "team": "core"},
+			false,
+		},
+		{
+			reflect.ValueOf("env=prod,env=dev"),
+			mapValue,
+			map[string]string{"env": "dev"},
+			false,
+		},
+		{
+			reflect.ValueOf("query=a=b"),
+			mapValue,
+			map[string]string{"query": "a=b"},
+			false,
+		},
+		{
+			reflect.ValueOf(""),
+			mapValue,
+			map[string]string{},
+			false,
+		},
+		{
+			reflect.ValueOf("env=prod,team"),
+			mapValue,
+			nil,
+			true,
+		},
+		{
+			reflect.ValueOf("a=b"),
+			reflect.ValueOf(map[string]int{}),
+			"a=b",
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	_, err := DecodeHookExec(f, reflect.ValueOf("env=prod,team"), mapValue)
+	if err == nil || err.Error() != `invalid map entry "team" at position 1: missing "="` {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestStringToTimeDurationHookFunc(t *testing.T) {
+	f := StringToTimeDurationHookFunc()
+
+	timeValue := reflect.ValueOf(time.Duration(5))
+	strValue := reflect.ValueOf("")
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("5s"), timeValue, 5 * time.Second, false},
+		{reflect.ValueOf("5"), timeValue, time.Duration(0), true},
+		{reflect.ValueOf("5"), strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestDurationToStringHookFunc(t *testing.T) {
+	type Config struct {
+		Timeout time.Duration `mapstructure:"timeout"`
+	}
+
+	input := map[string]interface{}{"timeout": "90m"}
+
+	var config Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+		Result:     &config,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if config.Timeout != 90*time.Minute {
+		t.Fatalf("bad timeout: %s", config.Timeout)
+	}
+
+	var output map[string]interface{}
+	decoder, err = NewDecoder(&DecoderConfig{
+		EncodeHook: DurationToStringHookFunc(),
+		Result:     &output,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(config); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	expected := map[string]interface{}{"timeout": "1h30m0s"}
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("bad: %#v", output)
+	}
+
+	// Decoding the encoded map gives back the same struct.
+	var roundTrip Config
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+		Result:     &roundTrip,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(output); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if roundTrip != config {
+		t.Fatalf("bad: %#v", roundTrip)
+	}
+
+	// Durations decoded into other types are left alone.
+	actual, err := DecodeHookExec(DurationToStringHookFunc(),
+		reflect.ValueOf(time.Second), reflect.ValueOf(int64(0)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != time.Second {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestISO8601DurationHookFunc(t *testing.T) {
+	f := ISO8601DurationHookFunc()
+
+	timeValue := reflect.ValueOf(time.Duration(5))
+	strValue := reflect.ValueOf("")
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("PT1H30M"), timeValue, 90 * time.Minute, false},
+		{reflect.ValueOf("P1DT2H"), timeValue, 26 * time.Hour, false},
+		{reflect.ValueOf("P2W"), timeValue, 336 * time.Hour, false},
+		{reflect.ValueOf("P1D"), timeValue, 24 * time.Hour, false},
+		{reflect.ValueOf("PT45S"), timeValue, 45 * time.Second, false},
+		{reflect.ValueOf("PT0.5S"), timeValue, 500 * time.Millisecond, false},
+		{reflect.ValueOf("PT1,5M"), timeValue, 90 * time.Second, false},
+		{reflect.ValueOf("-PT10M"), timeValue, -10 * time.Minute, false},
+		{reflect.ValueOf("P1W2DT3H4M5S"), timeValue, 219*time.Hour + 4*time.Minute + 5*time.Second, false},
+		{reflect.ValueOf("P1Y"), timeValue, nil, true},
+		{reflect.ValueOf("P1M"), timeValue, nil, true},
+		{reflect.ValueOf("PT1M2H"), timeValue, nil, true},
+		{reflect.ValueOf("PT0.5M1S"), timeValue, nil, true},
+		{reflect.ValueOf("P"), timeValue, nil, true},
+		{reflect.ValueOf("PT"), timeValue, nil, true},
+		{reflect.ValueOf("1h30m"), timeValue, nil, true},
+		{reflect.ValueOf("PTH"), timeValue, nil, true},
+		{reflect.ValueOf("PT1X"), timeValue, nil, true},
+		{reflect.ValueOf("P99999999999999D"), timeValue, nil, true},
+		{reflect.ValueOf("PT1H"), strValue, "PT1H", false},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v, got %v", i, tc.err, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToByteSizeHookFunc(t *testing.T) {
+	f := StringToByteSizeHookFunc()
+
+	intValue := reflect.ValueOf(int(0))
+	int8Value := reflect.ValueOf(int8(0))
+	uint64Value := reflect.ValueOf(uint64(0))
+	strValue := reflect.ValueOf("")
+	durationValue := reflect.ValueOf(time.Duration(0))
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("42B"), intValue, 42, false},
+		{reflect.ValueOf("1kB"), intValue, 1000, false},
+		{reflect.ValueOf("256MB"), intValue, 256000000, false},
+		{reflect.ValueOf("2GB"), intValue, 2000000000, false},
+		{reflect.ValueOf("1TB"), intValue, 1000000000000, false},
+		{reflect.ValueOf("1PB"), intValue, 1000000000000000, false},
+		{reflect.ValueOf("1KiB"), intValue, 1024, false},
+		{reflect.ValueOf("1MiB"), intValue, 1048576, false},
+		{reflect.ValueOf("1.5GiB"), intValue, 1610612736, false},
+		{reflect.ValueOf("1TiB"), intValue, 1099511627776, false},
+		{reflect.ValueOf("1PiB"), intValue, 1125899906842624, false},
+		{reflect.ValueOf("0.5 kb"), intValue, 500, false},
+		{reflect.ValueOf("20000000PB"), uint64Value, nil, true},
+		{reflect.ValueOf("20000.5PB"), uint64Value, nil, true},
+		{reflect.ValueOf("1PiB"), uint64Value, uint64(1125899906842624), false},
+		{reflect.ValueOf("1kB"), int8Value, nil, true},
+		{reflect.ValueOf("12XB"), intValue, "12XB", false},
+		{reflect.ValueOf("MB"), intValue, nil, true},
+		{reflect.ValueOf("1.2.3MB"), intValue, nil, true},
+		{reflect.ValueOf("-5MB"), intValue, "-5MB", false},
+		{reflect.ValueOf("0x10kB"), intValue, "0x10kB", false},
+		{reflect.ValueOf("0x1b"), intValue, "0x1b", false},
+		{reflect.ValueOf("0X1B"), intValue, "0X1B", false},
+		{reflect.ValueOf("-0x1b"), intValue, "-0x1b", false},
+		{reflect.ValueOf("0b1"), intValue, "0b1", false},
+		{reflect.ValueOf("0o17b"), intValue, "0o17b", false},
+		{reflect.ValueOf("1e3b"), intValue, "1e3b", false},
+		{reflect.ValueOf("0b"), intValue, 0, false},
+		{reflect.ValueOf("42"), intValue, "42", false},
+		{reflect.ValueOf("-5"), intValue, "-5", false},
+		{reflect.ValueOf("+5"), intValue, "+5", false},
+		{reflect.ValueOf("0x10"), intValue, "0x10", false},
+		{reflect.ValueOf("1e3"), intValue, "1e3", false},
+		{reflect.ValueOf("5s"), durationValue, "5s", false},
+		{reflect.ValueOf("5MB"), strValue, "5MB", false},
+	}
+
+	for i, tc := range cases {
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	// Integer literals still weakly decode as they would without the hook.
+	var result struct{ A, B int }
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:       f,
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"a": "0x1b", "b": "0b101"}); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.A != 27 || result.B != 5 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestStringToComplexHookFunc(t *testing.T) {
+	c128Value := reflect.ValueOf(complex128(0))
+	c64Value := reflect.ValueOf(complex64(0))
+	strValue := reflect.ValueOf("")
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("3-4i"), c128Value, complex(3, -4), false},
+		{reflect.ValueOf("(1.5+2i)"), c64Value, complex64(complex(1.5, 2)), false},
+		{reflect.ValueOf("2.5"), c128Value, complex(2.5, 0), false},
+		{reflect.ValueOf(7), c128Value, complex(7, 0), false},
+		{reflect.ValueOf(uint8(3)), c64Value, complex64(3), false},
+		{reflect.ValueOf(-1.25), c128Value, complex(-1.25, 0), false},
+		{reflect.ValueOf("1e300+1i"), c64Value, nil, true},
+		{reflect.ValueOf(1e300), c64Value, nil, true},
+		{reflect.ValueOf("3-4j"), c128Value, nil, true},
+		{reflect.ValueOf("3-4i"), strValue, "3-4i", false},
+		{reflect.ValueOf(true), c128Value, true, false},
+	}
+
+	for i, tc := range cases {
+		f := StringToComplexHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if err != nil && tc.f.Kind() == reflect.String && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	var result struct {
+		Impedance complex128
+		Gain      complex64
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToComplexHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	input := map[string]interface{}{"impedance": "3-4i", "gain": 2}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Impedance != complex(3, -4) || result.Gain != 2 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestStringToFloatHookFunc(t *testing.T) {
+	f64Value := reflect.ValueOf(float64(0))
+	f32Value := reflect.ValueOf(float32(0))
+	strValue := reflect.ValueOf("")
+	opts := FloatOptions{ThousandsSeparator: ",", Percent: true}
+
+	cases := []struct {
+		opts   FloatOptions
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{opts, reflect.ValueOf("1,234.5"), f64Value, 1234.5, false},
+		{opts, reflect.ValueOf("75%"), f64Value, 0.75, false},
+		{opts, reflect.ValueOf(" 1,000 % "), f32Value, float32(10), false},
+		{opts, reflect.ValueOf("-2.5"), f32Value, float32(-2.5), false},
+		{opts, reflect.ValueOf("12abc"), f64Value, nil, true},
+		{opts, reflect.ValueOf("%"), f64Value, nil, true},
+		{FloatOptions{}, reflect.ValueOf("1,234.5"), f64Value, nil, true},
+		{FloatOptions{}, reflect.ValueOf("75%"), f64Value, nil, true},
+		{FloatOptions{ThousandsSeparator: "."}, reflect.ValueOf("1.234"), f64Value, float64(1234), false},
+		{opts, reflect.ValueOf("1,234.5"), strValue, "1,234.5", false},
+		{opts, reflect.ValueOf(5), f64Value, 5, false},
+	}
+
+	for i, tc := range cases {
+		f := StringToFloatHookFunc(tc.opts)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToTimeHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	timeValue := reflect.ValueOf(time.Time{})
+	cases := []struct {
+		f, t   reflect.Value
+		layout string
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("2006-01-02T15:04:05Z"), timeValue, time.RFC3339,
+			time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{strValue, timeValue, time.RFC3339, time.Time{}, true},
+		{strValue, strValue, time.RFC3339, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToTimeHookFunc(tc.layout)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToTimeHookFunc_Slice(t *testing.T) {
+	var result struct {
+		Dates []time.Time
+	}
+
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToTimeHookFunc("2006-01-02"),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	input := map[string]interface{}{
+		"dates": []string{"2023-01-01", "2023-02-01"},
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []time.Time{
+		time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(result.Dates, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result.Dates)
+	}
+
+	input = map[string]interface{}{
+		"dates": []interface{}{"2023-01-01", "2023-13-01"},
+	}
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "Dates[1]: ") {
+		t.Fatalf("error should contain the element index: %s", err)
+	}
+}
+
+func TestStringToDateHookFunc(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %s", err)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	strValue := reflect.ValueOf("5")
+	timeValue := reflect.ValueOf(time.Time{})
+	cases := []struct {
+		f, t   reflect.Value
+		loc    *time.Location
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("2021-03-14"), timeValue, ny,
+			time.Date(2021, 3, 14, 0, 0, 0, 0, ny), false},
+		{reflect.ValueOf("2021-03-14"), timeValue, tokyo,
+			time.Date(2021, 3, 14, 0, 0, 0, 0, tokyo), false},
+		{reflect.ValueOf("2021-03-14"), timeValue, nil,
+			time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC), false},
+		{reflect.ValueOf(""), timeValue, ny, time.Time{}, false},
+		{reflect.ValueOf("2021-02-30"), timeValue, ny, nil, true},
+		{reflect.ValueOf("2021-03-14T10:00:00Z"), timeValue, ny, nil, true},
+		{strValue, strValue, ny, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToDateHookFunc(tc.loc)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestAutoTimeHookFunc(t *testing.T) {
+	timeValue := reflect.ValueOf(time.Time{})
+	strValue := reflect.ValueOf("")
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("2006-01-02T15:04:05Z"), timeValue,
+			time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{reflect.ValueOf("2006-01-02T15:04:05.123456789Z"), timeValue,
+			time.Date(2006, 1, 2, 15, 4, 5, 123456789, time.UTC), false},
+		{reflect.ValueOf("2006-01-02"), timeValue,
+			time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{reflect.ValueOf("2006-01-02 15:04:05"), timeValue,
+			time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{reflect.ValueOf("Mon, 02 Jan 2006 15:04:05 UTC"), timeValue,
+			time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{reflect.ValueOf("yesterday"), timeValue, nil, true},
+		{reflect.ValueOf("2006-01-02"), strValue, "2006-01-02", false},
+	}
+
+	for i, tc := range cases {
+		f := AutoTimeHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tc.f.String()) ||
+				!strings.Contains(err.Error(), time.RFC1123) {
+				t.Fatalf("case %d: error should contain the input and layouts: %s", i, err)
+			}
+			continue
+		}
+		if tc.t.Type() == timeValue.Type() {
+			if !actual.(time.Time).Equal(tc.result.(time.Time)) {
+				t.Fatalf("case %d: expected %s, got %s", i, tc.result, actual)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestNumberToDurationHookFunc(t *testing.T) {
+	durationValue := reflect.ValueOf(time.Duration(0))
+	intValue := reflect.ValueOf(0)
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf(30), durationValue, 30 * time.Second, false},
+		{reflect.ValueOf(uint8(2)), durationValue, 2 * time.Second, false},
+		{reflect.ValueOf(1.5), durationValue, 1500 * time.Millisecond, false},
+		{reflect.ValueOf(-1), durationValue, -time.Second, false},
+		{reflect.ValueOf(5 * time.Minute), durationValue, 5 * time.Minute, false},
+		{reflect.ValueOf("5s"), durationValue, "5s", false},
+		{reflect.ValueOf(math.MaxInt64), durationValue, nil, true},
+		{reflect.ValueOf(1e300), durationValue, nil, true},
+		{reflect.ValueOf(30), intValue, 30, false},
+	}
+
+	for i, tc := range cases {
+		f := NumberToDurationHookFunc(time.Second)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestNumberToDurationHookFunc_compose(t *testing.T) {
+	type Config struct {
+		Timeout  time.Duration
+		Interval time.Duration
+		Backoff  time.Duration
+	}
+
+	input := map[string]interface{}{
+		"timeout":  30,
+		"interval": 0.5,
+		"backoff":  "2m",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			StringToTimeDurationHookFunc(),
+			NumberToDurationHookFunc(time.Second),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := Config{
+		Timeout:  30 * time.Second,
+		Interval: 500 * time.Millisecond,
+		Backoff:  2 * time.Minute,
+	}
+	if result != expected {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestStringToIPHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	ipValue := reflect.ValueOf(net.IP{})
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("1.2.3.4"), ipValue,
+			net.IPv4(0x01, 0x02, 0x03, 0x04), false},
+		{strValue, ipValue, net.IP{}, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToIPHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestBytesToIPHookFunc(t *testing.T) {
+	bytesValue := reflect.ValueOf([]byte{1, 2, 3})
+	ipValue := reflect.ValueOf(net.IP{})
+	v6 := net.ParseIP("2001:db8::1")
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf([]byte{1, 2, 3, 4}), ipValue,
+			net.IP{1, 2, 3, 4}, false},
+		{reflect.ValueOf([]byte(v6)), ipValue, v6, false},
+		{bytesValue, ipValue, net.IP{}, true},
+		{bytesValue, bytesValue, []byte{1, 2, 3}, false},
+		{reflect.ValueOf("1.2.3.4"), ipValue, "1.2.3.4", false},
+	}
+
+	for i, tc := range cases {
+		f := BytesToIPHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	f := OrComposeDecodeHookFunc(StringToIPHookFunc(), BytesToIPHookFunc())
+	for _, input := range []interface{}{"1.2.3.4", []byte{1, 2, 3, 4}} {
+		actual, err := DecodeHookExec(f, reflect.ValueOf(input), ipValue)
+		if err != nil {
+			t.Fatalf("%#v: unexpected err %s", input, err)
+		}
+		if ip, ok := actual.(net.IP); !ok || !ip.Equal(net.IPv4(1, 2, 3, 4)) {
+			t.Fatalf("%#v: bad %#v", input, actual)
+		}
+	}
+}
+
+func TestStringToMACHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	macValue := reflect.ValueOf(net.HardwareAddr{})
+	mac := net.HardwareAddr{0x01, 0x23, 0x45, 0x67, 0x89, 0xab}
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("01:23:45:67:89:ab"), macValue, mac, false},
+		{reflect.ValueOf("01-23-45-67-89-AB"), macValue, mac, false},
+		{reflect.ValueOf("0123.4567.89ab"), macValue, mac, false},
+		{reflect.ValueOf("00:00:5e:00:53:01:ff:ff"), macValue,
+			net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01, 0xff, 0xff}, false},
+		{reflect.ValueOf("01:23:45:67:89"), macValue, net.HardwareAddr{}, true},
+		{strValue, macValue, net.HardwareAddr{}, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToMACHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.f.String()) {
+			t.Fatalf("case %d: error should contain the input: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToIPNetHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	ipNetValue := reflect.ValueOf(net.IPNet{})
+	var nilNet *net.IPNet = nil
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("1.2.3.4/24"), ipNetValue,
+			&net.IPNet{
+				IP:   net.IP{0x01, 0x02, 0x03, 0x00},
+				Mask: net.IPv4Mask(0xff, 0xff, 0xff, 0x00),
+			}, false},
+		{strValue, ipNetValue, nilNet, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToIPNetHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToNetipAddrHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	addrValue := reflect.ValueOf(netip.Addr{})
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("10.0.0.1"), addrValue,
+			netip.AddrFrom4([4]byte{10, 0, 0, 1}), false},
+		{reflect.ValueOf("::1"), addrValue, netip.IPv6Loopback(), false},
+		{strValue, addrValue, netip.Addr{}, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToNetipAddrHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToNetipPrefixHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	prefixValue := reflect.ValueOf(netip.Prefix{})
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("10.0.0.0/8"), prefixValue,
+			netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, 0, 0}), 8), false},
+		{strValue, prefixValue, netip.Prefix{}, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToNetipPrefixHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToNetipHookFunc_compose(t *testing.T) {
+	type Network struct {
+		Gateway netip.Addr
+		Subnet  netip.Prefix
+	}
+
+	input := map[string]interface{}{
+		"gateway": "10.0.0.1",
+		"subnet":  "10.0.0.0/8",
+	}
+
+	var result Network
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			StringToNetipAddrHookFunc(),
+			StringToNetipPrefixHookFunc(),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := Network{
+		Gateway: netip.MustParseAddr("10.0.0.1"),
+		Subnet:  netip.MustParsePrefix("10.0.0.0/8"),
+	}
+	if result != expected {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
+func TestStringToURLHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	urlValue := reflect.ValueOf(&url.URL{})
+	var nilURL *url.URL = nil
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("https://api.example.com/v1"), urlValue,
+			&url.URL{
+				Scheme: "https",
+				Host:   "api.example.com",
+				Path:   "/v1",
+			}, false},
+		{reflect.ValueOf(""), urlValue, nilURL, false},
+		{reflect.ValueOf("http://[::1"), urlValue, nil, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToURLHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToURLHookFunc_decode(t *testing.T) {
+	type Config struct {
+		Endpoint *url.URL
+		Fallback *url.URL
+	}
+
+	input := map[string]interface{}{
+		"endpoint": "https://api.example.com/v1",
+		"fallback": "",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToURLHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.Endpoint == nil || result.Endpoint.String() != "https://api.example.com/v1" {
+		t.Fatalf("bad endpoint: %#v", result.Endpoint)
+	}
+	if result.Fallback != nil {
+		t.Fatalf("expected nil fallback, got %#v", result.Fallback)
+	}
+}
+
+func TestStringToRegexpHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	regexpValue := reflect.ValueOf(&regexp.Regexp{})
+	var nilRegexp *regexp.Regexp = nil
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("^a+b$"), regexpValue, regexp.MustCompile("^a+b$"), false},
+		{reflect.ValueOf(""), regexpValue, nilRegexp, false},
+		{reflect.ValueOf("a("), regexpValue, nil, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToRegexpHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToRegexpPOSIXHookFunc(t *testing.T) {
+	regexpValue := reflect.ValueOf(&regexp.Regexp{})
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("a+|ab"), regexpValue, regexp.MustCompilePOSIX("a+|ab"), false},
+		{reflect.ValueOf(`\d`), regexpValue, nil, true},
+	}
+
+	for i, tc := range cases {
+		f := StringToRegexpPOSIXHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToRegexpHookFunc_compose(t *testing.T) {
+	type Config struct {
+		Allow   *regexp.Regexp
+		Deny    *regexp.Regexp
+		Timeout time.Duration
+	}
+
+	input := map[string]interface{}{
+		"allow":   "^foo",
+		"deny":    "",
+		"timeout": "5s",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			StringToTimeDurationHookFunc(),
+			StringToRegexpHookFunc(),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.Allow == nil || !result.Allow.MatchString("foobar") {
+		t.Fatalf("bad allow: %#v", result.Allow)
+	}
+	if result.Deny != nil {
+		t.Fatalf("expected nil deny, got %#v", result.Deny)
+	}
+	if result.Timeout != 5*time.Second {
+		t.Fatalf("bad timeout: %s", result.Timeout)
+	}
+}
+
+func TestStringToBase64BytesHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	sliceValue := reflect.ValueOf([]byte{})
+	arrayValue := reflect.ValueOf([4]byte{})
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("3q2+7w=="), sliceValue, []byte{0xde, 0xad, 0xbe, 0xef}, false},
+		{reflect.ValueOf("3q2+7w=="), arrayValue, [4]byte{0xde, 0xad, 0xbe, 0xef}, false},
+		{reflect.ValueOf(""), sliceValue, []byte{}, false},
+		{reflect.ValueOf("3q0="), arrayValue, nil, true},
+		{reflect.ValueOf("not base64!"), sliceValue, nil, true},
+		{strValue, strValue, "5", false},
+		{reflect.ValueOf("5"), reflect.ValueOf([]int{}), "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToBase64BytesHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToBase64BytesHookFunc_decode(t *testing.T) {
+	type Keys struct {
+		Public [32]byte
+		Secret []byte
+	}
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	input := map[string]interface{}{
+		"public": base64.StdEncoding.EncodeToString(key),
+		"secret": "c2VjcmV0",
+	}
+
+	var result Keys
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToBase64BytesHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if !bytes.Equal(result.Public[:], key) {
+		t.Fatalf("bad public: %v", result.Public)
+	}
+	if string(result.Secret) != "secret" {
+		t.Fatalf("bad secret: %q", result.Secret)
+	}
+}
+
+func TestStringToHexBytesHookFunc(t *testing.T) {
+	strValue := reflect.ValueOf("5")
+	sliceValue := reflect.ValueOf([]byte{})
+	arrayValue := reflect.ValueOf([4]byte{})
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("deadbeef"), sliceValue, []byte{0xde, 0xad, 0xbe, 0xef}, false},
+		{reflect.ValueOf("DEADBEEF"), arrayValue, [4]byte{0xde, 0xad, 0xbe, 0xef}, false},
+		{reflect.ValueOf("dead"), arrayValue, nil, true},
+		{reflect.ValueOf("abc"), sliceValue, nil, true},
+		{reflect.ValueOf("zz"), sliceValue, nil, true},
+		{strValue, strValue, "5", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToHexBytesHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	_, err := DecodeHookExec(StringToHexBytesHookFunc(), reflect.ValueOf("abc"), sliceValue)
+	if err == nil || !strings.Contains(err.Error(), `"abc"`) {
+		t.Fatalf("expected error naming input, got: %v", err)
+	}
+}
+
+func TestExpandHookFunc(t *testing.T) {
+	type Env string
+
+	strValue := reflect.ValueOf("")
+	vars := map[string]string{"HOME": "/home/user", "EMPTY": ""}
+
+	cases := []struct {
+		f, t           reflect.Value
+		allowUndefined bool
+		result         interface{}
+		err            bool
+	}{
+		{reflect.ValueOf("${HOME}/data"), strValue, false, "/home/user/data", false},
+		{reflect.ValueOf("$HOME"), strValue, false, "/home/user", false},
+		{reflect.ValueOf("x${EMPTY}y"), strValue, false, "xy", false},
+		{reflect.ValueOf("cost: $$5"), strValue, false, "cost: $5", false},
+		{reflect.ValueOf("${MISSING}/data"), strValue, false, nil, true},
+		{reflect.ValueOf("${MISSING}/data"), strValue, true, "/data", false},
+		{reflect.ValueOf(Env("$HOME")), strValue, false, Env("/home/user"), false},
+		{reflect.ValueOf("${HOME}"), reflect.ValueOf(time.Duration(0)), false, "/home/user", false},
+		{reflect.ValueOf(5), strValue, false, 5, false},
+	}
+
+	for i, tc := range cases {
+		f := ExpandHookFunc(vars, tc.allowUndefined)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestEnvExpandHookFunc(t *testing.T) {
+	t.Setenv("MAPSTRUCTURE_TEST_DIR", "/tmp")
+	t.Setenv("MAPSTRUCTURE_TEST_TIMEOUT", "5s")
+
+	type Config struct {
+		Path    string
+		Timeout time.Duration
+	}
+
+	input := map[string]interface{}{
+		"path":    "${MAPSTRUCTURE_TEST_DIR}/data",
+		"timeout": "$MAPSTRUCTURE_TEST_TIMEOUT",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			EnvExpandHookFunc(),
+			StringToTimeDurationHookFunc(),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.Path != "/tmp/data" {
+		t.Fatalf("bad path: %q", result.Path)
+	}
+	if result.Timeout != 5*time.Second {
+		t.Fatalf("bad timeout: %s", result.Timeout)
+	}
+
+	err = decoder.Decode(map[string]interface{}{"path": "${MAPSTRUCTURE_TEST_UNDEFINED}"})
+	if err == nil || !strings.Contains(err.Error(), "MAPSTRUCTURE_TEST_UNDEFINED") {
+		t.Fatalf("expected undefined variable error, got: %v", err)
+	}
+}
+
+func TestUnixEpochToTimeHookFunc(t *testing.T) {
+	timeValue := reflect.ValueOf(time.Time{})
+	strValue := reflect.ValueOf("")
+
+	cases := []struct {
+		f, t   reflect.Value
+		unit   time.Duration
+		result interface{}
+	}{
+		{reflect.ValueOf(1700000000), timeValue, time.Second, time.Unix(1700000000, 0)},
+		{reflect.ValueOf(int64(-86400)), timeValue, time.Second, time.Unix(-86400, 0)},
+		{reflect.ValueOf(uint32(60)), timeValue, time.Minute, time.Unix(3600, 0)},
+		{reflect.ValueOf(int64(1700000000123)), timeValue, time.Millisecond, time.Unix(1700000000, 123000000)},
+		{reflect.ValueOf(int64(-1500)), timeValue, time.Millisecond, time.Unix(-2, 500000000)},
+		{reflect.ValueOf(1.5), timeValue, time.Second, time.Unix(1, 500000000)},
+		{reflect.ValueOf("1700000000"), timeValue, time.Second, "1700000000"},
+		{reflect.ValueOf(42), strValue, time.Second, 42},
+	}
+
+	for i, tc := range cases {
+		f := UnixEpochToTimeHookFunc(tc.unit)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if err != nil {
+			t.Fatalf("case %d: unexpected err: %s", i, err)
+		}
+		if expected, ok := tc.result.(time.Time); ok {
+			if actualTime, ok := actual.(time.Time); !ok || !actualTime.Equal(expected) {
+				t.Fatalf("case %d: expected %s, got %#v", i, expected, actual)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestUnixEpochToTimeHookFunc_compose(t *testing.T) {
+	type Event struct {
+		Created time.Time
+		Updated time.Time
+	}
+
+	input := map[string]interface{}{
+		"created": 1700000000,
+		"updated": "2023-11-14T22:13:20Z",
+	}
+
+	var result Event
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			UnixEpochToTimeHookFunc(time.Second),
+			StringToTimeHookFunc(time.RFC3339),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := time.Unix(1700000000, 0)
+	if !result.Created.Equal(expected) || !result.Updated.Equal(expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestStringToBigIntHookFunc(t *testing.T) {
+	bigIntValue := reflect.ValueOf(&big.Int{})
+	strValue := reflect.ValueOf("")
+	var nilBigInt *big.Int
+
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("123456789012345678901234567890"), bigIntValue, huge, false},
+		{reflect.ValueOf("-42"), bigIntValue, big.NewInt(-42), false},
+		{reflect.ValueOf("0x1f"), bigIntValue, big.NewInt(31), false},
+		{reflect.ValueOf(""), bigIntValue, nilBigInt, false},
+		{reflect.ValueOf("1.5"), bigIntValue, nil, true},
+		{reflect.ValueOf(42), bigIntValue, big.NewInt(42), false},
+		{reflect.ValueOf(uint64(math.MaxUint64)), bigIntValue, new(big.Int).SetUint64(math.MaxUint64), false},
+		{reflect.ValueOf(1e20), bigIntValue, new(big.Int).Mul(big.NewInt(1e10), big.NewInt(1e10)), false},
+		{reflect.ValueOf(1.5), bigIntValue, nil, true},
+		{reflect.ValueOf("42"), strValue, "42", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToBigIntHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestStringToBigRatHookFunc(t *testing.T) {
+	bigRatValue := reflect.ValueOf(&big.Rat{})
+	strValue := reflect.ValueOf("")
+	var nilBigRat *big.Rat
+
+	cases := []struct {
+		f, t   reflect.Value
+		exact  bool
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf("1/3"), bigRatValue, false, big.NewRat(1, 3), false},
+		{reflect.ValueOf("0.333"), bigRatValue, false, big.NewRat(333, 1000), false},
+		{reflect.ValueOf(""), bigRatValue, false, nilBigRat, false},
+		{reflect.ValueOf("1/0"), bigRatValue, false, nil, true},
+		{reflect.ValueOf(-7), bigRatValue, false, big.NewRat(-7, 1), false},
+		{reflect.ValueOf(0.1), bigRatValue, false, big.NewRat(1, 10), false},
+		{reflect.ValueOf(float32(0.1)), bigRatValue, false, big.NewRat(1, 10), false},
+		{reflect.ValueOf(0.1), bigRatValue, true, nil, true},
+		{reflect.ValueOf(0.25), bigRatValue, true, big.NewRat(1, 4), false},
+		{reflect.ValueOf(math.Inf(1)), bigRatValue, false, nil, true},
+		{reflect.ValueOf("1/3"), strValue, false, "1/3", false},
+	}
+
+	for i, tc := range cases {
+		f := StringToBigRatHookFunc()
+		if tc.exact {
+			f = StringToBigRatExactHookFunc()
+		}
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+type testLogLevel int
+
+const (
+	testLevelDebug testLogLevel = iota
+	testLevelInfo
+	testLevelError
+)
+
+func TestStringToEnumHookFunc(t *testing.T) {
+	levels := map[string]testLogLevel{
+		"debug": testLevelDebug,
+		"info":  testLevelInfo,
+		"error": testLevelError,
+	}
+	levelValue := reflect.ValueOf(testLogLevel(0))
+	strValue := reflect.ValueOf("")
+
+	cases := []struct {
+		f, t            reflect.Value
+		caseInsensitive bool
+		result          interface{}
+		err             bool
+	}{
+		{reflect.ValueOf("info"), levelValue, false, testLevelInfo, false},
+		{reflect.ValueOf("INFO"), levelValue, false, nil, true},
+		{reflect.ValueOf("INFO"), levelValue, true, testLevelInfo, false},
+		{reflect.ValueOf("warn"), levelValue, true, nil, true},
+		{reflect.ValueOf("info"), strValue, false, "info", false},
+		{reflect.ValueOf(1), levelValue, false, 1, false},
+	}
+
+	for i, tc := range cases {
+		f := StringToEnumHookFunc(levels, tc.caseInsensitive)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	_, err := DecodeHookExec(StringToEnumHookFunc(levels, false), reflect.ValueOf("warn"), levelValue)
+	expected := `invalid value "warn" for mapstructure.testLogLevel, expected one of: debug, error, info`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected %q, got: %v", expected, err)
+	}
+}
+
+func TestStringToEnumHookFunc_decode(t *testing.T) {
+	type Color string
+
+	type Config struct {
+		Level testLogLevel
+		Color Color
+		Name  string
+	}
+
+	input := map[string]interface{}{
+		"level": "error",
+		"color": "Red",
+		"name":  "info",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			StringToEnumHookFunc(map[string]testLogLevel{"error": testLevelError}, false),
+			StringToEnumHookFunc(map[string]Color{"red": "#f00"}, true),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := Config{Level: testLevelError, Color: "#f00", Name: "info"}
+	if result != expected {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestEnumToStringHookFunc(t *testing.T) {
+	names := map[testLogLevel]string{
+		testLevelDebug: "debug",
+		testLevelInfo:  "info",
+	}
+	strValue := reflect.ValueOf("")
+	ifaceValue := reflect.ValueOf(new(interface{})).Elem()
+	intValue := reflect.ValueOf(0)
+
+	cases := []struct {
+		f, t         reflect.Value
+		allowUnknown bool
+		result       interface{}
+		err          bool
+	}{
+		{reflect.ValueOf(testLevelInfo), strValue, false, "info", false},
+		{reflect.ValueOf(testLevelDebug), ifaceValue, false, "debug", false},
+		{reflect.ValueOf(testLevelError), ifaceValue, false, nil, true},
+		{reflect.ValueOf(testLevelError), ifaceValue, true, testLevelError, false},
+		{reflect.ValueOf(testLevelInfo), intValue, false, testLevelInfo, false},
+		{reflect.ValueOf(1), strValue, false, 1, false},
+	}
+
+	for i, tc := range cases {
+		f := EnumToStringHookFunc(names, tc.allowUnknown)
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+type testShape interface {
+	Area() float64
+}
+
+type testCircle struct {
+	Kind   string
+	Radius float64
+}
+
+func (c testCircle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type testSquare struct {
+	Side float64
+}
+
+func (s *testSquare) Area() float64 { return s.Side * s.Side }
+
+func TestTaggedUnionHookFunc(t *testing.T) {
+	registry := map[string]reflect.Type{
+		"circle": reflect.TypeOf(testCircle{}),
+		"square": reflect.TypeOf(&testSquare{}),
+	}
+
+	var result struct {
+		Shapes []testShape
+		Other  interface{}
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: TaggedUnionHookFunc(registry, "kind"),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	input := map[string]interface{}{
+		"shapes": []interface{}{
+			map[string]interface{}{"circle": map[string]interface{}{"radius": 5}},
+			map[interface{}]interface{}{"square": map[interface{}]interface{}{"side": 2}},
+		},
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []testShape{
+		testCircle{Kind: "circle", Radius: 5},
+		&testSquare{Side: 2},
+	}
+	if !reflect.DeepEqual(result.Shapes, expected) {
+		t.Fatalf("bad: %#v", result.Shapes)
+	}
+
+	// Maps with more than one key are left alone.
+	input = map[string]interface{}{
+		"other": map[string]interface{}{"circle": 1, "square": 2},
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result.Other, map[string]interface{}{"circle": 1, "square": 2}) {
+		t.Fatalf("bad: %#v", result.Other)
+	}
+
+	// So are interfaces that none of the variants implement.
+	var unrelated fmt.Stringer
+	actual, err := DecodeHookExec(TaggedUnionHookFunc(registry, ""),
+		reflect.ValueOf(map[string]interface{}{"triangle": 1}),
+		reflect.ValueOf(&unrelated).Elem())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, map[string]interface{}{"triangle": 1}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	input = map[string]interface{}{
+		"shapes": []interface{}{
+			map[string]interface{}{"triangle": map[string]interface{}{}},
+		},
+	}
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `unknown variant "triangle"`) ||
+		!strings.Contains(err.Error(), "expected one of: circle, square") {
+		t.Fatalf("bad err: %s", err)
+	}
+}
+
+func TestSliceToMapByFieldHookFunc(t *testing.T) {
+	type Thing struct {
+		Name  string
+		Count int
+	}
+
+	input := map[string]interface{}{
+		"things": []interface{}{
+			map[string]interface{}{"id": "a", "name": "apple", "count": 1},
+			map[string]interface{}{"id": "b", "name": "banana", "count": 2},
+		},
+	}
+
+	var result struct {
+		Things map[string]Thing
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:  SliceToMapByFieldHookFunc("id", false),
+		ErrorUnused: true,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]Thing{
+		"a": {Name: "apple", Count: 1},
+		"b": {Name: "banana", Count: 2},
+	}
+	if !reflect.DeepEqual(result.Things, expected) {
+		t.Fatalf("bad: %#v", result.Things)
+	}
+
+	duplicates := []interface{}{
+		map[string]interface{}{"id": "a", "name": "apple"},
+		map[string]interface{}{"id": "a", "name": "avocado"},
+	}
+	mapValue := reflect.ValueOf(map[string]Thing{})
+
+	cases := []struct {
+		f        interface{}
+		lastWins bool
+		result   interface{}
+		err      string
+	}{
+		{duplicates, false, nil, "element 1: duplicate key 'a'"},
+		{duplicates, true, map[interface{}]interface{}{
+			"a": map[string]interface{}{"name": "avocado"},
+		}, ""},
+		{[]interface{}{map[string]interface{}{"name": "apple"}}, false, nil, "element 0: missing key field 'id'"},
+		{[]interface{}{"apple"}, false, nil, "element 0: expected a map, got 'string'"},
+	}
+
+	for i, tc := range cases {
+		f := SliceToMapByFieldHookFunc("id", tc.lastWins)
+		actual, err := DecodeHookExec(f, reflect.ValueOf(tc.f), mapValue)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("case %d: expected err %q, got %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: err: %s", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+
+	// Slices decoded into other types are left alone.
+	actual, err := DecodeHookExec(SliceToMapByFieldHookFunc("id", false),
+		reflect.ValueOf(duplicates), reflect.ValueOf([]Thing{}))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, duplicates) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestMapToSliceWithKeyHookFunc(t *testing.T) {
+	type Thing struct {
+		Name  string
+		Count int
+	}
+
+	type Config struct {
+		Things map[string]Thing
+	}
 
-	result, err := DecodeHookExec(
-		f, reflect.ValueOf(""), reflect.ValueOf([]byte("")))
+	config := Config{
+		Things: map[string]Thing{
+			"b": {Name: "banana", Count: 2},
+			"a": {Name: "apple", Count: 1},
+		},
+	}
+
+	var output map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: MapToSliceWithKeyHookFunc("id"),
+		Result:     &output,
+	})
 	if err != nil {
-		t.Fatalf("bad: %s", err)
+		t.Fatalf("err: %s", err)
 	}
-	if result.(string) != "bar" {
-		t.Fatalf("bad: %#v", result)
+	if err := decoder.Decode(config); err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
-}
 
-func TestOrComposeDecodeHookFunc_err(t *testing.T) {
-	f1 := func(
-		f reflect.Kind,
-		t reflect.Kind,
-		data interface{}) (interface{}, error) {
-		return nil, errors.New("f1 error")
+	expected := map[string]interface{}{
+		"Things": []interface{}{
+			map[string]interface{}{"id": "a", "Name": "apple", "Count": 1},
+			map[string]interface{}{"id": "b", "Name": "banana", "Count": 2},
+		},
 	}
-
-	f2 := func(
-		f reflect.Kind,
-		t reflect.Kind,
-		data interface{}) (interface{}, error) {
-		return nil, errors.New("f2 error")
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("bad: %#v", output)
 	}
 
-	f := OrComposeDecodeHookFunc(f1, f2)
+	var roundTrip Config
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook:  SliceToMapByFieldHookFunc("id", false),
+		ErrorUnused: true,
+		Result:      &roundTrip,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(output); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if !reflect.DeepEqual(roundTrip, config) {
+		t.Fatalf("bad: %#v", roundTrip)
+	}
 
-	_, err := DecodeHookExec(
-		f, reflect.ValueOf(""), reflect.ValueOf([]byte("")))
-	if err == nil {
-		t.Fatalf("bad: should return an error")
+	// Maps of other values are left alone when the target is an interface.
+	var iface interface{}
+	labels := map[string]string{"a": "b"}
+	actual, err := DecodeHookExec(MapToSliceWithKeyHookFunc("id"),
+		reflect.ValueOf(labels), reflect.ValueOf(&iface).Elem())
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	if err.Error() != "f1 error\nf2 error\n" {
-		t.Fatalf("bad: %s", err)
+	if !reflect.DeepEqual(actual, labels) {
+		t.Fatalf("bad: %#v", actual)
 	}
-}
 
-func TestComposeDecodeHookFunc_safe_nofuncs(t *testing.T) {
-	f := ComposeDecodeHookFunc()
-	type myStruct2 struct {
-		MyInt int
+	_, err = DecodeHookExec(MapToSliceWithKeyHookFunc("id"),
+		reflect.ValueOf(labels), reflect.ValueOf([]interface{}{}))
+	if err == nil || err.Error() != "key 'a': expected a map or struct, got 'string'" {
+		t.Fatalf("bad err: %v", err)
 	}
+}
 
-	type myStruct1 struct {
-		Blah map[string]myStruct2
+func TestToJSONRawMessageHookFunc(t *testing.T) {
+	type Plugin struct {
+		Name   string
+		Config json.RawMessage
 	}
 
-	src := &myStruct1{Blah: map[string]myStruct2{
-		"test": {
-			MyInt: 1,
+	input := map[string]interface{}{
+		"name": "cache",
+		"config": map[string]interface{}{
+			"size":  128,
+			"hosts": []interface{}{"a", "b"},
 		},
-	}}
-
-	dst := &myStruct1{}
-	dConf := &DecoderConfig{
-		Result:      dst,
-		ErrorUnused: true,
-		DecodeHook:  f,
 	}
-	d, err := NewDecoder(dConf)
+
+	var result Plugin
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ToJSONRawMessageHookFunc(),
+		Result:     &result,
+	})
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("err: %s", err)
 	}
-	err = d.Decode(src)
-	if err != nil {
-		t.Fatal(err)
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-}
 
-func TestStringToSliceHookFunc(t *testing.T) {
-	f := StringToSliceHookFunc(",")
+	var config struct {
+		Size  int
+		Hosts []string
+	}
+	if err := json.Unmarshal(result.Config, &config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Size != 128 || !reflect.DeepEqual(config.Hosts, []string{"a", "b"}) {
+		t.Fatalf("bad: %#v", config)
+	}
 
-	strValue := reflect.ValueOf("42")
-	sliceValue := reflect.ValueOf([]byte("42"))
+	rawValue := reflect.ValueOf(json.RawMessage{})
 	cases := []struct {
 		f, t   reflect.Value
 		result interface{}
 		err    bool
 	}{
-		{sliceValue, sliceValue, []byte("42"), false},
-		{strValue, strValue, "42", false},
-		{
-			reflect.ValueOf("foo,bar,baz"),
-			sliceValue,
-			[]string{"foo", "bar", "baz"},
-			false,
-		},
-		{
-			reflect.ValueOf(""),
-			sliceValue,
-			[]string{},
-			false,
-		},
+		{reflect.ValueOf("foo"), rawValue, json.RawMessage(`"foo"`), false},
+		{reflect.ValueOf(42), rawValue, json.RawMessage(`42`), false},
+		{reflect.ValueOf(json.RawMessage(`{}`)), rawValue, json.RawMessage(`{}`), false},
+		{reflect.ValueOf(map[string]interface{}{"ch": make(chan int)}), rawValue, nil, true},
+		{reflect.ValueOf("foo"), reflect.ValueOf(""), "foo", false},
 	}
 
 	for i, tc := range cases {
+		f := ToJSONRawMessageHookFunc()
 		actual, err := DecodeHookExec(f, tc.f, tc.t)
 		if tc.err != (err != nil) {
 			t.Fatalf("case %d: expected err %#v", i, tc.err)
@@ -244,22 +2430,78 @@ func TestStringToSliceHookFunc(t *testing.T) {
 	}
 }
 
-func TestStringToTimeDurationHookFunc(t *testing.T) {
-	f := StringToTimeDurationHookFunc()
+func TestEnumToStringHookFunc_roundTrip(t *testing.T) {
+	type Config struct {
+		Level testLogLevel `mapstructure:"level"`
+	}
 
-	timeValue := reflect.ValueOf(time.Duration(5))
+	levels := map[string]testLogLevel{"debug": testLevelDebug, "info": testLevelInfo}
+	names := map[testLogLevel]string{testLevelDebug: "debug", testLevelInfo: "info"}
+	input := map[string]interface{}{"level": "info"}
+
+	var config Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: StringToEnumHookFunc(levels, false),
+		Result:     &config,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if config.Level != testLevelInfo {
+		t.Fatalf("bad level: %v", config.Level)
+	}
+
+	var output map[string]interface{}
+	decoder, err = NewDecoder(&DecoderConfig{
+		EncodeHook: EnumToStringHookFunc(names, false),
+		Result:     &output,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(config); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if !reflect.DeepEqual(output, input) {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+type testColor struct {
+	R, G, B uint8
+}
+
+func parseTestColor(s string) (testColor, error) {
+	switch s {
+	case "red":
+		return testColor{R: 255}, nil
+	case "green":
+		return testColor{G: 255}, nil
+	}
+	return testColor{}, errors.New("unknown color")
+}
+
+func TestRegisterStringParser(t *testing.T) {
+	colorValue := reflect.ValueOf(testColor{})
 	strValue := reflect.ValueOf("")
+
 	cases := []struct {
 		f, t   reflect.Value
 		result interface{}
 		err    bool
 	}{
-		{reflect.ValueOf("5s"), timeValue, 5 * time.Second, false},
-		{reflect.ValueOf("5"), timeValue, time.Duration(0), true},
-		{reflect.ValueOf("5"), strValue, "5", false},
+		{reflect.ValueOf("red"), colorValue, testColor{R: 255}, false},
+		{reflect.ValueOf("green"), colorValue, testColor{G: 255}, false},
+		{reflect.ValueOf("mauve"), colorValue, nil, true},
+		{reflect.ValueOf("red"), strValue, "red", false},
+		{reflect.ValueOf(1), colorValue, 1, false},
 	}
 
 	for i, tc := range cases {
+		f := RegisterStringParser(parseTestColor)
 		actual, err := DecodeHookExec(f, tc.f, tc.t)
 		if tc.err != (err != nil) {
 			t.Fatalf("case %d: expected err %#v", i, tc.err)
@@ -270,25 +2512,55 @@ func TestStringToTimeDurationHookFunc(t *testing.T) {
 				i, tc.result, actual)
 		}
 	}
+
+	var result struct {
+		Fg testColor
+		Bg *testColor
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: RegisterStringParser(parseTestColor),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"fg": "red", "bg": "green"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Fg != (testColor{R: 255}) || result.Bg == nil || *result.Bg != (testColor{G: 255}) {
+		t.Fatalf("bad: %#v", result)
+	}
 }
 
-func TestStringToTimeHookFunc(t *testing.T) {
-	strValue := reflect.ValueOf("5")
-	timeValue := reflect.ValueOf(time.Time{})
+type testUint32LE uint32
+
+func (u *testUint32LE) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return fmt.Errorf("expected 4 bytes, got %d", len(data))
+	}
+	*u = testUint32LE(binary.LittleEndian.Uint32(data))
+	return nil
+}
+
+func TestBinaryUnmarshallerHookFunc(t *testing.T) {
+	type MyBytes []byte
+	u32 := func(v testUint32LE) *testUint32LE { return &v }
+
 	cases := []struct {
 		f, t   reflect.Value
-		layout string
 		result interface{}
 		err    bool
 	}{
-		{reflect.ValueOf("2006-01-02T15:04:05Z"), timeValue, time.RFC3339,
-			time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), false},
-		{strValue, timeValue, time.RFC3339, time.Time{}, true},
-		{strValue, strValue, time.RFC3339, "5", false},
+		{reflect.ValueOf([]byte{1, 0, 0, 0}), reflect.ValueOf(testUint32LE(0)), u32(1), false},
+		{reflect.ValueOf(MyBytes{0, 1, 0, 0}), reflect.ValueOf(testUint32LE(0)), u32(256), false},
+		{reflect.ValueOf("\x02\x00\x00\x00"), reflect.ValueOf(testUint32LE(0)), u32(2), false},
+		{reflect.ValueOf([]byte{1, 2}), reflect.ValueOf(testUint32LE(0)), nil, true},
+		{reflect.ValueOf(5), reflect.ValueOf(testUint32LE(0)), 5, false},
+		{reflect.ValueOf([]byte{1}), reflect.ValueOf([]byte{}), []byte{1}, false},
 	}
 
 	for i, tc := range cases {
-		f := StringToTimeHookFunc(tc.layout)
+		f := BinaryUnmarshallerHookFunc()
 		actual, err := DecodeHookExec(f, tc.f, tc.t)
 		if tc.err != (err != nil) {
 			t.Fatalf("case %d: expected err %#v", i, tc.err)
@@ -301,22 +2573,64 @@ func TestStringToTimeHookFunc(t *testing.T) {
 	}
 }
 
-func TestStringToIPHookFunc(t *testing.T) {
-	strValue := reflect.ValueOf("5")
-	ipValue := reflect.ValueOf(net.IP{})
+func TestBinaryUnmarshallerHookFunc_decode(t *testing.T) {
+	type Packet struct {
+		Seq testUint32LE
+	}
+
+	var result Packet
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: BinaryUnmarshallerHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(map[string]interface{}{"seq": []byte{0x78, 0x56, 0x34, 0x12}}); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.Seq != 0x12345678 {
+		t.Fatalf("bad: %#x", result.Seq)
+	}
+
+	err = decoder.Decode(map[string]interface{}{"seq": []byte{1}})
+	if err == nil || !strings.Contains(err.Error(), "failed unmarshalling mapstructure.testUint32LE: expected 4 bytes, got 1") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestStringToBoolExtendedHookFunc(t *testing.T) {
+	boolValue := reflect.ValueOf(false)
+	strValue := reflect.ValueOf("")
+
 	cases := []struct {
 		f, t   reflect.Value
 		result interface{}
 		err    bool
 	}{
-		{reflect.ValueOf("1.2.3.4"), ipValue,
-			net.IPv4(0x01, 0x02, 0x03, 0x04), false},
-		{strValue, ipValue, net.IP{}, true},
-		{strValue, strValue, "5", false},
+		{reflect.ValueOf("yes"), boolValue, true, false},
+		{reflect.ValueOf("YES"), boolValue, true, false},
+		{reflect.ValueOf("y"), boolValue, true, false},
+		{reflect.ValueOf("On"), boolValue, true, false},
+		{reflect.ValueOf("true"), boolValue, true, false},
+		{reflect.ValueOf("T"), boolValue, true, false},
+		{reflect.ValueOf("1"), boolValue, true, false},
+		{reflect.ValueOf("no"), boolValue, false, false},
+		{reflect.ValueOf("No"), boolValue, false, false},
+		{reflect.ValueOf("N"), boolValue, false, false},
+		{reflect.ValueOf("OFF"), boolValue, false, false},
+		{reflect.ValueOf("false"), boolValue, false, false},
+		{reflect.ValueOf("f"), boolValue, false, false},
+		{reflect.ValueOf("0"), boolValue, false, false},
+		{reflect.ValueOf("maybe"), boolValue, nil, true},
+		{reflect.ValueOf(""), boolValue, nil, true},
+		{reflect.ValueOf("yes"), strValue, "yes", false},
+		{reflect.ValueOf(1), boolValue, 1, false},
 	}
 
 	for i, tc := range cases {
-		f := StringToIPHookFunc()
+		f := StringToBoolExtendedHookFunc()
 		actual, err := DecodeHookExec(f, tc.f, tc.t)
 		if tc.err != (err != nil) {
 			t.Fatalf("case %d: expected err %#v", i, tc.err)
@@ -329,30 +2643,32 @@ func TestStringToIPHookFunc(t *testing.T) {
 	}
 }
 
-func TestStringToIPNetHookFunc(t *testing.T) {
-	strValue := reflect.ValueOf("5")
-	ipNetValue := reflect.ValueOf(net.IPNet{})
-	var nilNet *net.IPNet = nil
+func TestUnwrapValueHookFunc(t *testing.T) {
+	intValue := reflect.ValueOf(0)
+	strValue := reflect.ValueOf("")
+	mapValue := reflect.ValueOf(map[string]interface{}{})
+
+	wrapped := map[string]interface{}{"value": 42}
+	multi := map[string]interface{}{"value": 42, "unit": "ms"}
+	other := map[string]interface{}{"amount": 42}
 
 	cases := []struct {
 		f, t   reflect.Value
 		result interface{}
-		err    bool
 	}{
-		{reflect.ValueOf("1.2.3.4/24"), ipNetValue,
-			&net.IPNet{
-				IP:   net.IP{0x01, 0x02, 0x03, 0x00},
-				Mask: net.IPv4Mask(0xff, 0xff, 0xff, 0x00),
-			}, false},
-		{strValue, ipNetValue, nilNet, true},
-		{strValue, strValue, "5", false},
+		{reflect.ValueOf(wrapped), intValue, 42},
+		{reflect.ValueOf(map[string]interface{}{"value": "foo"}), strValue, "foo"},
+		{reflect.ValueOf(multi), intValue, multi},
+		{reflect.ValueOf(other), intValue, other},
+		{reflect.ValueOf(wrapped), mapValue, wrapped},
+		{reflect.ValueOf(5), intValue, 5},
 	}
 
 	for i, tc := range cases {
-		f := StringToIPNetHookFunc()
+		f := UnwrapValueHookFunc("value")
 		actual, err := DecodeHookExec(f, tc.f, tc.t)
-		if tc.err != (err != nil) {
-			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		if err != nil {
+			t.Fatalf("case %d: unexpected err %s", i, err)
 		}
 		if !reflect.DeepEqual(actual, tc.result) {
 			t.Fatalf(
@@ -360,6 +2676,29 @@ func TestStringToIPNetHookFunc(t *testing.T) {
 				i, tc.result, actual)
 		}
 	}
+
+	var result struct {
+		Count   int
+		Timeout map[string]interface{}
+	}
+	input := map[string]interface{}{
+		"count":   map[string]interface{}{"value": "7"},
+		"timeout": multi,
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:       UnwrapValueHookFunc("value"),
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Count != 7 || !reflect.DeepEqual(result.Timeout, multi) {
+		t.Fatalf("bad: %#v", result)
+	}
 }
 
 func TestWeaklyTypedHook(t *testing.T) {
@@ -542,6 +2881,45 @@ func TestStructToMapHookFuncTabled(t *testing.T) {
 	}
 }
 
+func TestStructToMapHookFunc_omitempty(t *testing.T) {
+	type Inner struct {
+		Name  string                 `mapstructure:"name,omitempty"`
+		Count int                    `mapstructure:"count,omitempty"`
+		Tags  []string               `mapstructure:"tags,omitempty"`
+		Extra map[string]interface{} `mapstructure:"extra,omitempty"`
+		Next  *Inner                 `mapstructure:"next,omitempty"`
+		Kept  string                 `mapstructure:"kept"`
+	}
+
+	type Outer struct {
+		Inner Inner  `mapstructure:"inner"`
+		Empty string `mapstructure:"empty,omitempty"`
+	}
+
+	var result map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: RecursiveStructToMapHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(Outer{Inner: Inner{Count: 1}}); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"inner": map[string]interface{}{
+			"count": 1,
+			"kept":  "",
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
 func TestTextUnmarshallerHookFunc(t *testing.T) {
 	type MyString string
 
@@ -569,3 +2947,146 @@ func TestTextUnmarshallerHookFunc(t *testing.T) {
 		}
 	}
 }
+
+type failingMarshaller struct{}
+
+func (failingMarshaller) MarshalText() ([]byte, error) {
+	return nil, errors.New("nope")
+}
+
+func TestTextMarshallerHookFunc(t *testing.T) {
+	var iface interface{}
+	ifaceValue := reflect.ValueOf(&iface).Elem()
+	strValue := reflect.ValueOf("")
+	ipValue := reflect.ValueOf(net.IP{})
+	var nilTime *time.Time
+
+	cases := []struct {
+		f, t   reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf(net.IPv4(1, 2, 3, 4)), ifaceValue, "1.2.3.4", false},
+		{reflect.ValueOf(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), strValue, "2020-01-02T03:04:05Z", false},
+		{reflect.ValueOf(net.IPv4(1, 2, 3, 4)), ipValue, net.IPv4(1, 2, 3, 4), false},
+		{reflect.ValueOf(nilTime), ifaceValue, nilTime, false},
+		{reflect.ValueOf(42), ifaceValue, 42, false},
+		{reflect.ValueOf(failingMarshaller{}), ifaceValue, nil, true},
+	}
+
+	for i, tc := range cases {
+		f := TextMarshallerHookFunc()
+		actual, err := DecodeHookExec(f, tc.f, tc.t)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestTextMarshallerHookFunc_encode(t *testing.T) {
+	type Config struct {
+		Addr    net.IP    `mapstructure:"addr"`
+		Created time.Time `mapstructure:"created"`
+		Name    string    `mapstructure:"name"`
+	}
+
+	input := Config{
+		Addr:    net.IPv4(10, 0, 0, 1),
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Name:    "foo",
+	}
+
+	var result map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: TextMarshallerHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"addr":    "10.0.0.1",
+		"created": "2020-01-02T03:04:05Z",
+		"name":    "foo",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+
+	// Decoding the map back with the matching unmarshaller round trips.
+	var back Config
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: TextUnmarshallerHookFunc(),
+		Result:     &back,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(result); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if !back.Addr.Equal(input.Addr) || !back.Created.Equal(input.Created) || back.Name != input.Name {
+		t.Fatalf("expected %#v, got %#v", input, back)
+	}
+}
+
+func TestTextMarshallerHookFunc_decode(t *testing.T) {
+	type Config struct {
+		Created interface{} `mapstructure:"created"`
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// As the EncodeHook, it doesn't touch values decoded into a struct.
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: TextMarshallerHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(map[string]interface{}{"created": created}); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.Created != created {
+		t.Fatalf("expected %#v, got %#v", created, result.Created)
+	}
+}
+
+func TestTextMarshallerHookFunc_error(t *testing.T) {
+	type Config struct {
+		Value failingMarshaller
+	}
+
+	var result map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: TextMarshallerHookFunc(),
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(Config{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) || derr.Path != "Value" {
+		t.Fatalf("bad error: %#v", err)
+	}
+}
@@ -11,6 +11,21 @@ import (
 // errors that occur in the course of a single decode.
 type Error struct {
 	Errors []string
+
+	// errs holds the original errors that Errors was built from, so that
+	// they can be unwrapped with errors.Is and errors.As.
+	errs []error
+}
+
+// newError builds an Error out of the given errors, keeping the original
+// errors around for unwrapping.
+func newError(errs []error) *Error {
+	points := make([]string, len(errs))
+	for i, err := range errs {
+		points[i] = err.Error()
+	}
+
+	return &Error{Errors: points, errs: errs}
 }
 
 func (e *Error) Error() string {
@@ -32,6 +47,12 @@ func (e *Error) WrappedErrors() []error {
 		return nil
 	}
 
+	if e.errs != nil {
+		result := make([]error, len(e.errs))
+		copy(result, e.errs)
+		return result
+	}
+
 	result := make([]error, len(e.Errors))
 	for i, e := range e.Errors {
 		result[i] = errors.New(e)
@@ -40,11 +61,88 @@ func (e *Error) WrappedErrors() []error {
 	return result
 }
 
-func appendErrors(errors []string, err error) []string {
+// Unwrap returns the individual errors so that errors.Is and errors.As
+// can match any of them.
+func (e *Error) Unwrap() []error {
+	return e.WrappedErrors()
+}
+
+// UnusedKeysError is returned when DecoderConfig.ErrorUnused is set and
+// maps have keys that don't correspond to any field of the structs they
+// are decoded into. Keys holds the full path of each such key from all of
+// the structs, for example "Server.Hostname", in sorted order.
+type UnusedKeysError struct {
+	Keys []string
+}
+
+func (e *UnusedKeysError) Error() string {
+	return fmt.Sprintf("invalid keys: %s", strings.Join(e.Keys, ", "))
+}
+
+// mergeUnusedKeysErrors combines the UnusedKeysErrors of the structs
+// decoded from err, which is an *Error, into a single UnusedKeysError with
+// the keys of all of them. Other errors are returned as they are.
+func mergeUnusedKeysErrors(err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return err
+	}
+
+	errs := e.WrappedErrors()
+	merged := make([]error, 0, len(errs))
+	var unused *UnusedKeysError
+	for _, err := range errs {
+		uerr, ok := err.(*UnusedKeysError)
+		if !ok {
+			merged = append(merged, err)
+			continue
+		}
+
+		if unused == nil {
+			unused = &UnusedKeysError{}
+			merged = append(merged, unused)
+		}
+		unused.Keys = append(unused.Keys, uerr.Keys...)
+	}
+	if unused == nil {
+		return err
+	}
+
+	sort.Strings(unused.Keys)
+	return newError(merged)
+}
+
+// DecodeError is an error that occurred while decoding a single value.
+// Path is the location of the value in the result, using dotted notation
+// for struct fields and brackets for slice, array and map elements, for
+// example "Servers[2].Port". Path is empty for the top-level value.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func newDecodeError(name string, err error) *DecodeError {
+	return &DecodeError{Path: name, Err: err}
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func appendErrors(errors []error, err error) []error {
 	switch e := err.(type) {
 	case *Error:
-		return append(errors, e.Errors...)
+		return append(errors, e.WrappedErrors()...)
 	default:
-		return append(errors, e.Error())
+		return append(errors, e)
 	}
 }
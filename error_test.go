@@ -0,0 +1,213 @@
+package mapstructure
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestError_As(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		Vint   int
+		Vuint  uint
+		Vfloat float64
+	}
+
+	input := map[string]interface{}{
+		"vint":   "foo",
+		"vuint":  "bar",
+		"vfloat": "baz",
+	}
+
+	var result Target
+	err := WeakDecode(input, &result)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var derr *Error
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if len(derr.Errors) != 3 {
+		t.Fatalf("expected 3 errors, got %#v", derr.Errors)
+	}
+
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Fatalf("expected *strconv.NumError in %s", err)
+	}
+	if numErr.Func == "" {
+		t.Fatalf("bad: %#v", numErr)
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	t.Parallel()
+
+	errSentinel := errors.New("sentinel")
+
+	type Target struct {
+		Foo string
+		Bar string
+	}
+
+	input := map[string]interface{}{
+		"foo": "a",
+		"bar": "b",
+	}
+
+	var result Target
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: func(from, to reflect.Kind, data interface{}) (interface{}, error) {
+			if data == "b" {
+				return nil, errSentinel
+			}
+			return data, nil
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if !errors.Is(err, errSentinel) {
+		t.Fatalf("expected sentinel error, got %s", err)
+	}
+	if errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("unexpected match in %s", err)
+	}
+}
+
+func TestError_WrappedErrors(t *testing.T) {
+	t.Parallel()
+
+	err := &Error{Errors: []string{"foo", "bar"}}
+	wrapped := err.WrappedErrors()
+	if len(wrapped) != 2 || wrapped[0].Error() != "foo" || wrapped[1].Error() != "bar" {
+		t.Fatalf("bad: %#v", wrapped)
+	}
+
+	var nilErr *Error
+	if nilErr.WrappedErrors() != nil {
+		t.Fatal("expected nil")
+	}
+}
+
+func TestDecodeError_Path(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host string
+		Port int
+	}
+
+	type Config struct {
+		Servers []Server
+	}
+
+	input := map[string]interface{}{
+		"servers": []map[string]interface{}{
+			{"host": "a", "port": 1},
+			{"host": "b", "port": 2},
+			{"host": "c", "port": "http"},
+		},
+	}
+
+	var result Config
+	err := Decode(input, &result)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected *DecodeError, got %T", err)
+	}
+	if derr.Path != "Servers[2].Port" {
+		t.Fatalf("bad path: %q", derr.Path)
+	}
+
+	expected := "Servers[2].Port: expected type 'int', got unconvertible type 'string', value: 'http'"
+	if derr.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, derr.Error())
+	}
+}
+
+func TestDecodeError_NoPath(t *testing.T) {
+	t.Parallel()
+
+	var result int
+	err := Decode("foo", &result)
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected *DecodeError, got %T", err)
+	}
+	if derr.Path != "" {
+		t.Fatalf("bad path: %q", derr.Path)
+	}
+	if err.Error() != derr.Err.Error() {
+		t.Fatalf("expected no path prefix, got %q", err.Error())
+	}
+}
+
+func TestUnusedKeysError(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host string
+	}
+
+	type Config struct {
+		Name   string
+		Server Server
+	}
+
+	input := map[string]interface{}{
+		"name":  "foo",
+		"zzz":   true,
+		"extra": 1,
+		"server": map[string]interface{}{
+			"host": "localhost",
+			"port": 8080,
+		},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var keys []string
+	for _, err := range err.(*Error).WrappedErrors() {
+		var uerr *UnusedKeysError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("expected *UnusedKeysError, got %T", err)
+		}
+		if !sort.StringsAreSorted(uerr.Keys) {
+			t.Fatalf("keys not sorted: %#v", uerr.Keys)
+		}
+		keys = append(keys, uerr.Keys...)
+	}
+	sort.Strings(keys)
+
+	expected := []string{"Server.port", "extra", "zzz"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+}
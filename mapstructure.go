@@ -58,6 +58,10 @@
 //         "person": map[string]interface{}{"name": "alice"},
 //     }
 //
+// The same goes for embedded struct pointers, so a nil *Person is only
+// allocated when the input has a "person" key, not when it has keys for
+// the fields of Person.
+//
 // If your "person" value is NOT nested, then you can append ",squash" to
 // your tag value and mapstructure will treat it as if the embedded struct
 // were part of the struct directly. Example:
@@ -83,9 +87,29 @@
 //         "name": "alice",
 //     }
 //
+// An interface field can be squashed as well, in which case the struct or
+// struct pointer it holds is squashed. Squashing a nil interface does
+// nothing unless DecoderConfig.DefaultInterfaceTypes provides a type to
+// allocate for it.
+//
 // DecoderConfig has a field that changes the behavior of mapstructure
 // to always squash embedded structs.
 //
+// A map field with a string key type may also be squashed. When decoding
+// from a map, it collects any keys that don't match another field, the
+// same way a "remain" field does; if the struct also has a "remain" field,
+// that field takes precedence. When decoding from a struct to a map, the
+// entries of the squashed map are merged into the result, but never
+// replace a key set by one of the struct's fields:
+//
+//     type Config struct {
+//         Name  string
+//         Extra map[string]interface{} `mapstructure:",squash"`
+//     }
+//
+// The "inline" tag option is an alias for "squash", for those used to it
+// from YAML packages.
+//
 // Remainder Values
 //
 // If there are any unmapped keys in the source value, mapstructure by
@@ -94,8 +118,8 @@
 // of the unused keys.
 //
 // You can also use the ",remain" suffix on your tag to collect all unused
-// values in a map. The field with this tag MUST be a map type and should
-// probably be a "map[string]interface{}" or "map[interface{}]interface{}".
+// values in a map. The field with this tag MUST be a map type and is
+// usually a "map[string]interface{}" or "map[interface{}]interface{}".
 // See example below:
 //
 //     type Friend struct {
@@ -111,6 +135,16 @@
 //         "address": "123 Maple St.",
 //     }
 //
+// The map may have any element type, such as map[string]int: each unused
+// value is then decoded into the element type like any other value, with
+// hooks and WeaklyTypedInput applied, and values that can't be converted
+// are errors that name their key.
+//
+// Nested structs may have their own ",remain" field, which collects the
+// unused keys at that level. Keys collected by a ",remain" field are not
+// considered unused, so they are not reported by ErrorUnused or in
+// Metadata.Unused.
+//
 // Omit Empty Values
 //
 // When decoding from a struct to any other value, you may use the
@@ -126,6 +160,40 @@
 //         Age int `mapstructure:",omitempty"`
 //     }
 //
+// The ",omitzero" suffix is similar but omits the value if it is the zero
+// value of its type. If the type has an "IsZero() bool" method, such as
+// time.Time, that method is used to decide instead.
+//
+//     type Source struct {
+//         CreatedAt time.Time `mapstructure:",omitzero"`
+//     }
+//
+// Default Values
+//
+// When decoding from a map to a struct, you may use the ",default=" option
+// on your tag to give a field a value when its key is missing from the input.
+// The default is decoded as if it were a string in the input with
+// WeaklyTypedInput enabled, so it may be used with numeric and boolean
+// fields as well. The default is not applied if the key is present, even
+// when its value is the zero value. Defaults cannot contain commas.
+//
+//     type Server struct {
+//         Port int `mapstructure:"port,default=8080"`
+//     }
+//
+// Default processing can be turned off with IgnoreDefaults in DecoderConfig.
+//
+// Required Values
+//
+// The ",required" option makes it an error for the key of a field to be
+// missing from the input map. A key that is present satisfies the
+// requirement even if its value is the zero value. Unlike ErrorUnset in
+// DecoderConfig, this only applies to the tagged fields.
+//
+//     type Server struct {
+//         Port int `mapstructure:"port,required"`
+//     }
+//
 // Unexported fields
 //
 // Since unexported (private) struct fields cannot be set outside the package
@@ -162,18 +230,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // DecodeHookFunc is the callback function that can be used for
 // data transformations. See "DecodeHook" in the DecoderConfig
 // struct.
 //
-// The type must be one of DecodeHookFuncType, DecodeHookFuncKind, or
-// DecodeHookFuncValue.
+// The type must be one of DecodeHookFuncType, DecodeHookFuncKind,
+// DecodeHookFuncValue, DecodeHookFuncValueNamed or DecodeHookFuncReflect.
 // Values are a superset of Types (Values can return types), and Types are a
 // superset of Kinds (Types can return Kinds) and are generally a richer thing
 // to use, but Kinds are simpler if you only need those.
@@ -194,8 +264,28 @@ type DecodeHookFuncKind func(reflect.Kind, reflect.Kind, interface{}) (interface
 
 // DecodeHookFuncValue is a DecodeHookFunc which has complete access to both the source and target
 // values.
+//
+// Unless ZeroFields is set, the target value holds the current contents of
+// the value being decoded into, including existing map entries, so a hook
+// can merge with them, for example by appending to a slice. Map entries
+// are still replaced rather than merged when the hook returns data to
+// decode: the existing entry is only passed as the target. With
+// ZeroFieldsPresent, fields present in the input are zeroed before their
+// hook runs.
 type DecodeHookFuncValue func(from reflect.Value, to reflect.Value) (interface{}, error)
 
+// DecodeHookFuncValueNamed is a DecodeHookFuncValue which also receives the
+// path of the value being decoded, such as "Servers[2].Port". The path is
+// empty for the top-level value.
+type DecodeHookFuncValueNamed func(from reflect.Value, to reflect.Value, name string) (interface{}, error)
+
+// DecodeHookFuncReflect is a DecodeHookFuncType that takes and returns the
+// data as a reflect.Value, for hooks that already work with reflection.
+// Within ComposeDecodeHookFunc its result is passed to the next hook
+// without being converted to an interface{} and back. Returning the zero
+// reflect.Value is the same as returning nil.
+type DecodeHookFuncReflect func(from reflect.Type, to reflect.Type, data reflect.Value) (reflect.Value, error)
+
 // DecoderConfig is the configuration that is used to create a new decoder
 // and allows customization of various aspects of decoding.
 type DecoderConfig struct {
@@ -210,15 +300,40 @@ type DecoderConfig struct {
 	// If an error is returned, the entire decode will fail with that error.
 	DecodeHook DecodeHookFunc
 
+	// TypeHooks maps target types to the hook to use when decoding into a
+	// value of that type. A matching hook is run instead of DecodeHook, so
+	// values of commonly used types don't go through a long chain of
+	// composed hooks; values of other types use DecodeHook as usual.
+	TypeHooks map[reflect.Type]DecodeHookFunc
+
+	// EncodeHook, if set, is called instead of DecodeHook and TypeHooks
+	// when decoding a struct into a map: once with the struct and the map,
+	// and once for every field value of the struct with the map's value
+	// type as the target. Nested structs aren't passed to it again when
+	// they are decoded into their own map. DecodeHook is still used in the
+	// other direction, so hooks which only make sense when encoding
+	// structs, such as TextMarshallerHookFunc, don't affect decoding maps
+	// into structs. If EncodeHook is nil, DecodeHook is called in both
+	// directions.
+	EncodeHook DecodeHookFunc
+
 	// If ErrorUnused is true, then it is an error for there to exist
 	// keys in the original map that were unused in the decoding process
-	// (extra keys).
+	// (extra keys). The extra keys of all of the structs that are decoded
+	// are reported together, by their full paths, in one *UnusedKeysError.
 	ErrorUnused bool
 
+	// OnUnused, if set, is called with the path and value of each key in
+	// the input that wasn't decoded into anything, in sorted order for each
+	// struct. It takes precedence over ErrorUnused. If it returns an error
+	// the decode fails with that error.
+	OnUnused func(path string, value interface{}) error
+
 	// If ErrorUnset is true, then it is an error for there to exist
 	// fields in the result that were not set in the decoding process
 	// (extra fields). This only applies to decoding to a struct. This
-	// will affect all nested structs as well.
+	// will affect all nested structs as well. Fields tagged with "-" or
+	// ",omitempty" and unexported fields are never reported.
 	ErrorUnset bool
 
 	// ZeroFields, if set to true, will zero fields before writing them.
@@ -226,6 +341,28 @@ type DecoderConfig struct {
 	// it. If this is false, a map will be merged.
 	ZeroFields bool
 
+	// ZeroFieldsPresent, if set to true, will zero struct fields before
+	// writing them, but only for fields that have a matching key in the
+	// input. Fields missing from the input keep their current value. Nested
+	// structs are not zeroed as a whole; their fields are handled the same
+	// way recursively. For example, a map field present in the input is
+	// replaced rather than merged, while an absent one is left untouched.
+	ZeroFieldsPresent bool
+
+	// DecodeNil, if set to true, makes a nil input value, such as a JSON
+	// null, clear a pointer, map, slice or interface target by setting it
+	// to nil, instead of leaving its current value alone. This allows an
+	// input decoded onto an existing result to unset values explicitly.
+	// Targets of other kinds are left alone unless ZeroFields is set.
+	DecodeNil bool
+
+	// EmptyStringAsNil, if set to true, makes an empty string decoded into
+	// a pointer, map or slice set it to nil instead of being converted,
+	// which is useful for form data where "" means no value. Decode hooks
+	// still run first. Empty strings decoded into other types are handled
+	// as usual.
+	EmptyStringAsNil bool
+
 	// If WeaklyTypedInput is true, the decoder will make the following
 	// "weak" conversions:
 	//
@@ -237,15 +374,32 @@ type DecoderConfig struct {
 	//   - string to bool (accepts: 1, t, T, TRUE, true, True, 0, f, F,
 	//     FALSE, false, False. Anything else is an error)
 	//   - empty array = empty map and vice versa
-	//   - negative numbers to overflowed uint values (base 10)
 	//   - slice of maps to a merged map
 	//   - single values are converted to slices if required. Each
 	//     element is weakly decoded. For example: "4" can become []int{4}
 	//     if the target type is an int slice.
 	//
+	// Negative numbers are never converted to unsigned integers, even
+	// with WeaklyTypedInput; this is always an error.
+	//
 	WeaklyTypedInput bool
 
-	// Squash will squash embedded structs.  A squash tag may also be
+	// DisallowBoolNumericCoercion, if set to true, makes decoding a bool
+	// into a number, or a number into a bool, an error even when
+	// WeaklyTypedInput is set, so that true can't silently become 1. The
+	// other weak conversions, such as between strings and numbers, are
+	// still allowed.
+	DisallowBoolNumericCoercion bool
+
+	// TrimStrings, if set to true, removes leading and trailing white
+	// space from every value decoded into a string target, including
+	// string map values and slice elements. Trimming happens after any
+	// conversion, so it doesn't affect parsing strings into other types.
+	TrimStrings bool
+
+	// Squash will squash embedded structs, including embedded struct
+	// pointers, in both decoding directions. Nil embedded struct pointers
+	// are allocated when decoding into them. A squash tag may also be
 	// added to an individual struct field using a tag.  For example:
 	//
 	//  type Parent struct {
@@ -265,14 +419,158 @@ type DecoderConfig struct {
 	// defaults to "mapstructure"
 	TagName string
 
+	// TagNameFallbacks lists additional tag names that are consulted, in
+	// order, for fields that don't have a TagName tag. This lets structs
+	// that are only annotated for another package, such as `json:"my_key"`,
+	// be decoded without duplicating their tags. The options in whichever
+	// tag is used (",omitempty", ",squash", etc.) are honored.
+	TagNameFallbacks []string
+
 	// IgnoreUntaggedFields ignores all struct fields without explicit
 	// TagName, comparable to `mapstructure:"-"` as default behaviour.
 	IgnoreUntaggedFields bool
 
+	// IgnoreFields lists the paths of struct fields that are never decoded
+	// into, as if they were tagged with "-". Paths are dotted, such as
+	// "Parent.Child", use the same names as error messages and
+	// Metadata.Keys, and are matched case-insensitively. Input keys for
+	// these fields are reported as unused unless DropIgnoredFields is set.
+	IgnoreFields []string
+
+	// AllowUnexportedFields, if set to true, allows unexported struct
+	// fields to be decoded into through FieldSetters. Reflection can't set
+	// unexported fields, so they are still skipped if they have no setter.
+	AllowUnexportedFields bool
+
+	// FieldSetters maps the paths of unexported struct fields to functions
+	// that set them, for a package decoding into its own types. Paths are
+	// written and matched like those in IgnoreFields. When the input has
+	// a value for the field, the function is called with a pointer to the
+	// struct that holds the field and the value as it is in the input.
+	// FieldSetters are only used if AllowUnexportedFields is set.
+	FieldSetters map[string]func(target, value interface{}) error
+
+	// DropIgnoredFields, if set to true, silently drops input keys that
+	// match a field in IgnoreFields instead of reporting them as unused.
+	DropIgnoredFields bool
+
+	// TagHooks maps custom tag options to decode hooks. When a struct field
+	// has one of these options, such as "secret" in
+	// `mapstructure:"password,secret"`, the hook is run on the field's input
+	// value before DecodeHook. If a field has several such options their
+	// hooks run in the order the options appear in the tag.
+	TagHooks map[string]DecodeHookFunc
+
 	// MatchName is the function used to match the map key to the struct
-	// field name or tag. Defaults to `strings.EqualFold`. This can be used
+	// field name or tag. Defaults to `strings.EqualFold`, which matches
+	// case-insensitively using Unicode case folding. This can be used
 	// to implement case-sensitive tag values, support snake casing, etc.
 	MatchName func(mapKey, fieldName string) bool
+
+	// CaseInsensitive, if set to true, matches map keys to struct field
+	// names and tags with `strings.EqualFold` instead of MatchName. A key
+	// that is exactly equal to a field's name or tag is only used for that
+	// field. Otherwise, if more than one key matches a field, or a key
+	// matches more than one field, decoding fails with an "ambiguous keys"
+	// error.
+	CaseInsensitive bool
+
+	// DecodeKeyFunc, if set, transforms the name of each untagged struct
+	// field into the key that is looked up in the input map. Fields with an
+	// explicit name in their tag always use that name. This can be used to
+	// match snake_case keys without tagging every field.
+	DecodeKeyFunc func(fieldName string) string
+
+	// TypeResolver, if set, is called when decoding a map into an
+	// interface to pick the concrete type to decode into, for example
+	// based on a "type" key in the map. The resolved type is allocated,
+	// decoded into and then assigned to the interface. If it returns false,
+	// the map is assigned to the interface as usual. It is called for every
+	// interface that a map is decoded into, including the elements of a
+	// []interface{} and the values of a map[string]interface{}.
+	TypeResolver func(input map[string]interface{}) (reflect.Type, bool)
+
+	// DefaultInterfaceTypes maps an interface type to the concrete type
+	// that is allocated and decoded into when a map or struct is decoded
+	// into a nil value of that interface type. Interfaces that already
+	// hold a value are decoded into as usual, and TypeResolver is
+	// consulted first. The concrete type, which is usually a pointer to a
+	// struct, must implement the interface.
+	DefaultInterfaceTypes map[reflect.Type]reflect.Type
+
+	// MaxDepth, if greater than zero, limits how deeply nested structs,
+	// maps, slices and arrays may be decoded. Exceeding it is an error. This
+	// protects against stack exhaustion on untrusted or cyclic input.
+	MaxDepth int
+
+	// PreprocessInput, if set, is called once with the input passed to
+	// Decode before anything is decoded, and whatever it returns is decoded
+	// instead. It can be used to normalize the whole input at once, such as
+	// renaming keys. An error it returns is returned from Decode as is and
+	// nothing is decoded.
+	PreprocessInput func(input interface{}) (interface{}, error)
+
+	// RootKey, if set, is the key of the top-level input map that holds
+	// the value to decode, for payloads wrapped as {"data": {...}}. It is
+	// looked up after PreprocessInput. Decode returns an error if the input
+	// isn't a map or doesn't have the key. Field names in errors and
+	// Metadata are relative to the value under RootKey.
+	RootKey string
+
+	// Validate, if set, is called with Result after a successful decode,
+	// including the ErrorUnused and ErrorUnset checks. It can be used to
+	// check invariants that involve several fields. An error it returns is
+	// returned from Decode as is; the decoded values are still written to
+	// Result.
+	Validate func(result interface{}) error
+
+	// DecodeIndexedMapToArray, if set to true, allows a map with string
+	// keys that are indexes, such as {"0": "a", "2": "c"}, to be decoded
+	// into a slice or an array. Each value is decoded into the element at
+	// its index and missing indexes are left alone. Slices are grown to fit
+	// the largest index, while an index past the end of an array is an
+	// error. So that a single large index can't exhaust memory, a slice
+	// may have at most 1024 more elements than the map has entries.
+	// Interface keys, as decoded by some YAML libraries, may also be
+	// integers.
+	DecodeIndexedMapToArray bool
+
+	// ArrayFillExact, if set to true, requires a slice or an array decoded
+	// into an array to have exactly as many elements as the array. By
+	// default a source with more elements than the array is an error, and
+	// one with fewer fills the start of the array and leaves the remaining
+	// elements alone, so they are zero in a new array.
+	ArrayFillExact bool
+
+	// ScalarToSingleField, if set to true, allows a bool, number or string
+	// to be decoded into a struct that has exactly one exported field, such
+	// as 5 into struct{ Value int }, by decoding it into that field.
+	ScalarToSingleField bool
+
+	// DecodeArrayToStructPositional, if set to true, allows a slice or an
+	// array to be decoded into a struct by decoding each element into the
+	// exported field at the same position, in declaration order, so that
+	// ["localhost", 8080] can fill struct{ Host string; Port int }. More
+	// elements than fields is an error; fields without an element are left
+	// alone.
+	DecodeArrayToStructPositional bool
+
+	// SortMapKeys, if set to true, processes map keys in sorted order
+	// instead of Go's random map iteration order. This includes the
+	// entries of remain fields and squashed maps. Decode hooks are then
+	// called, errors are reported and Metadata is filled in the same order
+	// on every run.
+	SortMapKeys bool
+
+	// IgnoreDefaults disables the ",default=" tag option so that fields
+	// missing from the input are left untouched, as in earlier versions.
+	IgnoreDefaults bool
+
+	// ErrorOnLossyNumericConversion, if set to true, makes it an error to
+	// decode a float with a fractional part into an integer, which would
+	// otherwise be truncated, or an integer into a float that can't
+	// represent it exactly.
+	ErrorOnLossyNumericConversion bool
 }
 
 // A Decoder takes a raw interface value and turns it into structured
@@ -281,6 +579,13 @@ type DecoderConfig struct {
 // more finely control how the Decoder behaves using the DecoderConfig
 // structure. The top-level Decode method is just a convenience that sets
 // up the most basic Decoder.
+//
+// A Decoder keeps no state between calls to Decode other than what is
+// collected into Metadata, so it can be reused to decode many inputs.
+// Decode only reads the configuration, so calling it from multiple
+// goroutines is safe as long as Metadata is nil and the result isn't
+// shared between them. Use Clone to get a Decoder with the same
+// configuration for a different result.
 type Decoder struct {
 	config *DecoderConfig
 }
@@ -297,8 +602,27 @@ type Metadata struct {
 
 	// Unset is a slice of field names that were found in the result interface
 	// but weren't set in the decoding process since there was no matching value
-	// in the input
+	// in the input. Nested fields are recorded with their full dotted path and
+	// fields of squashed structs are recorded as part of the parent struct.
 	Unset []string
+
+	// Coercions describes each lossy or WeaklyTypedInput conversion that
+	// was performed, such as a float truncated to an int or a string parsed
+	// as a bool, in the form "path: float64(42.9) -> int(42)".
+	Coercions []string
+}
+
+// OrderedMap is implemented by result types that want map input handed to
+// them one entry at a time, such as maps that remember insertion order.
+// When the result (or a pointer to it) implements OrderedMap, Set is
+// called with each key and its undecoded value instead of decoding into
+// the result directly.
+//
+// Go maps have no order, so their entries are passed in sorted key order.
+// Slices of structs or pointers to structs with Key and Value fields, such
+// as yaml.MapSlice, are passed in slice order.
+type OrderedMap interface {
+	Set(key, value interface{})
 }
 
 // Decode takes an input structure and uses reflection to translate it to
@@ -368,18 +692,64 @@ func WeakDecodeMetadata(input interface{}, output interface{}, metadata *Metadat
 	return decoder.Decode(input)
 }
 
+// DecodeTo is the same as Decode, but allocates the result itself and
+// returns it. T may be a pointer type, in which case a new value is
+// allocated for it.
+func DecodeTo[T any](input interface{}) (T, error) {
+	var result T
+	err := Decode(input, &result)
+	return result, err
+}
+
+// DecodeSlice decodes each element of input, such as a JSON array of
+// objects, into a T and returns the results. If any elements fail to
+// decode, the returned error reports each failure with the index of the
+// element, for example "[2].Name: ...", and the other elements are still
+// decoded.
+func DecodeSlice[T any](input []interface{}) ([]T, error) {
+	return DecodeTo[[]T](input)
+}
+
+// DecodeToWithConfig is the same as DecodeTo, but uses the given
+// configuration for decoding. The Result field of the configuration is
+// ignored and the configuration itself is not modified.
+func DecodeToWithConfig[T any](input interface{}, config *DecoderConfig) (T, error) {
+	var result T
+
+	var c DecoderConfig
+	if config != nil {
+		c = *config
+	}
+	c.Result = &result
+
+	decoder, err := NewDecoder(&c)
+	if err != nil {
+		return result, err
+	}
+
+	err = decoder.Decode(input)
+	return result, err
+}
+
+// Clone returns a shallow copy of c, so that a base configuration can be
+// changed for one decoder without affecting the others built from it.
+// DecodeHook and the other funcs, Result and Metadata are shared with c on
+// purpose, as are maps and slices such as TypeHooks and IgnoreFields:
+// assign new ones to the copy instead of modifying them in place. Set a
+// new Result, and a new Metadata if c collects any, before using the copy
+// for a decoder that runs alongside one built from c.
+func (c *DecoderConfig) Clone() *DecoderConfig {
+	config := *c
+	return &config
+}
+
 // NewDecoder returns a new decoder for the given configuration. Once
 // a decoder has been returned, the same configuration must not be used
-// again.
+// again; use DecoderConfig.Clone to build several decoders from one
+// configuration.
 func NewDecoder(config *DecoderConfig) (*Decoder, error) {
-	val := reflect.ValueOf(config.Result)
-	if val.Kind() != reflect.Ptr {
-		return nil, errors.New("result must be a pointer")
-	}
-
-	val = val.Elem()
-	if !val.CanAddr() {
-		return nil, errors.New("result must be addressable (a pointer)")
+	if err := checkResult(config.Result); err != nil {
+		return nil, err
 	}
 
 	if config.Metadata != nil {
@@ -394,6 +764,10 @@ func NewDecoder(config *DecoderConfig) (*Decoder, error) {
 		if config.Metadata.Unset == nil {
 			config.Metadata.Unset = make([]string, 0)
 		}
+
+		if config.Metadata.Coercions == nil {
+			config.Metadata.Coercions = make([]string, 0)
+		}
 	}
 
 	if config.TagName == "" {
@@ -411,14 +785,164 @@ func NewDecoder(config *DecoderConfig) (*Decoder, error) {
 	return result, nil
 }
 
+// Clone returns a new Decoder with the same configuration as d that
+// decodes into result instead. Metadata isn't safe to share between
+// decoders that are used concurrently, so the clone doesn't collect any.
+func (d *Decoder) Clone(result interface{}) (*Decoder, error) {
+	if err := checkResult(result); err != nil {
+		return nil, err
+	}
+
+	config := d.config.Clone()
+	config.Result = result
+	config.Metadata = nil
+
+	return &Decoder{config: config}, nil
+}
+
+// Reset makes d decode into result from now on, keeping the rest of its
+// configuration, so that a Decoder can be reused without building a new
+// one. Metadata, if d collects any, is cleared. Unlike Clone, Reset
+// changes d itself, so it must not be called while d is decoding.
+func (d *Decoder) Reset(result interface{}) error {
+	if err := checkResult(result); err != nil {
+		return err
+	}
+
+	d.config.Result = result
+	if md := d.config.Metadata; md != nil {
+		md.Keys = make([]string, 0)
+		md.Unused = make([]string, 0)
+		md.Unset = make([]string, 0)
+		md.Coercions = make([]string, 0)
+	}
+
+	return nil
+}
+
 // Decode decodes the given raw interface to the target pointer specified
 // by the configuration.
+//
+// Metadata from each call is appended to what has already been collected;
+// use DecodeMerge to combine the metadata of several inputs.
 func (d *Decoder) Decode(input interface{}) error {
-	return d.decode("", input, reflect.ValueOf(d.config.Result).Elem())
+	if d.config.PreprocessInput != nil {
+		var err error
+		input, err = d.config.PreprocessInput(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.config.RootKey != "" {
+		var err error
+		input, err = lookupRootKey(input, d.config.RootKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := d.decode("", 0, input, reflect.ValueOf(d.config.Result).Elem()); err != nil {
+		return mergeUnusedKeysErrors(err)
+	}
+
+	if d.config.Validate != nil {
+		return d.config.Validate(d.config.Result)
+	}
+
+	return nil
+}
+
+// DecodeMerge decodes input like Decode, for layering several inputs onto
+// the same result. Metadata is accumulated across calls rather than
+// describing only the last input: Keys and Unused hold each key once, and
+// Unset only keeps fields that none of the inputs have set so far.
+func (d *Decoder) DecodeMerge(input interface{}) error {
+	err := d.Decode(input)
+	if md := d.config.Metadata; md != nil {
+		md.Keys = uniqueStrings(md.Keys, nil)
+		md.Unused = uniqueStrings(md.Unused, nil)
+
+		set := make(map[string]struct{}, len(md.Keys))
+		for _, k := range md.Keys {
+			set[k] = struct{}{}
+		}
+		md.Unset = uniqueStrings(md.Unset, set)
+	}
+
+	return err
+}
+
+// lookupRootKey returns the value of key in the map input.
+func lookupRootKey(input interface{}, key string) (interface{}, error) {
+	dataVal := reflect.Indirect(reflect.ValueOf(input))
+	if dataVal.Kind() != reflect.Map {
+		return nil, fmt.Errorf("expected a map with root key '%s', got '%s'", key, dataVal.Kind())
+	}
+
+	for _, k := range dataVal.MapKeys() {
+		if k.Kind() == reflect.Interface {
+			k = k.Elem()
+		}
+		if k.Kind() == reflect.String && k.String() == key {
+			return dataVal.MapIndex(k).Interface(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("root key '%s' not found in input", key)
+}
+
+// uniqueStrings removes duplicates and any strings in skip from s in
+// place, keeping the first occurrence of each.
+func uniqueStrings(s []string, skip map[string]struct{}) []string {
+	seen := make(map[string]struct{}, len(s))
+	result := s[:0]
+	for _, v := range s {
+		if _, ok := skip[v]; ok {
+			continue
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+
+	return result
 }
 
-// Decodes an unknown data type into a specific reflection value.
-func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) error {
+// checkResult verifies that result can be decoded into.
+func checkResult(result interface{}) error {
+	val := reflect.ValueOf(result)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("result must be a pointer")
+	}
+
+	val = val.Elem()
+	if !val.CanAddr() {
+		return errors.New("result must be addressable (a pointer)")
+	}
+
+	return nil
+}
+
+// Decodes an unknown data type into a specific reflection value. depth is
+// the number of nested structs, maps, slices and arrays above outVal.
+func (d *Decoder) decode(name string, depth int, input interface{}, outVal reflect.Value) error {
+	return d.decodeValue(name, depth, input, outVal, reflect.Value{}, true)
+}
+
+// decodeValue is decode, except that hooks are passed hookTo as the target
+// instead of outVal if it is valid, and EncodeHook is only run on a struct
+// decoded into a map if encodeHook is true. decodeMapFromMap uses hookTo
+// to show hooks the existing map entry, and decodeMapFromStruct turns off
+// encodeHook for struct fields it has already passed through EncodeHook.
+func (d *Decoder) decodeValue(name string, depth int, input interface{}, outVal reflect.Value, hookTo reflect.Value, encodeHook bool) error {
+	if d.config.MaxDepth > 0 && depth > d.config.MaxDepth {
+		return newDecodeError(name,
+			fmt.Errorf("maximum decode depth %d exceeded", d.config.MaxDepth))
+	}
+
 	var inputVal reflect.Value
 	if input != nil {
 		inputVal = reflect.ValueOf(input)
@@ -432,8 +956,8 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 
 	if input == nil {
 		// If the data is nil, then we don't set anything, unless ZeroFields is set
-		// to true.
-		if d.config.ZeroFields {
+		// to true or DecodeNil is set and the target can be nil.
+		if d.config.ZeroFields || (d.config.DecodeNil && isNillable(outVal)) {
 			outVal.Set(reflect.Zero(outVal.Type()))
 
 			if d.config.Metadata != nil && name != "" {
@@ -453,13 +977,52 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 		return nil
 	}
 
-	if d.config.DecodeHook != nil {
+	encoding := d.config.EncodeHook != nil && getKind(outVal) == reflect.Map &&
+		reflect.Indirect(inputVal).Kind() == reflect.Struct
+
+	hook := d.config.DecodeHook
+	if len(d.config.TypeHooks) > 0 {
+		if typeHook, ok := d.config.TypeHooks[outVal.Type()]; ok {
+			hook = typeHook
+		}
+	}
+	if encoding {
+		hook = nil
+		if encodeHook {
+			hook = d.config.EncodeHook
+		}
+	}
+
+	if hook != nil {
 		// We have a DecodeHook, so let's pre-process the input.
+		if !hookTo.IsValid() {
+			hookTo = outVal
+		}
+
 		var err error
-		input, err = DecodeHookExec(d.config.DecodeHook, inputVal, outVal)
+		input, err = decodeHookExec(hook, inputVal, hookTo, name, depth)
 		if err != nil {
-			return fmt.Errorf("error decoding '%s': %w", name, err)
+			return newDecodeError(name, err)
+		}
+	}
+
+	if d.config.EmptyStringAsNil && isEmptyString(input) {
+		switch outVal.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice:
+			outVal.Set(reflect.Zero(outVal.Type()))
+			if d.config.Metadata != nil && name != "" {
+				d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
+			}
+			return nil
+		}
+	}
+
+	if om, ok := orderedMapTarget(outVal); ok {
+		err := d.decodeOrderedMap(name, input, om)
+		if d.config.Metadata != nil && name != "" {
+			d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
 		}
+		return err
 	}
 
 	var err error
@@ -469,7 +1032,7 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 	case reflect.Bool:
 		err = d.decodeBool(name, input, outVal)
 	case reflect.Interface:
-		err = d.decodeBasic(name, input, outVal)
+		err = d.decodeBasic(name, depth, input, outVal)
 	case reflect.String:
 		err = d.decodeString(name, input, outVal)
 	case reflect.Int:
@@ -478,21 +1041,24 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 		err = d.decodeUint(name, input, outVal)
 	case reflect.Float32:
 		err = d.decodeFloat(name, input, outVal)
+	case reflect.Complex64:
+		err = d.decodeComplex(name, input, outVal)
 	case reflect.Struct:
-		err = d.decodeStruct(name, input, outVal)
+		err = d.decodeStruct(name, depth, input, outVal)
 	case reflect.Map:
-		err = d.decodeMap(name, input, outVal)
+		err = d.decodeMap(name, depth, input, outVal)
 	case reflect.Ptr:
-		addMetaKey, err = d.decodePtr(name, input, outVal)
+		addMetaKey, err = d.decodePtr(name, depth, input, outVal)
 	case reflect.Slice:
-		err = d.decodeSlice(name, input, outVal)
+		err = d.decodeSlice(name, depth, input, outVal)
 	case reflect.Array:
-		err = d.decodeArray(name, input, outVal)
-	case reflect.Func:
+		err = d.decodeArray(name, depth, input, outVal)
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
 		err = d.decodeFunc(name, input, outVal)
 	default:
 		// If we reached this point then we weren't able to decode it
-		return fmt.Errorf("%s: unsupported type: %s", name, outputKind)
+		return newDecodeError(name, fmt.Errorf(
+			"cannot decode into unsupported type %s", outVal.Type()))
 	}
 
 	// If we reached here, then we successfully decoded SOMETHING, so
@@ -506,7 +1072,15 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 
 // This decodes a basic type (bool, int, string, etc.) and sets the
 // value to "data" of that type.
-func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value) error {
+func (d *Decoder) decodeBasic(name string, depth int, data interface{}, val reflect.Value) error {
+	if d.config.TypeResolver != nil {
+		if m, ok := data.(map[string]interface{}); ok {
+			if typ, ok := d.config.TypeResolver(m); ok {
+				return d.decodeResolved(name, depth, m, typ, val)
+			}
+		}
+	}
+
 	if val.IsValid() && val.Elem().IsValid() {
 		elem := val.Elem()
 
@@ -529,7 +1103,7 @@ func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value)
 
 		// Decode. If we have an error then return. We also return right
 		// away if we're not a copy because that means we decoded directly.
-		if err := d.decode(name, data, elem); err != nil || !copied {
+		if err := d.decode(name, depth, data, elem); err != nil || !copied {
 			return err
 		}
 
@@ -538,6 +1112,13 @@ func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value)
 		return nil
 	}
 
+	if typ, ok := d.config.DefaultInterfaceTypes[val.Type()]; ok {
+		switch getKind(reflect.Indirect(reflect.ValueOf(data))) {
+		case reflect.Map, reflect.Struct:
+			return d.decodeResolved(name, depth, data, typ, val)
+		}
+	}
+
 	dataVal := reflect.ValueOf(data)
 
 	// If the input data is a pointer, and the assigned type is the dereference
@@ -553,37 +1134,65 @@ func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value)
 
 	dataValType := dataVal.Type()
 	if !dataValType.AssignableTo(val.Type()) {
-		return fmt.Errorf(
-			"'%s' expected type '%s', got '%s'",
-			name, val.Type(), dataValType)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got '%s'",
+			val.Type(), dataValType))
 	}
 
 	val.Set(dataVal)
 	return nil
 }
 
+// decodeResolved decodes data into a new value of the type picked by the
+// TypeResolver or DefaultInterfaceTypes and assigns it to the interface val.
+func (d *Decoder) decodeResolved(name string, depth int, data interface{}, typ reflect.Type, val reflect.Value) error {
+	if !typ.AssignableTo(val.Type()) {
+		return newDecodeError(name,
+			fmt.Errorf("resolved type '%s' is not assignable to '%s'", typ, val.Type()))
+	}
+
+	resolved := reflect.New(typ).Elem()
+	if err := d.decode(name, depth, data, resolved); err != nil {
+		return err
+	}
+
+	val.Set(resolved)
+	return nil
+}
+
 func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	dataKind := getKind(dataVal)
 
-	converted := true
+	converted, coerced := true, false
 	switch {
 	case dataKind == reflect.String:
 		val.SetString(dataVal.String())
+	case val.Type() == jsonNumberType && dataKind == reflect.Int:
+		val.SetString(strconv.FormatInt(dataVal.Int(), 10))
+	case val.Type() == jsonNumberType && dataKind == reflect.Uint:
+		val.SetString(strconv.FormatUint(dataVal.Uint(), 10))
+	case val.Type() == jsonNumberType && dataKind == reflect.Float32:
+		val.SetString(strconv.FormatFloat(dataVal.Float(), 'g', -1, dataVal.Type().Bits()))
 	case dataKind == reflect.Bool && d.config.WeaklyTypedInput:
+		coerced = true
 		if dataVal.Bool() {
 			val.SetString("1")
 		} else {
 			val.SetString("0")
 		}
 	case dataKind == reflect.Int && d.config.WeaklyTypedInput:
+		coerced = true
 		val.SetString(strconv.FormatInt(dataVal.Int(), 10))
 	case dataKind == reflect.Uint && d.config.WeaklyTypedInput:
+		coerced = true
 		val.SetString(strconv.FormatUint(dataVal.Uint(), 10))
 	case dataKind == reflect.Float32 && d.config.WeaklyTypedInput:
+		coerced = true
 		val.SetString(strconv.FormatFloat(dataVal.Float(), 'f', -1, 64))
 	case dataKind == reflect.Slice && d.config.WeaklyTypedInput,
 		dataKind == reflect.Array && d.config.WeaklyTypedInput:
+		coerced = true
 		dataType := dataVal.Type()
 		elemKind := dataType.Elem().Kind()
 		switch elemKind {
@@ -606,9 +1215,17 @@ func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value)
 	}
 
 	if !converted {
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if coerced {
+		d.recordCoercion(name, dataVal, val)
+	}
+
+	if d.config.TrimStrings {
+		val.SetString(strings.TrimSpace(val.String()))
 	}
 
 	return nil
@@ -619,20 +1236,60 @@ func (d *Decoder) decodeInt(name string, data interface{}, val reflect.Value) er
 	dataKind := getKind(dataVal)
 	dataType := dataVal.Type()
 
+	// With WeaklyTypedInput, a json.Number that can't be parsed as a
+	// number, such as "" or "0x10", is parsed like any other string.
+	jsonNumber := dataType == jsonNumberType
+	if jsonNumber && d.config.WeaklyTypedInput {
+		_, err := json.Number(dataVal.String()).Int64()
+		jsonNumber = err == nil || errors.Is(err, strconv.ErrRange)
+	}
+
+	coerced := false
 	switch {
+	case jsonNumber:
+		i, err := json.Number(dataVal.String()).Int64()
+		if errors.Is(err, strconv.ErrRange) {
+			return newDecodeError(name, overflowError(dataVal.String(), val.Type()))
+		}
+		if err != nil {
+			return newDecodeError(name,
+				fmt.Errorf("error decoding json.Number: %w", err))
+		}
+		if val.OverflowInt(i) {
+			return newDecodeError(name, overflowError(dataVal.String(), val.Type()))
+		}
+		val.SetInt(i)
 	case dataKind == reflect.Int:
-		val.SetInt(dataVal.Int())
+		i := dataVal.Int()
+		if val.OverflowInt(i) {
+			return newDecodeError(name, overflowError(strconv.FormatInt(i, 10), val.Type()))
+		}
+		val.SetInt(i)
 	case dataKind == reflect.Uint:
-		val.SetInt(int64(dataVal.Uint()))
+		u := dataVal.Uint()
+		if u > math.MaxInt64 || val.OverflowInt(int64(u)) {
+			return newDecodeError(name, overflowError(strconv.FormatUint(u, 10), val.Type()))
+		}
+		val.SetInt(int64(u))
 	case dataKind == reflect.Float32:
-		val.SetInt(int64(dataVal.Float()))
-	case dataKind == reflect.Bool && d.config.WeaklyTypedInput:
+		f := dataVal.Float()
+		if f < math.MinInt64 || f >= math.MaxInt64 || val.OverflowInt(int64(f)) {
+			return newDecodeError(name, overflowError(strconv.FormatFloat(f, 'g', -1, 64), val.Type()))
+		}
+		coerced = f != math.Trunc(f)
+		if coerced && d.config.ErrorOnLossyNumericConversion {
+			return newDecodeError(name, lossyError(strconv.FormatFloat(f, 'g', -1, 64), val.Type()))
+		}
+		val.SetInt(int64(f))
+	case dataKind == reflect.Bool && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		if dataVal.Bool() {
 			val.SetInt(1)
 		} else {
 			val.SetInt(0)
 		}
 	case dataKind == reflect.String && d.config.WeaklyTypedInput:
+		coerced = true
 		str := dataVal.String()
 		if str == "" {
 			str = "0"
@@ -641,21 +1298,19 @@ func (d *Decoder) decodeInt(name string, data interface{}, val reflect.Value) er
 		i, err := strconv.ParseInt(str, 0, val.Type().Bits())
 		if err == nil {
 			val.SetInt(i)
+		} else if errors.Is(err, strconv.ErrRange) {
+			return newDecodeError(name, overflowError(strconv.Quote(str), val.Type()))
 		} else {
-			return fmt.Errorf("cannot parse '%s' as int: %s", name, err)
-		}
-	case dataType.PkgPath() == "encoding/json" && dataType.Name() == "Number":
-		jn := data.(json.Number)
-		i, err := jn.Int64()
-		if err != nil {
-			return fmt.Errorf(
-				"error decoding json.Number into %s: %s", name, err)
+			return newDecodeError(name, fmt.Errorf("cannot parse as int: %w", err))
 		}
-		val.SetInt(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if coerced {
+		d.recordCoercion(name, dataVal, val)
 	}
 
 	return nil
@@ -666,30 +1321,71 @@ func (d *Decoder) decodeUint(name string, data interface{}, val reflect.Value) e
 	dataKind := getKind(dataVal)
 	dataType := dataVal.Type()
 
+	// With WeaklyTypedInput, a json.Number that can't be parsed as a
+	// number, such as "" or "0x10", is parsed like any other string.
+	jsonNumber := dataType == jsonNumberType
+	if jsonNumber && d.config.WeaklyTypedInput {
+		_, err := strconv.ParseUint(dataVal.String(), 0, val.Type().Bits())
+		jsonNumber = err == nil || errors.Is(err, strconv.ErrRange)
+	}
+
+	coerced := false
 	switch {
+	case jsonNumber:
+		i, err := strconv.ParseUint(dataVal.String(), 0, val.Type().Bits())
+		if err != nil {
+			if isNegativeNumber(dataVal.String()) {
+				return newDecodeError(name,
+					fmt.Errorf("%s overflows %s", dataVal.String(), val.Type()))
+			}
+			if errors.Is(err, strconv.ErrRange) {
+				return newDecodeError(name, overflowError(dataVal.String(), val.Type()))
+			}
+			return newDecodeError(name,
+				fmt.Errorf("error decoding json.Number: %w", err))
+		}
+		val.SetUint(i)
 	case dataKind == reflect.Int:
+		// Negative numbers are an error even with WeaklyTypedInput, since
+		// there is no sensible unsigned value for them.
 		i := dataVal.Int()
-		if i < 0 && !d.config.WeaklyTypedInput {
-			return fmt.Errorf("cannot parse '%s', %d overflows uint",
-				name, i)
+		if i < 0 {
+			return newDecodeError(name,
+				fmt.Errorf("%d overflows %s", i, val.Type()))
+		}
+		if val.OverflowUint(uint64(i)) {
+			return newDecodeError(name, overflowError(strconv.FormatInt(i, 10), val.Type()))
 		}
 		val.SetUint(uint64(i))
 	case dataKind == reflect.Uint:
-		val.SetUint(dataVal.Uint())
+		u := dataVal.Uint()
+		if val.OverflowUint(u) {
+			return newDecodeError(name, overflowError(strconv.FormatUint(u, 10), val.Type()))
+		}
+		val.SetUint(u)
 	case dataKind == reflect.Float32:
 		f := dataVal.Float()
-		if f < 0 && !d.config.WeaklyTypedInput {
-			return fmt.Errorf("cannot parse '%s', %f overflows uint",
-				name, f)
+		if f < 0 {
+			return newDecodeError(name,
+				fmt.Errorf("%f overflows %s", f, val.Type()))
+		}
+		if f >= math.MaxUint64 || val.OverflowUint(uint64(f)) {
+			return newDecodeError(name, overflowError(strconv.FormatFloat(f, 'g', -1, 64), val.Type()))
+		}
+		coerced = f != math.Trunc(f)
+		if f != math.Trunc(f) && d.config.ErrorOnLossyNumericConversion {
+			return newDecodeError(name, lossyError(strconv.FormatFloat(f, 'g', -1, 64), val.Type()))
 		}
 		val.SetUint(uint64(f))
-	case dataKind == reflect.Bool && d.config.WeaklyTypedInput:
+	case dataKind == reflect.Bool && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		if dataVal.Bool() {
 			val.SetUint(1)
 		} else {
 			val.SetUint(0)
 		}
 	case dataKind == reflect.String && d.config.WeaklyTypedInput:
+		coerced = true
 		str := dataVal.String()
 		if str == "" {
 			str = "0"
@@ -698,21 +1394,21 @@ func (d *Decoder) decodeUint(name string, data interface{}, val reflect.Value) e
 		i, err := strconv.ParseUint(str, 0, val.Type().Bits())
 		if err == nil {
 			val.SetUint(i)
+		} else if isNegativeNumber(str) {
+			return newDecodeError(name, fmt.Errorf("%s overflows %s", str, val.Type()))
+		} else if errors.Is(err, strconv.ErrRange) {
+			return newDecodeError(name, overflowError(strconv.Quote(str), val.Type()))
 		} else {
-			return fmt.Errorf("cannot parse '%s' as uint: %s", name, err)
+			return newDecodeError(name, fmt.Errorf("cannot parse as uint: %w", err))
 		}
-	case dataType.PkgPath() == "encoding/json" && dataType.Name() == "Number":
-		jn := data.(json.Number)
-		i, err := strconv.ParseUint(string(jn), 0, 64)
-		if err != nil {
-			return fmt.Errorf(
-				"error decoding json.Number into %s: %s", name, err)
-		}
-		val.SetUint(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if coerced {
+		d.recordCoercion(name, dataVal, val)
 	}
 
 	return nil
@@ -722,30 +1418,67 @@ func (d *Decoder) decodeBool(name string, data interface{}, val reflect.Value) e
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	dataKind := getKind(dataVal)
 
+	coerced := false
 	switch {
 	case dataKind == reflect.Bool:
 		val.SetBool(dataVal.Bool())
-	case dataKind == reflect.Int && d.config.WeaklyTypedInput:
+	case dataKind == reflect.Int && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		val.SetBool(dataVal.Int() != 0)
-	case dataKind == reflect.Uint && d.config.WeaklyTypedInput:
+	case dataKind == reflect.Uint && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		val.SetBool(dataVal.Uint() != 0)
-	case dataKind == reflect.Float32 && d.config.WeaklyTypedInput:
+	case dataKind == reflect.Float32 && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		val.SetBool(dataVal.Float() != 0)
 	case dataKind == reflect.String && d.config.WeaklyTypedInput:
+		coerced = true
 		b, err := strconv.ParseBool(dataVal.String())
 		if err == nil {
 			val.SetBool(b)
 		} else if dataVal.String() == "" {
 			val.SetBool(false)
 		} else {
-			return fmt.Errorf("cannot parse '%s' as bool: %s", name, err)
+			return newDecodeError(name, fmt.Errorf("cannot parse as bool: %w", err))
 		}
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if coerced {
+		d.recordCoercion(name, dataVal, val)
+	}
+
+	return nil
+}
+
+func (d *Decoder) decodeComplex(name string, data interface{}, val reflect.Value) error {
+	dataVal := reflect.Indirect(reflect.ValueOf(data))
+	dataKind := getKind(dataVal)
+
+	var c complex128
+	switch dataKind {
+	case reflect.Complex64:
+		c = dataVal.Complex()
+	case reflect.Int:
+		c = complex(float64(dataVal.Int()), 0)
+	case reflect.Uint:
+		c = complex(float64(dataVal.Uint()), 0)
+	case reflect.Float32:
+		c = complex(dataVal.Float(), 0)
+	default:
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if val.OverflowComplex(c) {
+		return newDecodeError(name, fmt.Errorf("value %v overflows %s", c, val.Type()))
 	}
 
+	val.SetComplex(c)
 	return nil
 }
 
@@ -754,20 +1487,48 @@ func (d *Decoder) decodeFloat(name string, data interface{}, val reflect.Value)
 	dataKind := getKind(dataVal)
 	dataType := dataVal.Type()
 
+	// With WeaklyTypedInput, a json.Number that can't be parsed as a
+	// number, such as "" or "0x10", is parsed like any other string.
+	jsonNumber := dataType == jsonNumberType
+	if jsonNumber && d.config.WeaklyTypedInput {
+		_, err := json.Number(dataVal.String()).Float64()
+		jsonNumber = err == nil || errors.Is(err, strconv.ErrRange)
+	}
+
+	coerced := false
 	switch {
+	case jsonNumber:
+		f, err := json.Number(dataVal.String()).Float64()
+		if err != nil {
+			return newDecodeError(name,
+				fmt.Errorf("error decoding json.Number: %w", err))
+		}
+		val.SetFloat(f)
 	case dataKind == reflect.Int:
-		val.SetFloat(float64(dataVal.Int()))
+		i := dataVal.Int()
+		f := roundFloat(float64(i), val.Type())
+		if d.config.ErrorOnLossyNumericConversion && (f >= math.MaxInt64 || int64(f) != i) {
+			return newDecodeError(name, lossyError(strconv.FormatInt(i, 10), val.Type()))
+		}
+		val.SetFloat(f)
 	case dataKind == reflect.Uint:
-		val.SetFloat(float64(dataVal.Uint()))
+		u := dataVal.Uint()
+		f := roundFloat(float64(u), val.Type())
+		if d.config.ErrorOnLossyNumericConversion && (f >= math.MaxUint64 || uint64(f) != u) {
+			return newDecodeError(name, lossyError(strconv.FormatUint(u, 10), val.Type()))
+		}
+		val.SetFloat(f)
 	case dataKind == reflect.Float32:
 		val.SetFloat(dataVal.Float())
-	case dataKind == reflect.Bool && d.config.WeaklyTypedInput:
+	case dataKind == reflect.Bool && d.config.WeaklyTypedInput && !d.config.DisallowBoolNumericCoercion:
+		coerced = true
 		if dataVal.Bool() {
 			val.SetFloat(1)
 		} else {
 			val.SetFloat(0)
 		}
 	case dataKind == reflect.String && d.config.WeaklyTypedInput:
+		coerced = true
 		str := dataVal.String()
 		if str == "" {
 			str = "0"
@@ -777,62 +1538,107 @@ func (d *Decoder) decodeFloat(name string, data interface{}, val reflect.Value)
 		if err == nil {
 			val.SetFloat(f)
 		} else {
-			return fmt.Errorf("cannot parse '%s' as float: %s", name, err)
+			return newDecodeError(name, fmt.Errorf("cannot parse as float: %w", err))
 		}
-	case dataType.PkgPath() == "encoding/json" && dataType.Name() == "Number":
-		jn := data.(json.Number)
-		i, err := jn.Float64()
-		if err != nil {
-			return fmt.Errorf(
-				"error decoding json.Number into %s: %s", name, err)
-		}
-		val.SetFloat(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"expected type '%s', got unconvertible type '%s', value: '%v'",
+			val.Type(), dataVal.Type(), data))
+	}
+
+	if coerced {
+		d.recordCoercion(name, dataVal, val)
 	}
 
 	return nil
 }
 
-func (d *Decoder) decodeMap(name string, data interface{}, val reflect.Value) error {
-	valType := val.Type()
-	valKeyType := valType.Key()
-	valElemType := valType.Elem()
-
-	// By default we overwrite keys in the current map
-	valMap := val
-
-	// If the map is nil or we're purposely zeroing fields, make a new map
-	if valMap.IsNil() || d.config.ZeroFields {
-		// Make a new map to hold our result
-		mapType := reflect.MapOf(valKeyType, valElemType)
-		valMap = reflect.MakeMap(mapType)
+// orderedMapTarget returns val as an OrderedMap if a pointer to it
+// implements the interface. Pointer and interface values are left to
+// decodePtr and decodeBasic so that decoding reaches the value they hold.
+func orderedMapTarget(val reflect.Value) (OrderedMap, bool) {
+	if val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface || !val.CanAddr() {
+		return nil, false
 	}
 
-	// Check input type and based on the input type jump to the proper func
+	om, ok := val.Addr().Interface().(OrderedMap)
+	return om, ok
+}
+
+func (d *Decoder) decodeOrderedMap(name string, data interface{}, om OrderedMap) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	switch dataVal.Kind() {
 	case reflect.Map:
-		return d.decodeMapFromMap(name, dataVal, val, valMap)
-
-	case reflect.Struct:
-		return d.decodeMapFromStruct(name, dataVal, val, valMap)
+		keys := dataVal.MapKeys()
+		sortMapKeys(keys)
+		for _, k := range keys {
+			om.Set(k.Interface(), dataVal.MapIndex(k).Interface())
+		}
+		return nil
 
 	case reflect.Array, reflect.Slice:
-		if d.config.WeaklyTypedInput {
-			return d.decodeMapFromSlice(name, dataVal, val, valMap)
+		for i := 0; i < dataVal.Len(); i++ {
+			item := reflect.Indirect(dataVal.Index(i))
+			if item.Kind() == reflect.Interface {
+				item = reflect.Indirect(item.Elem())
+			}
+
+			var key, value reflect.Value
+			if item.Kind() == reflect.Struct {
+				key = item.FieldByName("Key")
+				value = item.FieldByName("Value")
+			}
+			if !key.IsValid() || !value.IsValid() {
+				return newDecodeError(name+"["+strconv.Itoa(i)+"]",
+					fmt.Errorf("expected a struct with Key and Value fields, got '%s'", item.Kind()))
+			}
+
+			om.Set(key.Interface(), value.Interface())
+		}
+		return nil
+
+	default:
+		return newDecodeError(name, fmt.Errorf("expected a map, got '%s'", dataVal.Kind()))
+	}
+}
+
+func (d *Decoder) decodeMap(name string, depth int, data interface{}, val reflect.Value) error {
+	valType := val.Type()
+	valKeyType := valType.Key()
+	valElemType := valType.Elem()
+
+	// By default we overwrite keys in the current map
+	valMap := val
+
+	// If the map is nil or we're purposely zeroing fields, make a new map
+	if valMap.IsNil() || d.config.ZeroFields {
+		// Make a new map to hold our result
+		mapType := reflect.MapOf(valKeyType, valElemType)
+		valMap = reflect.MakeMap(mapType)
+	}
+
+	// Check input type and based on the input type jump to the proper func
+	dataVal := reflect.Indirect(reflect.ValueOf(data))
+	switch dataVal.Kind() {
+	case reflect.Map:
+		return d.decodeMapFromMap(name, depth, dataVal, val, valMap)
+
+	case reflect.Struct:
+		return d.decodeMapFromStruct(name, depth, dataVal, val, valMap)
+
+	case reflect.Array, reflect.Slice:
+		if d.config.WeaklyTypedInput {
+			return d.decodeMapFromSlice(name, depth, dataVal, val, valMap)
 		}
 
 		fallthrough
 
 	default:
-		return fmt.Errorf("'%s' expected a map, got '%s'", name, dataVal.Kind())
+		return newDecodeError(name, fmt.Errorf("expected a map, got '%s'", dataVal.Kind()))
 	}
 }
 
-func (d *Decoder) decodeMapFromSlice(name string, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
+func (d *Decoder) decodeMapFromSlice(name string, depth int, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
 	// Special case for BC reasons (covered by tests)
 	if dataVal.Len() == 0 {
 		val.Set(valMap)
@@ -841,7 +1647,7 @@ func (d *Decoder) decodeMapFromSlice(name string, dataVal reflect.Value, val ref
 
 	for i := 0; i < dataVal.Len(); i++ {
 		err := d.decode(
-			name+"["+strconv.Itoa(i)+"]",
+			name+"["+strconv.Itoa(i)+"]", depth+1,
 			dataVal.Index(i).Interface(), val)
 		if err != nil {
 			return err
@@ -851,13 +1657,13 @@ func (d *Decoder) decodeMapFromSlice(name string, dataVal reflect.Value, val ref
 	return nil
 }
 
-func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
+func (d *Decoder) decodeMapFromMap(name string, depth int, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
 	valType := val.Type()
 	valKeyType := valType.Key()
 	valElemType := valType.Elem()
 
 	// Accumulate errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	// If the input data is empty, then we just match what the input data is.
 	if dataVal.Len() == 0 {
@@ -873,20 +1679,32 @@ func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val refle
 		return nil
 	}
 
-	for _, k := range dataVal.MapKeys() {
-		fieldName := name + "[" + k.String() + "]"
+	keys := dataVal.MapKeys()
+	if d.config.SortMapKeys {
+		sortMapKeys(keys)
+	}
+
+	for _, k := range keys {
+		fieldName := fmt.Sprintf("%s[%v]", name, k)
 
 		// First decode the key into the proper type
 		currentKey := reflect.Indirect(reflect.New(valKeyType))
-		if err := d.decode(fieldName, k.Interface(), currentKey); err != nil {
-			errors = appendErrors(errors, err)
+		if err := d.decodeMapKey(fieldName, depth+1, k, currentKey); err != nil {
+			errors = appendErrors(errors, newDecodeError(fieldName,
+				fmt.Errorf("cannot convert key %v to %s: %w", k, valKeyType, trimErrorPath(err, fieldName))))
 			continue
 		}
 
-		// Next decode the data into the proper type
+		// Next decode the data into the proper type. Hooks see the
+		// current entry, but the entry itself is replaced.
 		v := dataVal.MapIndex(k).Interface()
 		currentVal := reflect.Indirect(reflect.New(valElemType))
-		if err := d.decode(fieldName, v, currentVal); err != nil {
+		var existing reflect.Value
+		if current := valMap.MapIndex(currentKey); current.IsValid() {
+			existing = reflect.Indirect(reflect.New(valElemType))
+			existing.Set(current)
+		}
+		if err := d.decodeValue(fieldName, depth+1, v, currentVal, existing, true); err != nil {
 			errors = appendErrors(errors, err)
 			continue
 		}
@@ -899,13 +1717,104 @@ func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val refle
 
 	// If we had errors, return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
 }
 
-func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
+// decodeMapKey decodes the map key k into key. Formats such as JSON only
+// have string keys, so string keys are parsed into bool and numeric keys,
+// and bool and numeric keys are formatted into string keys. Conversions
+// that would lose information, such as from "" or 1.5 to an int, are an
+// error. Other keys are decoded like any other value.
+func (d *Decoder) decodeMapKey(name string, depth int, k reflect.Value, key reflect.Value) error {
+	if k.Kind() == reflect.Interface {
+		k = k.Elem()
+	}
+
+	keyKind := getKind(key)
+	switch getKind(k) {
+	case reflect.String:
+		var err error
+		s := k.String()
+		switch keyKind {
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(s); err == nil {
+				key.SetBool(b)
+				return nil
+			}
+		case reflect.Int:
+			var i int64
+			if i, err = strconv.ParseInt(s, 10, key.Type().Bits()); err == nil {
+				key.SetInt(i)
+				return nil
+			}
+		case reflect.Uint:
+			var u uint64
+			if u, err = strconv.ParseUint(s, 10, key.Type().Bits()); err == nil {
+				key.SetUint(u)
+				return nil
+			}
+		case reflect.Float32:
+			var f float64
+			if f, err = strconv.ParseFloat(s, key.Type().Bits()); err == nil {
+				key.SetFloat(f)
+				return nil
+			}
+		default:
+			return d.decode(name, depth, k.Interface(), key)
+		}
+
+		// Hooks may still know how to convert the key, such as "5s" to
+		// a time.Duration.
+		if s != "" && d.decode(name, depth, k.Interface(), key) == nil {
+			return nil
+		}
+		return fmt.Errorf("cannot parse as %s: %w", key.Type(), err)
+	case reflect.Bool:
+		if keyKind == reflect.String {
+			key.SetString(strconv.FormatBool(k.Bool()))
+			return nil
+		}
+	case reflect.Int:
+		if keyKind == reflect.String {
+			key.SetString(strconv.FormatInt(k.Int(), 10))
+			return nil
+		}
+	case reflect.Uint:
+		if keyKind == reflect.String {
+			key.SetString(strconv.FormatUint(k.Uint(), 10))
+			return nil
+		}
+	case reflect.Float32:
+		f := k.Float()
+		switch keyKind {
+		case reflect.String:
+			key.SetString(strconv.FormatFloat(f, 'g', -1, k.Type().Bits()))
+			return nil
+		case reflect.Int, reflect.Uint:
+			if f != math.Trunc(f) {
+				return lossyError(strconv.FormatFloat(f, 'g', -1, 64), key.Type())
+			}
+		}
+	}
+
+	return d.decode(name, depth, k.Interface(), key)
+}
+
+func (d *Decoder) decodeMapFromStruct(name string, depth int, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
+	// The keys are field names, so the map's keys must be able to hold
+	// strings, such as string types or interface{}.
+	if !reflect.TypeOf("").ConvertibleTo(valMap.Type().Key()) {
+		return newDecodeError(name, fmt.Errorf(
+			"cannot decode struct into map with key type %s", valMap.Type().Key()))
+	}
+
+	// Squashed map fields are merged in after all of the other fields.
+	var squashedMaps []reflect.Value
+
 	typ := dataVal.Type()
 	for i := 0; i < typ.NumField(); i++ {
 		// Get the StructField first since this is a cheap operation. If the
@@ -915,14 +1824,11 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 			continue
 		}
 
-		// Next get the actual value of this field and verify it is assignable
-		// to the map value.
+		// Next get the actual value of this field.
 		v := dataVal.Field(i)
-		if !v.Type().AssignableTo(valMap.Type().Elem()) {
-			return fmt.Errorf("cannot assign type '%s' to map value field of type '%s'", v.Type(), valMap.Type().Elem())
-		}
+		vType := v.Type()
 
-		tagValue := f.Tag.Get(d.config.TagName)
+		tagValue := lookupTag(f.Tag, d.config.TagName, d.config.TagNameFallbacks)
 		keyName := f.Name
 
 		if tagValue == "" && d.config.IgnoreUntaggedFields {
@@ -930,7 +1836,9 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 		}
 
 		// If Squash is set in the config, we squash the field down.
-		squash := d.config.Squash && v.Kind() == reflect.Struct && f.Anonymous
+		squash := d.config.Squash && f.Anonymous && (v.Kind() == reflect.Struct ||
+			v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct ||
+			v.Kind() == reflect.Interface && !v.IsNil() && isStructOrStructPtr(v.Elem().Type()))
 
 		v = dereferencePtrToStructIfNeeded(v, d.config.TagName)
 
@@ -944,17 +1852,39 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 				continue
 			}
 
-			// If "squash" is specified in the tag, we squash the field down.
-			squash = squash || strings.Index(tagValue[index+1:], "squash") != -1
+			// If "omitzero" is specified in the tag, it ignores zero values.
+			if tagHasOption(tagValue, "omitzero") && isZeroValue(v) {
+				continue
+			}
+
+			// If "squash" or its alias "inline" is specified in the tag, we
+			// squash the field down.
+			squash = squash || strings.Index(tagValue[index+1:], "squash") != -1 ||
+				tagHasOption(tagValue, "inline")
 			if squash {
+				// An interface is squashed according to its dynamic value,
+				// and squashing a nil interface adds nothing.
+				if v.Kind() == reflect.Interface {
+					if v.IsNil() {
+						continue
+					}
+					v = v.Elem()
+				}
+
 				// When squashing, the embedded type can be a pointer to a struct.
 				if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
 					v = v.Elem()
 				}
 
-				// The final type must be a struct
+				if v.Kind() == reflect.Map {
+					squashedMaps = append(squashedMaps, v)
+					continue
+				}
+
+				// The final type must be a struct or a map
 				if v.Kind() != reflect.Struct {
-					return fmt.Errorf("cannot squash non-struct type '%s'", v.Type())
+					return newDecodeError(name,
+						fmt.Errorf("cannot squash non-struct type '%s'", v.Type()))
 				}
 			}
 			if keyNameTagValue := tagValue[:index]; keyNameTagValue != "" {
@@ -967,6 +1897,42 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 			keyName = tagValue
 		}
 
+		if squash && v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+
+		// Embedded struct pointers squashed by the config have nothing
+		// to contribute when they're nil.
+		if squash && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+
+		if d.config.EncodeHook != nil && !squash {
+			// Give the EncodeHook a chance to convert the field value
+			// before it's stored in the map.
+			data, err := decodeHookExec(
+				d.config.EncodeHook, v, reflect.New(valMap.Type().Elem()).Elem(),
+				joinFieldPath(name, keyName), depth+1)
+			if err != nil {
+				return newDecodeError(joinFieldPath(name, keyName), err)
+			}
+
+			v = reflect.ValueOf(data)
+			if !v.IsValid() {
+				v = reflect.Zero(valMap.Type().Elem())
+			}
+			vType = v.Type()
+		}
+
+		// Verify the value is assignable to the map value.
+		if !vType.AssignableTo(valMap.Type().Elem()) {
+			return newDecodeError(name,
+				fmt.Errorf("cannot assign type '%s' to map value field of type '%s'", vType, valMap.Type().Elem()))
+		}
+
 		switch v.Kind() {
 		// this is an embedded struct, so handle it differently
 		case reflect.Struct:
@@ -986,7 +1952,9 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 			addrVal := reflect.New(vMap.Type())
 			reflect.Indirect(addrVal).Set(vMap)
 
-			err := d.decode(keyName, x.Interface(), reflect.Indirect(addrVal))
+			// The EncodeHook has already seen the field unless it was
+			// squashed, so don't run it a second time.
+			err := d.decodeValue(keyName, depth+1, x.Interface(), reflect.Indirect(addrVal), reflect.Value{}, squash)
 			if err != nil {
 				return err
 			}
@@ -1000,11 +1968,17 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 					valMap.SetMapIndex(k, vMap.MapIndex(k))
 				}
 			} else {
-				valMap.SetMapIndex(reflect.ValueOf(keyName), vMap)
+				valMap.SetMapIndex(reflect.ValueOf(keyName).Convert(valMap.Type().Key()), vMap)
 			}
 
 		default:
-			valMap.SetMapIndex(reflect.ValueOf(keyName), v)
+			valMap.SetMapIndex(reflect.ValueOf(keyName).Convert(valMap.Type().Key()), v)
+		}
+	}
+
+	for _, m := range squashedMaps {
+		if err := d.squashMap(name, m, valMap); err != nil {
+			return err
 		}
 	}
 
@@ -1015,10 +1989,48 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 	return nil
 }
 
-func (d *Decoder) decodePtr(name string, data interface{}, val reflect.Value) (bool, error) {
+// squashMap copies the entries of a squashed map field into valMap. Keys
+// that valMap already has, such as ones set by other fields of the struct,
+// are left as they are.
+func (d *Decoder) squashMap(name string, m reflect.Value, valMap reflect.Value) error {
+	keyType := valMap.Type().Key()
+	elemType := valMap.Type().Elem()
+	if m.Type().Key().Kind() != reflect.String {
+		return newDecodeError(name,
+			fmt.Errorf("cannot squash map with key type '%s'", m.Type().Key()))
+	}
+	if !m.Type().Elem().AssignableTo(elemType) {
+		return newDecodeError(name,
+			fmt.Errorf("cannot assign type '%s' to map value field of type '%s'", m.Type().Elem(), elemType))
+	}
+
+	keys := m.MapKeys()
+	if d.config.SortMapKeys {
+		sortMapKeys(keys)
+	}
+
+	for _, key := range keys {
+		k := key.Convert(keyType)
+		if valMap.MapIndex(k).IsValid() {
+			continue
+		}
+		valMap.SetMapIndex(k, m.MapIndex(key))
+	}
+
+	return nil
+}
+
+func (d *Decoder) decodePtr(name string, depth int, data interface{}, val reflect.Value) (bool, error) {
 	// If the input data is nil, then we want to just set the output
 	// pointer to be nil as well.
 	isNil := data == nil
+	if !isNil {
+		// A typed nil pointer (for example one returned by a decode hook)
+		// is treated the same as an untyped nil.
+		if v := reflect.ValueOf(data); v.Kind() == reflect.Ptr && v.IsNil() {
+			isNil = true
+		}
+	}
 	if !isNil {
 		switch v := reflect.Indirect(reflect.ValueOf(data)); v.Kind() {
 		case reflect.Chan,
@@ -1049,39 +2061,48 @@ func (d *Decoder) decodePtr(name string, data interface{}, val reflect.Value) (b
 			realVal = reflect.New(valElemType)
 		}
 
-		if err := d.decode(name, data, reflect.Indirect(realVal)); err != nil {
+		if err := d.decode(name, depth, data, reflect.Indirect(realVal)); err != nil {
 			return false, err
 		}
 
 		val.Set(realVal)
 	} else {
-		if err := d.decode(name, data, reflect.Indirect(val)); err != nil {
+		if err := d.decode(name, depth, data, reflect.Indirect(val)); err != nil {
 			return false, err
 		}
 	}
 	return false, nil
 }
 
+// decodeFunc decodes into funcs, channels and unsafe pointers. These can't
+// be converted from anything else, so the data must already have the same
+// type, for example because a DecodeHook produced it.
 func (d *Decoder) decodeFunc(name string, data interface{}, val reflect.Value) error {
-	// Create an element of the concrete (non pointer) type and decode
-	// into that. Then set the value of the pointer to this type.
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	if val.Type() != dataVal.Type() {
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return newDecodeError(name, fmt.Errorf(
+			"cannot decode %s into unsupported type %s", dataVal.Type(), val.Type()))
 	}
 	val.Set(dataVal)
 	return nil
 }
 
-func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value) error {
+func (d *Decoder) decodeSlice(name string, depth int, data interface{}, val reflect.Value) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	dataValKind := dataVal.Kind()
 	valType := val.Type()
 	valElemType := valType.Elem()
 	sliceType := reflect.SliceOf(valElemType)
 
+	if d.config.DecodeIndexedMapToArray && dataValKind == reflect.Map &&
+		isIndexedMapKey(dataVal.Type().Key()) {
+		items, err := indexedMapToSlice(name, dataVal, -1)
+		if err != nil {
+			return err
+		}
+		return d.decodeSlice(name, depth, items, val)
+	}
+
 	// If we have a non array/slice type then we first attempt to convert.
 	if dataValKind != reflect.Array && dataValKind != reflect.Slice {
 		if d.config.WeaklyTypedInput {
@@ -1097,21 +2118,21 @@ func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value)
 					return nil
 				}
 				// Create slice of maps of other sizes
-				return d.decodeSlice(name, []interface{}{data}, val)
+				return d.decodeSlice(name, depth, []interface{}{data}, val)
 
 			case dataValKind == reflect.String && valElemType.Kind() == reflect.Uint8:
-				return d.decodeSlice(name, []byte(dataVal.String()), val)
+				return d.decodeSlice(name, depth, []byte(dataVal.String()), val)
 
 			// All other types we try to convert to the slice type
 			// and "lift" it into it. i.e. a string becomes a string slice.
 			default:
 				// Just re-try this function with data as a slice.
-				return d.decodeSlice(name, []interface{}{data}, val)
+				return d.decodeSlice(name, depth, []interface{}{data}, val)
 			}
 		}
 
-		return fmt.Errorf(
-			"'%s': source data must be an array or slice, got %s", name, dataValKind)
+		return newDecodeError(name, fmt.Errorf(
+			"source data must be an array or slice, got %s", dataValKind))
 	}
 
 	// If the input value is nil, then don't allocate since empty != nil
@@ -1125,20 +2146,30 @@ func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value)
 		valSlice = reflect.MakeSlice(sliceType, dataVal.Len(), dataVal.Len())
 	} else if valSlice.Len() > dataVal.Len() {
 		valSlice = valSlice.Slice(0, dataVal.Len())
+	} else if valSlice.Len() < dataVal.Len() {
+		// Grow the slice once up front, keeping the existing elements so
+		// that they are decoded into rather than replaced.
+		grown := reflect.MakeSlice(sliceType, dataVal.Len(), dataVal.Len())
+		reflect.Copy(grown, valSlice)
+		valSlice = grown
 	}
 
 	// Accumulate any errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	for i := 0; i < dataVal.Len(); i++ {
 		currentData := dataVal.Index(i).Interface()
-		for valSlice.Len() <= i {
-			valSlice = reflect.Append(valSlice, reflect.Zero(valElemType))
-		}
 		currentField := valSlice.Index(i)
 
+		// A nil element always leaves a nil pointer, even if an existing
+		// slice had a value at this index.
+		if currentField.Kind() == reflect.Ptr && isNilInput(currentData) {
+			currentField.Set(reflect.Zero(currentField.Type()))
+			continue
+		}
+
 		fieldName := name + "[" + strconv.Itoa(i) + "]"
-		if err := d.decode(fieldName, currentData, currentField); err != nil {
+		if err := d.decode(fieldName, depth+1, currentData, currentField); err != nil {
 			errors = appendErrors(errors, err)
 		}
 	}
@@ -1148,19 +2179,28 @@ func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value)
 
 	// If there were errors, we return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
 }
 
-func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value) error {
+func (d *Decoder) decodeArray(name string, depth int, data interface{}, val reflect.Value) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	dataValKind := dataVal.Kind()
 	valType := val.Type()
 	valElemType := valType.Elem()
 	arrayType := reflect.ArrayOf(valType.Len(), valElemType)
 
+	if d.config.DecodeIndexedMapToArray && dataValKind == reflect.Map &&
+		isIndexedMapKey(dataVal.Type().Key()) {
+		items, err := indexedMapToSlice(name, dataVal, arrayType.Len())
+		if err != nil {
+			return err
+		}
+		return d.decodeArray(name, depth, items, val)
+	}
+
 	valArray := val
 
 	if valArray.Interface() == reflect.Zero(valArray.Type()).Interface() || d.config.ZeroFields {
@@ -1179,17 +2219,12 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 				// and "lift" it into it. i.e. a string becomes a string array.
 				default:
 					// Just re-try this function with data as a slice.
-					return d.decodeArray(name, []interface{}{data}, val)
+					return d.decodeArray(name, depth, []interface{}{data}, val)
 				}
 			}
 
-			return fmt.Errorf(
-				"'%s': source data must be an array or slice, got %s", name, dataValKind)
-
-		}
-		if dataVal.Len() > arrayType.Len() {
-			return fmt.Errorf(
-				"'%s': expected source data to have length less or equal to %d, got %d", name, arrayType.Len(), dataVal.Len())
+			return newDecodeError(name, fmt.Errorf(
+				"source data must be an array or slice, got %s", dataValKind))
 
 		}
 
@@ -1197,15 +2232,30 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 		valArray = reflect.New(arrayType).Elem()
 	}
 
+	if d.config.ArrayFillExact && dataVal.Len() != arrayType.Len() {
+		return newDecodeError(name, fmt.Errorf(
+			"expected source data to have length %d, got %d", arrayType.Len(), dataVal.Len()))
+	}
+
+	if dataVal.Len() > arrayType.Len() {
+		return newDecodeError(name, fmt.Errorf(
+			"expected source data to have length less or equal to %d, got %d", arrayType.Len(), dataVal.Len()))
+	}
+
 	// Accumulate any errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	for i := 0; i < dataVal.Len(); i++ {
 		currentData := dataVal.Index(i).Interface()
 		currentField := valArray.Index(i)
 
+		if currentField.Kind() == reflect.Ptr && isNilInput(currentData) {
+			currentField.Set(reflect.Zero(currentField.Type()))
+			continue
+		}
+
 		fieldName := name + "[" + strconv.Itoa(i) + "]"
-		if err := d.decode(fieldName, currentData, currentField); err != nil {
+		if err := d.decode(fieldName, depth+1, currentData, currentField); err != nil {
 			errors = appendErrors(errors, err)
 		}
 	}
@@ -1215,13 +2265,17 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 
 	// If there were errors, we return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
 }
 
-func (d *Decoder) decodeStruct(name string, data interface{}, val reflect.Value) error {
+func (d *Decoder) decodeStruct(name string, depth int, data interface{}, val reflect.Value) error {
+	if val.Type() == reflect.TypeOf(sync.Map{}) {
+		return d.decodeSyncMap(name, depth, data, val)
+	}
+
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 
 	// If the type of the value to write to and the data match directly,
@@ -1234,7 +2288,7 @@ func (d *Decoder) decodeStruct(name string, data interface{}, val reflect.Value)
 	dataValKind := dataVal.Kind()
 	switch dataValKind {
 	case reflect.Map:
-		return d.decodeStructFromMap(name, dataVal, val)
+		return d.decodeStructFromMap(name, depth, dataVal, val)
 
 	case reflect.Struct:
 		// Not the most efficient way to do this but we can optimize later if
@@ -1252,24 +2306,132 @@ func (d *Decoder) decodeStruct(name string, data interface{}, val reflect.Value)
 		addrVal := reflect.New(mval.Type())
 
 		reflect.Indirect(addrVal).Set(mval)
-		if err := d.decodeMapFromStruct(name, dataVal, reflect.Indirect(addrVal), mval); err != nil {
+		if err := d.decodeMapFromStruct(name, depth, dataVal, reflect.Indirect(addrVal), mval); err != nil {
 			return err
 		}
 
-		result := d.decodeStructFromMap(name, reflect.Indirect(addrVal), val)
+		result := d.decodeStructFromMap(name, depth, reflect.Indirect(addrVal), val)
 		return result
 
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		if d.config.ScalarToSingleField {
+			if i, ok := singleField(val); ok {
+				fieldName := joinFieldPath(name, val.Type().Field(i).Name)
+				return d.decode(fieldName, depth+1, data, val.Field(i))
+			}
+		}
+		return newDecodeError(name, fmt.Errorf("expected a map, got '%s'", dataVal.Kind()))
+
+	case reflect.Array, reflect.Slice:
+		if d.config.DecodeArrayToStructPositional {
+			return d.decodeStructFromSlice(name, depth, dataVal, val)
+		}
+		fallthrough
+
 	default:
-		return fmt.Errorf("'%s' expected a map, got '%s'", name, dataVal.Kind())
+		return newDecodeError(name, fmt.Errorf("expected a map, got '%s'", dataVal.Kind()))
+	}
+}
+
+func (d *Decoder) decodeStructFromSlice(name string, depth int, dataVal, val reflect.Value) error {
+	var fields []int
+	for i := 0; i < val.NumField(); i++ {
+		if val.Field(i).CanSet() {
+			fields = append(fields, i)
+		}
+	}
+
+	if dataVal.Len() > len(fields) {
+		return newDecodeError(name, fmt.Errorf(
+			"expected at most %d elements for %s, got %d", len(fields), val.Type(), dataVal.Len()))
+	}
+
+	errors := make([]error, 0)
+	for i := 0; i < dataVal.Len(); i++ {
+		fieldName := joinFieldPath(name, val.Type().Field(fields[i]).Name)
+		if err := d.decode(fieldName, depth+1, dataVal.Index(i).Interface(), val.Field(fields[i])); err != nil {
+			errors = appendErrors(errors, err)
+		}
+	}
+
+	if len(errors) > 0 {
+		return newError(errors)
+	}
+
+	return nil
+}
+
+// singleField returns the index of the only field of the struct val that
+// can be set, if there is exactly one.
+func singleField(val reflect.Value) (int, bool) {
+	index := -1
+	for i := 0; i < val.NumField(); i++ {
+		if !val.Field(i).CanSet() {
+			continue
+		}
+		if index != -1 {
+			return -1, false
+		}
+		index = i
+	}
+
+	return index, index != -1
+}
+
+func (d *Decoder) decodeSyncMap(name string, depth int, data interface{}, val reflect.Value) error {
+	if !val.CanAddr() {
+		return newDecodeError(name, errors.New("sync.Map must be addressable"))
+	}
+	syncMap := val.Addr().Interface().(*sync.Map)
+
+	dataVal := reflect.Indirect(reflect.ValueOf(data))
+	if dataVal.Kind() != reflect.Map {
+		return newDecodeError(name, fmt.Errorf("expected a map, got '%s'", dataVal.Kind()))
+	}
+
+	// If we're purposely zeroing fields, empty the map first
+	if d.config.ZeroFields {
+		syncMap.Range(func(key, _ interface{}) bool {
+			syncMap.Delete(key)
+			return true
+		})
+	}
+
+	// Accumulate errors
+	errors := make([]error, 0)
+
+	valElemType := reflect.TypeOf((*interface{})(nil)).Elem()
+	for _, k := range dataVal.MapKeys() {
+		fieldName := name + "[" + fmt.Sprint(k.Interface()) + "]"
+
+		// Decode the data so that hooks are run on it
+		v := dataVal.MapIndex(k).Interface()
+		currentVal := reflect.Indirect(reflect.New(valElemType))
+		if err := d.decode(fieldName, depth+1, v, currentVal); err != nil {
+			errors = appendErrors(errors, err)
+			continue
+		}
+
+		syncMap.Store(k.Interface(), currentVal.Interface())
 	}
+
+	// If we had errors, return those
+	if len(errors) > 0 {
+		return newError(errors)
+	}
+
+	return nil
 }
 
-func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) error {
+func (d *Decoder) decodeStructFromMap(name string, depth int, dataVal, val reflect.Value) error {
 	dataValType := dataVal.Type()
 	if kind := dataValType.Key().Kind(); kind != reflect.String && kind != reflect.Interface {
-		return fmt.Errorf(
-			"'%s' needs a map with string keys, has '%s' keys",
-			name, dataValType.Key().Kind())
+		return newDecodeError(name, fmt.Errorf(
+			"needs a map with string keys, has '%s' keys",
+			dataValType.Key().Kind()))
 	}
 
 	dataValKeys := make(map[reflect.Value]struct{})
@@ -1280,7 +2442,8 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 	}
 
 	targetValKeysUnused := make(map[interface{}]struct{})
-	errors := make([]string, 0)
+	targetValKeysOptional := make(map[interface{}]struct{})
+	errors := make([]error, 0)
 
 	// This slice will keep track of all the structs we'll be decoding.
 	// There can be more than one struct if there are embedded structs
@@ -1291,51 +2454,111 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 	// Compile the list of all the fields that we're going to be decoding
 	// from all the structs.
 	type field struct {
-		field reflect.StructField
-		val   reflect.Value
+		info *structField
+		val  reflect.Value
+
+		// ptr is the struct pointer field that val was dereferenced from,
+		// if any, so that DecodeNil can set it to nil.
+		ptr reflect.Value
+
+		// parent is the struct that holds the field, which is what
+		// FieldSetters are called with.
+		parent reflect.Value
 	}
 
 	// remainField is set to a valid field set with the "remain" tag if
-	// we are keeping track of remaining values.
-	var remainField *field
+	// we are keeping track of remaining values. A squashed map field is
+	// used the same way if there is no "remain" field.
+	var remainField, squashedMapField *field
+
+	// Squashed interfaces that hold a struct value are decoded into a copy,
+	// which is stored back into the interface once the fields are decoded.
+	type squashedCopy struct {
+		iface, copy reflect.Value
+	}
+	var squashedCopies []squashedCopy
 
 	fields := []field{}
 	for len(structs) > 0 {
 		structVal := structs[0]
 		structs = structs[1:]
 
-		structType := structVal.Type()
-
-		for i := 0; i < structType.NumField(); i++ {
-			fieldType := structType.Field(i)
+		structFields := cachedStructFields(
+			structVal.Type(), d.config.TagName, d.config.TagNameFallbacks)
+		for i := range structFields {
+			info := &structFields[i]
+			fieldType := info.field
 			fieldVal := structVal.Field(i)
-			if fieldVal.Kind() == reflect.Ptr && fieldVal.Elem().Kind() == reflect.Struct {
+
+			// Interfaces are squashed according to their dynamic value.
+			if fieldVal.Kind() == reflect.Interface && (info.squash || d.config.Squash &&
+				fieldType.Anonymous && !fieldVal.IsNil() && isStructOrStructPtr(fieldVal.Elem().Type())) {
+				iface := fieldVal
+				if iface.IsNil() {
+					typ, ok := d.config.DefaultInterfaceTypes[iface.Type()]
+					if !ok || !iface.CanSet() {
+						// Nothing to squash into.
+						continue
+					}
+					if !typ.AssignableTo(iface.Type()) {
+						errors = appendErrors(errors,
+							newDecodeError(joinFieldPath(name, fieldType.Name),
+								fmt.Errorf("default type '%s' is not assignable to '%s'", typ, iface.Type())))
+						continue
+					}
+					if typ.Kind() == reflect.Ptr {
+						iface.Set(reflect.New(typ.Elem()))
+					} else {
+						iface.Set(reflect.Zero(typ))
+					}
+				}
+
+				elem := iface.Elem()
+				switch {
+				case elem.Kind() == reflect.Ptr && elem.Type().Elem().Kind() == reflect.Struct && !elem.IsNil():
+					structs = append(structs, elem.Elem())
+				case elem.Kind() == reflect.Struct && iface.CanSet():
+					copy := reflect.New(elem.Type())
+					copy.Elem().Set(elem)
+					squashedCopies = append(squashedCopies, squashedCopy{iface, copy})
+					structs = append(structs, copy.Elem())
+				default:
+					errors = appendErrors(errors,
+						newDecodeError(joinFieldPath(name, fieldType.Name),
+							fmt.Errorf("unsupported type for squash: %s", elem.Type())))
+				}
+				continue
+			}
+
+			var ptrVal reflect.Value
+			isStructPtr := fieldVal.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct
+			if isStructPtr && !fieldVal.IsNil() {
 				// Handle embedded struct pointers as embedded structs.
+				ptrVal = fieldVal
 				fieldVal = fieldVal.Elem()
 			}
 
 			// If "squash" is specified in the tag, we squash the field down.
-			squash := d.config.Squash && fieldVal.Kind() == reflect.Struct && fieldType.Anonymous
-			remain := false
-
-			// We always parse the tags cause we're looking for other tags too
-			tagParts := strings.Split(fieldType.Tag.Get(d.config.TagName), ",")
-			for _, tag := range tagParts[1:] {
-				if tag == "squash" {
-					squash = true
-					break
-				}
+			squash := info.squash || d.config.Squash && fieldType.Anonymous &&
+				(fieldVal.Kind() == reflect.Struct || isStructPtr)
 
-				if tag == "remain" {
-					remain = true
-					break
-				}
+			if squash && fieldVal.Kind() == reflect.Map {
+				squashedMapField = &field{info: info, val: fieldVal}
+				continue
 			}
 
 			if squash {
+				if isStructPtr && fieldVal.Kind() == reflect.Ptr && fieldVal.CanSet() {
+					// Allocate nil embedded struct pointers so that they
+					// can be squashed.
+					fieldVal.Set(reflect.New(fieldType.Type.Elem()))
+					fieldVal = fieldVal.Elem()
+				}
+
 				if fieldVal.Kind() != reflect.Struct {
 					errors = appendErrors(errors,
-						fmt.Errorf("%s: unsupported type for squash: %s", fieldType.Name, fieldVal.Kind()))
+						newDecodeError(joinFieldPath(name, fieldType.Name),
+							fmt.Errorf("unsupported type for squash: %s", fieldVal.Kind())))
 				} else {
 					structs = append(structs, fieldVal)
 				}
@@ -1343,31 +2566,75 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 			}
 
 			// Build our field
-			if remain {
-				remainField = &field{fieldType, fieldVal}
+			if info.remain {
+				remainField = &field{info: info, val: fieldVal}
 			} else {
 				// Normal struct field, store it away
-				fields = append(fields, field{fieldType, fieldVal})
+				fields = append(fields, field{info, fieldVal, ptrVal, structVal})
 			}
 		}
 	}
 
+	if remainField == nil {
+		remainField = squashedMapField
+	}
+
+	// With CaseInsensitive, keys are checked against the names of all of
+	// the fields: a key equal to one field's name is only used for that
+	// field, and a key that only folds to several names is ambiguous.
+	var fieldKeys []string
+	if d.config.CaseInsensitive {
+		for _, f := range fields {
+			if f.info.name != "-" {
+				fieldKeys = append(fieldKeys, d.fieldKey(f.info))
+			}
+		}
+	}
+	ambiguousKeys := make(map[string]struct{})
+
 	// for fieldType, field := range fields {
 	for _, f := range fields {
-		field, fieldValue := f.field, f.val
-		fieldName := field.Name
+		fieldValue := f.val
+
+		if f.info.name == "-" {
+			// Explicitly ignored field
+			continue
+		}
+		fieldName := d.fieldKey(f.info)
+
+		ignored := d.isIgnoredField(joinFieldPath(name, fieldName))
+		if ignored && !d.config.DropIgnoredFields {
+			continue
+		}
 
-		tagValue := field.Tag.Get(d.config.TagName)
-		tagValue = strings.SplitN(tagValue, ",", 2)[0]
-		if tagValue != "" {
-			fieldName = tagValue
+		if !fieldValue.IsValid() {
+			// This should never happen
+			panic("field is not valid")
+		}
+
+		// If we can't set the field, then it is unexported or something,
+		// and we just continue onwards, unless it has a setter.
+		var setter func(target, value interface{}) error
+		if !fieldValue.CanSet() {
+			setter = d.fieldSetter(joinFieldPath(name, fieldName))
+			if setter == nil || !f.parent.CanAddr() {
+				continue
+			}
 		}
 
 		rawMapKey := reflect.ValueOf(fieldName)
 		rawMapVal := dataVal.MapIndex(rawMapKey)
 		if !rawMapVal.IsValid() {
 			// Do a slower search by iterating over each key and
-			// doing case-insensitive search.
+			// doing case-insensitive search. With CaseInsensitive, every
+			// key is checked, since if more than one matches we can't
+			// tell which one was meant.
+			matchName := d.config.MatchName
+			if d.config.CaseInsensitive {
+				matchName = strings.EqualFold
+			}
+
+			var matched, ambiguous []string
 			for dataValKey := range dataValKeys {
 				mK, ok := dataValKey.Interface().(string)
 				if !ok {
@@ -1375,46 +2642,137 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 					continue
 				}
 
-				if d.config.MatchName(mK, fieldName) {
-					rawMapKey = dataValKey
-					rawMapVal = dataVal.MapIndex(dataValKey)
+				if !matchName(mK, fieldName) {
+					continue
+				}
+
+				if d.config.CaseInsensitive {
+					if folded := foldedKeys(fieldKeys, mK); len(folded) > 1 {
+						if !containsString(folded, mK) {
+							ambiguous = append(ambiguous, mK)
+						}
+						// Otherwise the key belongs to the field it's
+						// equal to.
+						continue
+					}
+				}
+
+				rawMapKey = dataValKey
+				rawMapVal = dataVal.MapIndex(dataValKey)
+				if !d.config.CaseInsensitive {
 					break
 				}
+				matched = append(matched, mK)
+			}
+
+			if len(ambiguous) > 0 {
+				// Report each key once, not for every field it folds to.
+				sort.Strings(ambiguous)
+				for _, key := range ambiguous {
+					if _, ok := ambiguousKeys[key]; ok {
+						continue
+					}
+					ambiguousKeys[key] = struct{}{}
+					errors = appendErrors(errors,
+						newDecodeError(joinFieldPath(name, fieldName),
+							fmt.Errorf("ambiguous keys: %s matches fields %s",
+								key, strings.Join(foldedKeys(fieldKeys, key), ", "))))
+				}
+				continue
+			}
+
+			if len(matched) > 1 {
+				sort.Strings(matched)
+				errors = appendErrors(errors,
+					newDecodeError(joinFieldPath(name, fieldName),
+						fmt.Errorf("ambiguous keys: %s", strings.Join(matched, ", "))))
+				continue
+			}
+
+			if !rawMapVal.IsValid() && (ignored || setter != nil) {
+				continue
 			}
 
 			if !rawMapVal.IsValid() {
 				// There was no matching key in the map for the value in
-				// the struct. Remember it for potential errors and metadata.
+				// the struct. Use the default if one was given, otherwise
+				// remember it for potential errors and metadata.
+				if f.info.required {
+					errors = appendErrors(errors,
+						newDecodeError(joinFieldPath(name, fieldName),
+							fmt.Errorf("required field '%s' (key '%s') is missing", f.info.field.Name, fieldName)))
+					continue
+				}
+
+				if f.info.hasDefault && !d.config.IgnoreDefaults {
+					if name != "" {
+						fieldName = name + "." + fieldName
+					}
+
+					if err := d.decodeDefault(fieldName, depth+1, f.info.def, fieldValue); err != nil {
+						errors = appendErrors(errors, err)
+					}
+					continue
+				}
+
 				targetValKeysUnused[fieldName] = struct{}{}
+				if f.info.omitempty {
+					// Fields that may be empty are not required to be set.
+					targetValKeysOptional[fieldName] = struct{}{}
+				}
 				continue
 			}
 		}
 
-		if !fieldValue.IsValid() {
-			// This should never happen
-			panic("field is not valid")
-		}
+		// Delete the key we're using from the unused map so we stop tracking
+		delete(dataValKeysUnused, rawMapKey.Interface())
 
-		// If we can't set the field, then it is unexported or something,
-		// and we just continue onwards.
-		if !fieldValue.CanSet() {
+		if ignored {
 			continue
 		}
 
-		// Delete the key we're using from the unused map so we stop tracking
-		delete(dataValKeysUnused, rawMapKey.Interface())
-
 		// If the name is empty string, then we're at the root, and we
 		// don't dot-join the fields.
 		if name != "" {
 			fieldName = name + "." + fieldName
 		}
 
-		if err := d.decode(fieldName, rawMapVal.Interface(), fieldValue); err != nil {
+		if setter != nil {
+			if err := setter(f.parent.Addr().Interface(), rawMapVal.Interface()); err != nil {
+				errors = appendErrors(errors, newDecodeError(fieldName, err))
+			} else if d.config.Metadata != nil {
+				d.config.Metadata.Keys = append(d.config.Metadata.Keys, fieldName)
+			}
+			continue
+		}
+
+		if d.config.ZeroFieldsPresent && !isStructOrStructPtr(fieldValue.Type()) {
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+		}
+
+		input := rawMapVal.Interface()
+		if len(d.config.TagHooks) > 0 {
+			var err error
+			input, err = d.runTagHooks(fieldName, depth+1, f.info.options, input, fieldValue)
+			if err != nil {
+				errors = appendErrors(errors, err)
+				continue
+			}
+		}
+
+		if d.config.DecodeNil && f.ptr.IsValid() && isNilInput(input) {
+			fieldValue = f.ptr
+		}
+
+		if err := d.decode(fieldName, depth+1, input, fieldValue); err != nil {
 			errors = appendErrors(errors, err)
 		}
 	}
 
+	for _, c := range squashedCopies {
+		c.iface.Set(c.copy.Elem())
+	}
+
 	// If we have a "remain"-tagged field and we have unused keys then
 	// we put the unused keys directly into the remain field.
 	if remainField != nil && len(dataValKeysUnused) > 0 {
@@ -1425,7 +2783,8 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 		}
 
 		// Decode it as-if we were just decoding this map onto our map.
-		if err := d.decodeMap(name, remain, remainField.val); err != nil {
+		remainName := joinFieldPath(name, remainField.info.field.Name)
+		if err := d.decodeMap(remainName, depth+1, remain, remainField.val); err != nil {
 			errors = appendErrors(errors, err)
 		}
 
@@ -1434,55 +2793,351 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 		dataValKeysUnused = nil
 	}
 
-	if d.config.ErrorUnused && len(dataValKeysUnused) > 0 {
-		keys := make([]string, 0, len(dataValKeysUnused))
+	// Only collect the unused keys if something reports them. Keys that
+	// aren't strings, such as those of YAML maps, are formatted with
+	// fmt.Sprint.
+	var rawKeys []interface{}
+	var unusedKeys []string
+	if len(dataValKeysUnused) > 0 &&
+		(d.config.OnUnused != nil || d.config.ErrorUnused || d.config.Metadata != nil) {
+		rawKeys = make([]interface{}, 0, len(dataValKeysUnused))
 		for rawKey := range dataValKeysUnused {
-			keys = append(keys, rawKey.(string))
+			rawKeys = append(rawKeys, rawKey)
 		}
-		sort.Strings(keys)
+		sort.Slice(rawKeys, func(i, j int) bool {
+			return fmt.Sprint(rawKeys[i]) < fmt.Sprint(rawKeys[j])
+		})
 
-		err := fmt.Errorf("'%s' has invalid keys: %s", name, strings.Join(keys, ", "))
-		errors = appendErrors(errors, err)
+		unusedKeys = make([]string, len(rawKeys))
+		for i, rawKey := range rawKeys {
+			unusedKeys[i] = joinFieldPath(name, fmt.Sprint(rawKey))
+		}
+	}
+
+	switch {
+	case d.config.OnUnused != nil:
+		for i, rawKey := range rawKeys {
+			value := dataVal.MapIndex(reflect.ValueOf(rawKey)).Interface()
+			if err := d.config.OnUnused(unusedKeys[i], value); err != nil {
+				errors = appendErrors(errors, err)
+				break
+			}
+		}
+	case d.config.ErrorUnused && len(unusedKeys) > 0:
+		errors = appendErrors(errors, &UnusedKeysError{Keys: unusedKeys})
 	}
 
-	if d.config.ErrorUnset && len(targetValKeysUnused) > 0 {
+	if d.config.ErrorUnset && len(targetValKeysUnused) > len(targetValKeysOptional) {
 		keys := make([]string, 0, len(targetValKeysUnused))
 		for rawKey := range targetValKeysUnused {
+			if _, ok := targetValKeysOptional[rawKey]; ok {
+				continue
+			}
 			keys = append(keys, rawKey.(string))
 		}
 		sort.Strings(keys)
 
-		err := fmt.Errorf("'%s' has unset fields: %s", name, strings.Join(keys, ", "))
+		err := newDecodeError(name, fmt.Errorf("unset fields: %s", strings.Join(keys, ", ")))
 		errors = appendErrors(errors, err)
 	}
 
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	// Add the unused keys to the list of unused keys if we're tracking metadata
 	if d.config.Metadata != nil {
-		for rawKey := range dataValKeysUnused {
-			key := rawKey.(string)
-			if name != "" {
-				key = name + "." + key
-			}
+		d.config.Metadata.Unused = append(d.config.Metadata.Unused, unusedKeys...)
+		unset := make([]string, 0, len(targetValKeysUnused))
+		for rawKey := range targetValKeysUnused {
+			unset = append(unset, joinFieldPath(name, rawKey.(string)))
+		}
+		if d.config.SortMapKeys {
+			sort.Strings(unset)
+		}
+		d.config.Metadata.Unset = append(d.config.Metadata.Unset, unset...)
+	}
+
+	return nil
+}
 
-			d.config.Metadata.Unused = append(d.config.Metadata.Unused, key)
+// runTagHooks runs the TagHooks registered for the given tag options, in
+// the order the options appear in the tag.
+func (d *Decoder) runTagHooks(name string, depth int, options []string, input interface{}, outVal reflect.Value) (interface{}, error) {
+	for _, option := range options {
+		hook, ok := d.config.TagHooks[option]
+		if !ok || input == nil {
+			continue
 		}
-		for rawKey := range targetValKeysUnused {
-			key := rawKey.(string)
-			if name != "" {
-				key = name + "." + key
-			}
 
-			d.config.Metadata.Unset = append(d.config.Metadata.Unset, key)
+		var err error
+		input, err = decodeHookExec(hook, reflect.ValueOf(input), outVal, name, depth)
+		if err != nil {
+			return nil, newDecodeError(name, err)
 		}
 	}
 
+	return input, nil
+}
+
+// decodeDefault decodes the raw value of a ",default=" tag option into
+// val. The value is always weakly decoded so that it can be used for
+// non-string fields.
+func (d *Decoder) decodeDefault(name string, depth int, def string, val reflect.Value) error {
+	if err := d.weakDecoder().decode(name, depth, def, val); err != nil {
+		return newDecodeError(name, fmt.Errorf("invalid default %q: %w", def, trimErrorPath(err, name)))
+	}
+
 	return nil
 }
 
+// trimErrorPath returns the error inside err if err is a DecodeError for
+// the given path, so that wrapping it in another DecodeError for the same
+// path doesn't repeat the path.
+func trimErrorPath(err error, name string) error {
+	var derr *DecodeError
+	if errors.As(err, &derr) && derr.Path == name {
+		return derr.Err
+	}
+	return err
+}
+
+// weakDecoder returns a decoder with the same configuration as d, but with
+// WeaklyTypedInput enabled.
+func (d *Decoder) weakDecoder() *Decoder {
+	if d.config.WeaklyTypedInput {
+		return d
+	}
+
+	config := *d.config
+	config.WeaklyTypedInput = true
+	return &Decoder{config: &config}
+}
+
+// fieldKey returns the map key that is looked up for a struct field: the
+// name in its tag, or else its name transformed by DecodeKeyFunc.
+func (d *Decoder) fieldKey(info *structField) string {
+	if info.name != "" {
+		return info.name
+	}
+	if d.config.DecodeKeyFunc != nil {
+		return d.config.DecodeKeyFunc(info.field.Name)
+	}
+	return info.field.Name
+}
+
+// joinFieldPath appends the struct field name to the given path, leaving
+// out the dot for top-level fields.
+func joinFieldPath(name string, fieldName string) string {
+	if name == "" {
+		return fieldName
+	}
+
+	return name + "." + fieldName
+}
+
+// isIgnoredField reports whether the field at path is in IgnoreFields.
+func (d *Decoder) isIgnoredField(path string) bool {
+	for _, ignore := range d.config.IgnoreFields {
+		if strings.EqualFold(ignore, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldSetter returns the FieldSetters entry for the unexported field at
+// path, or nil if there is none or AllowUnexportedFields isn't set.
+func (d *Decoder) fieldSetter(path string) func(target, value interface{}) error {
+	if !d.config.AllowUnexportedFields {
+		return nil
+	}
+	if setter, ok := d.config.FieldSetters[path]; ok {
+		return setter
+	}
+	for p, setter := range d.config.FieldSetters {
+		if strings.EqualFold(p, path) {
+			return setter
+		}
+	}
+
+	return nil
+}
+
+// tagHasOption reports whether the given tag value contains the option.
+func tagHasOption(tagValue string, option string) bool {
+	tagParts := strings.Split(tagValue, ",")
+	for _, tag := range tagParts[1:] {
+		if tag == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tagDefault returns the value of the ",default=" option in the given
+// tag value, if any.
+func tagDefault(tagValue string) (string, bool) {
+	tagParts := strings.Split(tagValue, ",")
+	for _, tag := range tagParts[1:] {
+		if strings.HasPrefix(tag, "default=") {
+			return strings.TrimPrefix(tag, "default="), true
+		}
+	}
+
+	return "", false
+}
+
+// structField is the information about a struct field that is needed
+// for decoding into it, parsed once per struct type and tag name.
+type structField struct {
+	field reflect.StructField
+
+	// name is the part of the tag before the first comma.
+	name string
+
+	// squash and remain are set by the ",squash" and ",remain" options.
+	squash bool
+	remain bool
+
+	// omitempty and required are set by the ",omitempty" and ",required"
+	// options and def by the ",default=" option.
+	omitempty  bool
+	required   bool
+	def        string
+	hasDefault bool
+
+	// options are all of the options in the tag, used to look up TagHooks.
+	options []string
+}
+
+type structFieldsKey struct {
+	typ reflect.Type
+
+	// tagNames is the tag name followed by any fallbacks, comma separated.
+	tagNames string
+}
+
+// structFieldsCache caches the result of cachedStructFields. It is shared
+// by all decoders, which may be used concurrently.
+var structFieldsCache sync.Map // map[structFieldsKey][]structField
+
+// cachedStructFields returns the parsed fields of the given struct type,
+// in the same order as the fields of the type.
+func cachedStructFields(typ reflect.Type, tagName string, fallbacks []string) []structField {
+	key := structFieldsKey{typ: typ, tagNames: tagName}
+	if len(fallbacks) > 0 {
+		key.tagNames += "," + strings.Join(fallbacks, ",")
+	}
+	if fields, ok := structFieldsCache.Load(key); ok {
+		return fields.([]structField)
+	}
+
+	fields := make([]structField, typ.NumField())
+	for i := range fields {
+		f := typ.Field(i)
+		tagValue := lookupTag(f.Tag, tagName, fallbacks)
+		tagParts := strings.Split(tagValue, ",")
+
+		fields[i] = structField{
+			field:     f,
+			name:      tagParts[0],
+			omitempty: tagHasOption(tagValue, "omitempty"),
+			required:  tagHasOption(tagValue, "required"),
+			options:   tagParts[1:],
+		}
+		fields[i].def, fields[i].hasDefault = tagDefault(tagValue)
+
+		for _, tag := range tagParts[1:] {
+			if tag == "squash" || tag == "inline" {
+				fields[i].squash = true
+				break
+			}
+
+			if tag == "remain" {
+				fields[i].remain = true
+				break
+			}
+		}
+	}
+
+	actual, _ := structFieldsCache.LoadOrStore(key, fields)
+	return actual.([]structField)
+}
+
+// lookupTag returns the value of the tagName tag, or of the first of
+// fallbacks that is present if tagName isn't.
+func lookupTag(tag reflect.StructTag, tagName string, fallbacks []string) string {
+	if v, ok := tag.Lookup(tagName); ok || len(fallbacks) == 0 {
+		return v
+	}
+	for _, name := range fallbacks {
+		if v, ok := tag.Lookup(name); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// overflowError returns the error for a value, formatted as it appeared in
+// the input, that is out of range for the integer type typ.
+func overflowError(value string, typ reflect.Type) error {
+	bits := typ.Bits()
+	if typ.Kind() >= reflect.Uint && typ.Kind() <= reflect.Uintptr {
+		return fmt.Errorf("value %s overflows %s (range 0 to %d)",
+			value, typ, uint64(math.MaxUint64)>>(64-bits))
+	}
+
+	return fmt.Errorf("value %s overflows %s (range %d to %d)",
+		value, typ, int64(-1)<<(bits-1), int64(math.MaxInt64)>>(64-bits))
+}
+
+// isNegativeNumber reports whether str is a valid negative number, which
+// strconv.ParseUint rejects as a syntax error rather than as out of range.
+func isNegativeNumber(str string) bool {
+	if !strings.HasPrefix(str, "-") {
+		return false
+	}
+
+	if i, err := strconv.ParseInt(str, 0, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		return i < 0
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	return (err == nil || errors.Is(err, strconv.ErrRange)) && f < 0
+}
+
+// lossyError returns the error for a value, formatted as it appeared in
+// the input, that would lose precision when converted to typ.
+func lossyError(value string, typ reflect.Type) error {
+	return fmt.Errorf("value %s cannot be represented exactly as %s", value, typ)
+}
+
+// roundFloat rounds f to the precision of the float type typ.
+func roundFloat(f float64, typ reflect.Type) float64 {
+	if typ.Bits() == 32 {
+		return float64(float32(f))
+	}
+	return f
+}
+
+// recordCoercion adds a conversion from one value into another to the
+// Metadata, if it is being collected.
+func (d *Decoder) recordCoercion(name string, from, to reflect.Value) {
+	if d.config.Metadata == nil {
+		return
+	}
+
+	desc := fmt.Sprintf("%s(%v) -> %s(%v)",
+		from.Type(), from.Interface(), to.Type(), to.Interface())
+	if name != "" {
+		desc = name + ": " + desc
+	}
+	d.config.Metadata.Coercions = append(d.config.Metadata.Coercions, desc)
+}
+
 func isEmptyValue(v reflect.Value) bool {
 	switch getKind(v) {
 	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
@@ -1501,6 +3156,178 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
+// isZeroer is implemented by types that know whether they are zero,
+// such as time.Time.
+type isZeroer interface {
+	IsZero() bool
+}
+
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return true
+		}
+	}
+
+	if z, ok := v.Interface().(isZeroer); ok {
+		return z.IsZero()
+	}
+	if v.CanAddr() {
+		if z, ok := v.Addr().Interface().(isZeroer); ok {
+			return z.IsZero()
+		}
+	}
+
+	return v.IsZero()
+}
+
+// maxIndexedMapGap is the most indexes that a map decoded into a slice
+// with DecodeIndexedMapToArray can leave out, so that a single large index
+// can't make the slice arbitrarily long.
+const maxIndexedMapGap = 1024
+
+// isIndexedMapKey reports whether maps with keys of type typ may be decoded
+// with DecodeIndexedMapToArray. Interface keys, as decoded by some YAML
+// libraries, are checked for each key.
+func isIndexedMapKey(typ reflect.Type) bool {
+	return typ.Kind() == reflect.String || typ.Kind() == reflect.Interface
+}
+
+// indexedMapToSlice converts a map keyed by indexes into a slice that has
+// each value at its index and nil everywhere else. If max isn't negative,
+// indexes must be less than it. Otherwise the slice may have at most
+// maxIndexedMapGap more elements than the map has entries.
+func indexedMapToSlice(name string, dataVal reflect.Value, max int) ([]interface{}, error) {
+	indexes := make(map[int]interface{}, dataVal.Len())
+	length := 0
+	for _, k := range dataVal.MapKeys() {
+		key := k
+		if key.Kind() == reflect.Interface {
+			key = key.Elem()
+		}
+
+		i := -1
+		var err error
+		switch getKind(key) {
+		case reflect.String, reflect.Int:
+			i, err = strconv.Atoi(fmt.Sprint(key.Interface()))
+		}
+		if err != nil || i < 0 {
+			return nil, newDecodeError(name,
+				fmt.Errorf("cannot use key '%v' as an index", key))
+		}
+		if max >= 0 && i >= max {
+			return nil, newDecodeError(name,
+				fmt.Errorf("index %d out of range for array of length %d", i, max))
+		}
+		if max < 0 && i >= dataVal.Len()+maxIndexedMapGap {
+			return nil, newDecodeError(name,
+				fmt.Errorf("index %d too large for map with %d entries", i, dataVal.Len()))
+		}
+
+		indexes[i] = dataVal.MapIndex(k).Interface()
+		if i >= length {
+			length = i + 1
+		}
+	}
+
+	items := make([]interface{}, length)
+	for i, v := range indexes {
+		items[i] = v
+	}
+
+	return items, nil
+}
+
+// sortMapKeys sorts map keys, which must all have the same type. Strings
+// and numbers are sorted by value and any other keys by their formatted
+// value.
+func sortMapKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := reflect.Indirect(keys[i]), reflect.Indirect(keys[j])
+		if a.Kind() == reflect.Interface {
+			a, b = a.Elem(), b.Elem()
+		}
+		if a.Kind() == b.Kind() {
+			switch getKind(a) {
+			case reflect.String:
+				return a.String() < b.String()
+			case reflect.Int:
+				return a.Int() < b.Int()
+			case reflect.Uint:
+				return a.Uint() < b.Uint()
+			case reflect.Float32:
+				return a.Float() < b.Float()
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+}
+
+// foldedKeys returns the keys that are equal to key under Unicode case
+// folding, in sorted order.
+func foldedKeys(keys []string, key string) []string {
+	var folded []string
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			folded = append(folded, k)
+		}
+	}
+	sort.Strings(folded)
+	return folded
+}
+
+// containsString reports whether s is in list.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyString reports whether data is a string, or a value of a string
+// type, that is empty.
+func isEmptyString(data interface{}) bool {
+	v := reflect.ValueOf(data)
+	return v.Kind() == reflect.String && v.Len() == 0
+}
+
+// isNillable reports whether val is of a kind that DecodeNil sets to nil.
+func isNillable(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// isNilInput reports whether data is nil or a typed nil pointer, which
+// decode treats the same.
+func isNilInput(data interface{}) bool {
+	if data == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(data)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func isStructOrStructPtr(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Struct
+}
+
+// jsonNumberType is treated as a numeric type by the int, uint and float
+// decoders regardless of WeaklyTypedInput, and numeric values can always be
+// decoded into it.
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
 func getKind(val reflect.Value) reflect.Kind {
 	kind := val.Kind()
 
@@ -1511,6 +3338,8 @@ func getKind(val reflect.Value) reflect.Kind {
 		return reflect.Uint
 	case kind >= reflect.Float32 && kind <= reflect.Float64:
 		return reflect.Float32
+	case kind >= reflect.Complex64 && kind <= reflect.Complex128:
+		return reflect.Complex64
 	default:
 		return kind
 	}
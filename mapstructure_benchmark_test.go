@@ -2,7 +2,9 @@ package mapstructure
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type Person struct {
@@ -97,6 +99,28 @@ func Benchmark_DecodeBasic(b *testing.B) {
 	}
 }
 
+func Benchmark_DecodeBasicParallel(b *testing.B) {
+	input := map[string]interface{}{
+		"vstring":     "foo",
+		"vint":        42,
+		"Vuint":       42,
+		"vbool":       true,
+		"Vfloat":      42.42,
+		"vsilent":     true,
+		"vdata":       42,
+		"vjsonInt":    json.Number("1234"),
+		"vjsonFloat":  json.Number("1234.5"),
+		"vjsonNumber": json.Number("1234.5"),
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var result Basic
+			Decode(input, &result)
+		}
+	})
+}
+
 func Benchmark_DecodeEmbedded(b *testing.B) {
 	input := map[string]interface{}{
 		"vstring": "foo",
@@ -199,6 +223,107 @@ func Benchmark_DecodeSliceOfStruct(b *testing.B) {
 	}
 }
 
+func Benchmark_DecodeLargeSliceOfStruct(b *testing.B) {
+	input := make([]map[string]interface{}, 10000)
+	for i := range input {
+		input[i] = map[string]interface{}{"vstring": "foo", "vint": i}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := make([]Basic, 0, 1)
+		Decode(input, &result)
+	}
+}
+
+func benchmarkDecodeTimes(b *testing.B, config *DecoderConfig) {
+	input := make([]string, 1000)
+	for i := range input {
+		input[i] = "2006-01-02T15:04:05Z"
+	}
+
+	var result []time.Time
+	config.Result = &result
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result = nil
+		if err := decoder.Decode(input); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func Benchmark_DecodeHookChain(b *testing.B) {
+	hooks := []DecodeHookFunc{
+		StringToTimeDurationHookFunc(),
+		StringToIPHookFunc(),
+		StringToIPNetHookFunc(),
+		StringToNetipAddrHookFunc(),
+		StringToNetipPrefixHookFunc(),
+		StringToURLHookFunc(),
+		StringToRegexpHookFunc(),
+		StringToBigIntHookFunc(),
+		StringToMACHookFunc(),
+		StringToTimeHookFunc(time.RFC3339),
+	}
+
+	benchmarkDecodeTimes(b, &DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(hooks...),
+	})
+}
+
+func Benchmark_DecodeTypeHooks(b *testing.B) {
+	benchmarkDecodeTimes(b, &DecoderConfig{
+		TypeHooks: map[reflect.Type]DecodeHookFunc{
+			reflect.TypeOf(time.Time{}): StringToTimeHookFunc(time.RFC3339),
+		},
+	})
+}
+
+func benchmarkDecodeStringsHook(b *testing.B, hook DecodeHookFunc) {
+	input := make([]interface{}, 1000)
+	for i := range input {
+		input[i] = "foo"
+	}
+
+	var result []string
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(hook, hook),
+		Result:     &result,
+	})
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result = nil
+		if err := decoder.Decode(input); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func Benchmark_DecodeHookFuncType(b *testing.B) {
+	benchmarkDecodeStringsHook(b, func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		return data, nil
+	})
+}
+
+func Benchmark_DecodeHookFuncReflect(b *testing.B) {
+	benchmarkDecodeStringsHook(b, DecodeHookFuncReflect(func(f reflect.Type, t reflect.Type, data reflect.Value) (reflect.Value, error) {
+		return data, nil
+	}))
+}
+
 func Benchmark_DecodeWeaklyTypedInput(b *testing.B) {
 	// This input can come from anywhere, but typically comes from
 	// something like decoding JSON, generated by a weakly typed language
@@ -2,10 +2,13 @@ package mapstructure
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -322,448 +325,692 @@ func TestBasicTypes(t *testing.T) {
 	}
 }
 
-func TestBasic_IntWithFloat(t *testing.T) {
+func TestBasic_JSONNumber(t *testing.T) {
 	t.Parallel()
 
+	n := json.Number("42")
 	input := map[string]interface{}{
-		"vint": float64(42),
+		"vint":        n,
+		"vint8":       n,
+		"vint16":      n,
+		"vint32":      n,
+		"vint64":      n,
+		"Vuint":       n,
+		"Vfloat":      n,
+		"vjsonInt":    n,
+		"vjsonUint":   n,
+		"vjsonUint64": n,
+		"vjsonFloat":  n,
 	}
 
-	var result Basic
-	err := Decode(input, &result)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	expected := Basic{
+		Vint:        42,
+		Vint8:       42,
+		Vint16:      42,
+		Vint32:      42,
+		Vint64:      42,
+		Vuint:       42,
+		Vfloat:      42,
+		VjsonInt:    42,
+		VjsonUint:   42,
+		VjsonUint64: 42,
+		VjsonFloat:  42,
+	}
+
+	for _, weak := range []bool{false, true} {
+		var result Basic
+		decoder, err := NewDecoder(&DecoderConfig{
+			WeaklyTypedInput: weak,
+			Result:           &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("weak=%t: err: %s", weak, err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("weak=%t: bad: %#v", weak, result)
+		}
 	}
 }
 
-func TestBasic_Merge(t *testing.T) {
+func TestBasic_JSONNumberOverflow(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vint": 42,
-	}
-
 	var result Basic
-	result.Vuint = 100
-	err := Decode(input, &result)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
-	}
-
-	expected := Basic{
-		Vint:  42,
-		Vuint: 100,
+	err := Decode(map[string]interface{}{"vint8": json.Number("300")}, &result)
+	if err == nil {
+		t.Fatal("expected error")
 	}
-	if !reflect.DeepEqual(result, expected) {
-		t.Fatalf("bad: %#v", result)
+	if !strings.Contains(err.Error(), "300 overflows int8") {
+		t.Fatalf("bad error: %s", err)
 	}
 }
 
-// Test for issue #46.
-func TestBasic_Struct(t *testing.T) {
+func TestBasic_JSONNumberWeakString(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vdata": map[string]interface{}{
-			"vstring": "foo",
-		},
+	var i8 int8
+	if err := WeakDecode(json.Number("0x10"), &i8); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if i8 != 16 {
+		t.Fatalf("bad: %d", i8)
 	}
 
-	var result, inner Basic
-	result.Vdata = &inner
-	err := Decode(input, &result)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	input := map[string]interface{}{
+		"vint":   json.Number(""),
+		"vuint":  json.Number(""),
+		"vfloat": json.Number(""),
 	}
-	expected := Basic{
-		Vdata: &Basic{
-			Vstring: "foo",
-		},
+	result := Basic{Vint: 1, Vuint: 1, Vfloat: 1}
+	if err := WeakDecode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	if !reflect.DeepEqual(result, expected) {
+	if result.Vint != 0 || result.Vuint != 0 || result.Vfloat != 0 {
 		t.Fatalf("bad: %#v", result)
 	}
+
+	// Without WeaklyTypedInput they're still an error.
+	if err := Decode(json.Number("0x10"), &i8); err == nil {
+		t.Fatal("expected error")
+	}
 }
 
-func TestBasic_interfaceStruct(t *testing.T) {
+func TestDecode_IntOverflow(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
+	type Target struct {
+		Small  int8
+		Byte   uint8
+		Nested struct {
+			Small int8
+		}
 	}
 
-	var iface interface{} = &Basic{}
-	err := Decode(input, &iface)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	cases := []struct {
+		input    map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"small": "99999999999"},
+			`Small: value "99999999999" overflows int8 (range -128 to 127)`,
+		},
+		{
+			map[string]interface{}{"small": 300},
+			"Small: value 300 overflows int8 (range -128 to 127)",
+		},
+		{
+			map[string]interface{}{"small": -129.5},
+			"Small: value -129.5 overflows int8 (range -128 to 127)",
+		},
+		{
+			map[string]interface{}{"byte": "256"},
+			`Byte: value "256" overflows uint8 (range 0 to 255)`,
+		},
+		{
+			map[string]interface{}{"byte": uint64(1000)},
+			"Byte: value 1000 overflows uint8 (range 0 to 255)",
+		},
+		{
+			map[string]interface{}{"nested": map[string]interface{}{"small": int64(128)}},
+			"Nested.Small: value 128 overflows int8 (range -128 to 127)",
+		},
+		{
+			map[string]interface{}{"small": json.Number("99999999999999999999")},
+			"Small: value 99999999999999999999 overflows int8 (range -128 to 127)",
+		},
+		{
+			map[string]interface{}{"byte": json.Number("256")},
+			"Byte: value 256 overflows uint8 (range 0 to 255)",
+		},
 	}
 
-	expected := &Basic{
-		Vstring: "foo",
+	for i, tc := range cases {
+		var result Target
+		err := WeakDecode(tc.input, &result)
+		if err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+		if !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("case %d: expected %q, got: %s", i, tc.expected, err)
+		}
 	}
-	if !reflect.DeepEqual(iface, expected) {
-		t.Fatalf("bad: %#v", iface)
+
+	var result Target
+	if err := WeakDecode(map[string]interface{}{"small": "-128", "byte": 255.0}, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Small != -128 || result.Byte != 255 {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-// Issue 187
-func TestBasic_interfaceStructNonPtr(t *testing.T) {
+func TestDecode_ErrorOnLossyNumericConversion(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
+	type Target struct {
+		Int     int
+		Uint    uint
+		Float   float64
+		Float32 float32
 	}
 
-	var iface interface{} = Basic{}
-	err := Decode(input, &iface)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	decode := func(input map[string]interface{}, strict bool) (Target, error) {
+		var result Target
+		decoder, err := NewDecoder(&DecoderConfig{
+			ErrorOnLossyNumericConversion: strict,
+			Result:                        &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return result, decoder.Decode(input)
 	}
 
-	expected := Basic{
-		Vstring: "foo",
+	result, err := decode(map[string]interface{}{"int": 1.5}, false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	if !reflect.DeepEqual(iface, expected) {
-		t.Fatalf("bad: %#v", iface)
+	if result.Int != 1 {
+		t.Fatalf("bad: %#v", result.Int)
 	}
-}
 
-func TestDecode_BasicSquash(t *testing.T) {
-	t.Parallel()
+	cases := []struct {
+		input    map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"int": 1.5},
+			"Int: value 1.5 cannot be represented exactly as int",
+		},
+		{
+			map[string]interface{}{"uint": 2.25},
+			"Uint: value 2.25 cannot be represented exactly as uint",
+		},
+		{
+			map[string]interface{}{"float": int64(9007199254740993)},
+			"Float: value 9007199254740993 cannot be represented exactly as float64",
+		},
+		{
+			map[string]interface{}{"float": uint64(1<<64 - 1)},
+			"Float: value 18446744073709551615 cannot be represented exactly as float64",
+		},
+		{
+			map[string]interface{}{"float32": 16777217},
+			"Float32: value 16777217 cannot be represented exactly as float32",
+		},
+	}
 
-	input := map[string]interface{}{
-		"vstring": "foo",
+	for i, tc := range cases {
+		_, err := decode(tc.input, true)
+		if err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+		if !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("case %d: expected %q, got: %s", i, tc.expected, err)
+		}
 	}
 
-	var result BasicSquash
-	err := Decode(input, &result)
+	result, err = decode(map[string]interface{}{
+		"int":     2.0,
+		"uint":    3.0,
+		"float":   int64(9007199254740992),
+		"float32": 16777216,
+	}, true)
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
-
-	if result.Test.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Test.Vstring)
+	if result.Int != 2 || result.Uint != 3 || result.Float != 9007199254740992 || result.Float32 != 16777216 {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestDecodeFrom_BasicSquash(t *testing.T) {
+func TestBasic_ToJSONNumber(t *testing.T) {
 	t.Parallel()
 
-	var v interface{}
-	var ok bool
-
-	input := BasicSquash{
-		Test: Basic{
-			Vstring: "foo",
-		},
+	cases := []struct {
+		input    interface{}
+		expected json.Number
+	}{
+		{42, "42"},
+		{int64(-9007199254740993), "-9007199254740993"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{1234.5, "1234.5"},
+		{float32(0.1), "0.1"},
+		{1e21, "1e+21"},
+	}
+
+	for i, tc := range cases {
+		var result Basic
+		err := Decode(map[string]interface{}{"vjsonNumber": tc.input}, &result)
+		if err != nil {
+			t.Fatalf("case %d: err: %s", i, err)
+		}
+		if result.VjsonNumber != tc.expected {
+			t.Fatalf("case %d: expected %q, got %q", i, tc.expected, result.VjsonNumber)
+		}
 	}
+}
 
-	var result map[string]interface{}
-	err := Decode(input, &result)
-	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
-	}
+func TestBasic_IntWithFloat(t *testing.T) {
+	t.Parallel()
 
-	if _, ok = result["Test"]; ok {
-		t.Error("test should not be present in map")
+	input := map[string]interface{}{
+		"vint": float64(42),
 	}
 
-	v, ok = result["Vstring"]
-	if !ok {
-		t.Error("vstring should be present in map")
-	} else if !reflect.DeepEqual(v, "foo") {
-		t.Errorf("vstring value should be 'foo': %#v", v)
+	var result Basic
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
 }
 
-func TestDecode_Embedded(t *testing.T) {
+func TestBasic_Merge(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vstring": "foo",
-		"Basic": map[string]interface{}{
-			"vstring": "innerfoo",
-		},
-		"vunique": "bar",
+		"vint": 42,
 	}
 
-	var result Embedded
+	var result Basic
+	result.Vuint = 100
 	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("got an err: %s", err)
 	}
 
-	if result.Vstring != "innerfoo" {
-		t.Errorf("vstring value should be 'innerfoo': %#v", result.Vstring)
+	expected := Basic{
+		Vint:  42,
+		Vuint: 100,
 	}
-
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestDecode_EmbeddedPointer(t *testing.T) {
+func TestBasic_MergeZeroFieldsPresent(t *testing.T) {
 	t.Parallel()
 
+	type Target struct {
+		Vint     int
+		Vuint    uint
+		Vslice   []string
+		Vkept    []string
+		Vmap     map[string]string
+		Vmapkept map[string]string
+		Vnested  Basic
+	}
+
 	input := map[string]interface{}{
-		"vstring": "foo",
-		"Basic": map[string]interface{}{
-			"vstring": "innerfoo",
+		"vint":   42,
+		"vslice": []string{"c"},
+		"vmap": map[string]string{
+			"c": "3",
+		},
+		"vnested": map[string]interface{}{
+			"vstring": "foo",
 		},
-		"vunique": "bar",
 	}
 
-	var result EmbeddedPointer
-	err := Decode(input, &result)
+	result := Target{
+		Vuint:    100,
+		Vslice:   []string{"a", "b"},
+		Vkept:    []string{"a", "b"},
+		Vmap:     map[string]string{"a": "1", "b": "2"},
+		Vmapkept: map[string]string{"a": "1"},
+		Vnested:  Basic{Vint: 7},
+	}
+	config := &DecoderConfig{
+		ZeroFieldsPresent: true,
+		Result:            &result,
+	}
+
+	decoder, err := NewDecoder(config)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	expected := EmbeddedPointer{
-		Basic: &Basic{
-			Vstring: "innerfoo",
-		},
-		Vunique: "bar",
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := Target{
+		Vint:     42,
+		Vuint:    100,
+		Vslice:   []string{"c"},
+		Vkept:    []string{"a", "b"},
+		Vmap:     map[string]string{"c": "3"},
+		Vmapkept: map[string]string{"a": "1"},
+		Vnested:  Basic{Vstring: "foo", Vint: 7},
 	}
 	if !reflect.DeepEqual(result, expected) {
 		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestDecode_EmbeddedSlice(t *testing.T) {
+func TestDecode_DecodeNil(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"slice_alias": []string{"foo", "bar"},
-		"vunique":     "bar",
+	result := NestedPointer{
+		Vfoo: "foo",
+		Vbar: &Basic{Vstring: "bar"},
 	}
 
-	var result EmbeddedSlice
-	err := Decode(input, &result)
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeNil: true,
+		Result:    &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	if !reflect.DeepEqual(result.SliceAlias, SliceAlias([]string{"foo", "bar"})) {
-		t.Errorf("slice value: %#v", result.SliceAlias)
+	if err := decoder.Decode(map[string]interface{}{"vbar": nil}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vbar != nil {
+		t.Fatalf("vbar should be nil: %#v", result.Vbar)
+	}
+	if result.Vfoo != "foo" {
+		t.Fatalf("vfoo should be unchanged: %#v", result.Vfoo)
 	}
 
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	// Nil values leave non-nillable fields alone.
+	if err := decoder.Decode(map[string]interface{}{"vfoo": nil}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vfoo != "foo" {
+		t.Fatalf("vfoo should be unchanged: %#v", result.Vfoo)
+	}
+
+	// Without the option, a nil value leaves the pointer as it was.
+	result.Vbar = &Basic{Vstring: "bar"}
+	if err := Decode(map[string]interface{}{"vbar": nil}, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vbar == nil {
+		t.Fatal("vbar should not be nil")
 	}
 }
 
-func TestDecode_EmbeddedArray(t *testing.T) {
+func TestDecode_EmptyStringAsNil(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"array_alias": [2]string{"foo", "bar"},
-		"vunique":     "bar",
+	type Form struct {
+		BasicPointer `mapstructure:",squash"`
+		Tags         []string
+		Name         string
+		Count        int
 	}
 
-	var result EmbeddedArray
-	err := Decode(input, &result)
+	one := 1
+	result := Form{BasicPointer: BasicPointer{Vuint: new(uint)}, Tags: []string{"a"}}
+	result.Vint = &one
+	decoder, err := NewDecoder(&DecoderConfig{
+		EmptyStringAsNil: true,
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	if !reflect.DeepEqual(result.ArrayAlias, ArrayAlias([2]string{"foo", "bar"})) {
-		t.Errorf("array value: %#v", result.ArrayAlias)
+	input := map[string]interface{}{
+		"vint":  "",
+		"vuint": "",
+		"tags":  "",
+		"name":  "",
+		"count": "",
 	}
-
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-}
-
-func TestDecode_decodeSliceWithArray(t *testing.T) {
-	t.Parallel()
-
-	var result []int
-	input := [1]int{1}
-	expected := []int{1}
-	if err := Decode(input, &result); err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+	if result.Vint != nil || result.Vuint != nil {
+		t.Fatalf("pointers should be nil: %#v", result.BasicPointer)
+	}
+	if result.Tags != nil {
+		t.Fatalf("tags should be nil: %#v", result.Tags)
+	}
+	if result.Name != "" || result.Count != 0 {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	if !reflect.DeepEqual(expected, result) {
-		t.Errorf("wanted %+v, got %+v", expected, result)
+	// Without weak typing, empty strings into other types still fail.
+	decoder, err = NewDecoder(&DecoderConfig{
+		EmptyStringAsNil: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"vint": "", "count": ""}); err == nil {
+		t.Fatal("expected error")
+	}
+	if result.Vint != nil {
+		t.Fatalf("vint should be nil: %#v", result.Vint)
 	}
 }
 
-func TestDecode_EmbeddedNoSquash(t *testing.T) {
+func TestBasic_TrimStrings(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vstring": "foo",
-		"vunique": "bar",
+		"vstring": "  foo  ",
+		"vint":    " 42 ",
 	}
 
-	var result Embedded
-	err := Decode(input, &result)
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		TrimStrings:      true,
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vstring != "" {
-		t.Errorf("vstring value should be empty: %#v", result.Vstring)
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error parsing untrimmed int")
 	}
 
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	input["vint"] = "42"
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-}
-
-func TestDecode_EmbeddedPointerNoSquash(t *testing.T) {
-	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
-		"vunique": "bar",
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
 	}
 
-	result := EmbeddedPointer{
-		Basic: &Basic{},
+	if result.Vint != 42 {
+		t.Errorf("vint value should be 42: %#v", result.Vint)
 	}
 
-	err := Decode(input, &result)
+	var m map[string]string
+	decoder, err = NewDecoder(&DecoderConfig{
+		TrimStrings: true,
+		Result:      &m,
+	})
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vstring != "" {
-		t.Errorf("vstring value should be empty: %#v", result.Vstring)
+	if err := decoder.Decode(map[string]interface{}{"foo": "\tbar\n"}); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	if m["foo"] != "bar" {
+		t.Errorf("map value should be 'bar': %#v", m["foo"])
 	}
 }
 
-func TestDecode_EmbeddedSquash(t *testing.T) {
+func TestDecode_MergeHookSeesCurrentValue(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
-		"vunique": "bar",
+	type Config struct {
+		Tags   []string
+		Groups map[string][]string
 	}
 
-	var result EmbeddedSquash
-	err := Decode(input, &result)
+	appendHook := func(from reflect.Value, to reflect.Value) (interface{}, error) {
+		existing, ok := to.Interface().([]string)
+		if !ok || from.Kind() != reflect.String {
+			return from.Interface(), nil
+		}
+		return append(existing, from.String()), nil
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: DecodeHookFuncValue(appendHook),
+		Result:     &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
+	inputs := []map[string]interface{}{
+		{"tags": "a", "groups": map[string]interface{}{"admins": "alice"}},
+		{"tags": "b", "groups": map[string]interface{}{"admins": "bob", "users": "carol"}},
+	}
+	for _, input := range inputs {
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
 	}
 
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	expected := Config{
+		Tags: []string{"a", "b"},
+		Groups: map[string][]string{
+			"admins": {"alice", "bob"},
+			"users":  {"carol"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestDecodeFrom_EmbeddedSquash(t *testing.T) {
+func TestDecode_MergeReplacesMapEntries(t *testing.T) {
 	t.Parallel()
 
-	var v interface{}
-	var ok bool
+	type S struct {
+		X int
+		Y int
+	}
 
-	input := EmbeddedSquash{
-		Basic: Basic{
-			Vstring: "foo",
+	result := map[string]S{"a": {X: 1, Y: 5}}
+	if err := Decode(map[string]interface{}{"a": map[string]interface{}{"x": 2}}, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]S{"a": {X: 2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+// Test for issue #46.
+func TestBasic_Struct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vdata": map[string]interface{}{
+			"vstring": "foo",
 		},
-		Vunique: "bar",
 	}
 
-	var result map[string]interface{}
+	var result, inner Basic
+	result.Vdata = &inner
 	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("got an err: %s", err)
+	}
+	expected := Basic{
+		Vdata: &Basic{
+			Vstring: "foo",
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
+}
 
-	if _, ok = result["Basic"]; ok {
-		t.Error("basic should not be present in map")
+func TestBasic_interfaceStruct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "foo",
 	}
 
-	v, ok = result["Vstring"]
-	if !ok {
-		t.Error("vstring should be present in map")
-	} else if !reflect.DeepEqual(v, "foo") {
-		t.Errorf("vstring value should be 'foo': %#v", v)
+	var iface interface{} = &Basic{}
+	err := Decode(input, &iface)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
 
-	v, ok = result["Vunique"]
-	if !ok {
-		t.Error("vunique should be present in map")
-	} else if !reflect.DeepEqual(v, "bar") {
-		t.Errorf("vunique value should be 'bar': %#v", v)
+	expected := &Basic{
+		Vstring: "foo",
+	}
+	if !reflect.DeepEqual(iface, expected) {
+		t.Fatalf("bad: %#v", iface)
 	}
 }
 
-func TestDecode_EmbeddedPointerSquash_FromStructToMap(t *testing.T) {
+// Issue 187
+func TestBasic_interfaceStructNonPtr(t *testing.T) {
 	t.Parallel()
 
-	input := EmbeddedPointerSquash{
-		Basic: &Basic{
-			Vstring: "foo",
-		},
-		Vunique: "bar",
+	input := map[string]interface{}{
+		"vstring": "foo",
 	}
 
-	var result map[string]interface{}
-	err := Decode(input, &result)
+	var iface interface{} = Basic{}
+	err := Decode(input, &iface)
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("got an err: %s", err)
 	}
 
-	if result["Vstring"] != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result["Vstring"])
+	expected := Basic{
+		Vstring: "foo",
 	}
-
-	if result["Vunique"] != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result["Vunique"])
+	if !reflect.DeepEqual(iface, expected) {
+		t.Fatalf("bad: %#v", iface)
 	}
 }
 
-func TestDecode_EmbeddedPointerSquash_FromMapToStruct(t *testing.T) {
+func TestDecode_BasicSquash(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"Vstring": "foo",
-		"Vunique": "bar",
+		"vstring": "foo",
 	}
 
-	result := EmbeddedPointerSquash{
-		Basic: &Basic{},
-	}
+	var result BasicSquash
 	err := Decode(input, &result)
 	if err != nil {
 		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
-	}
-
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	if result.Test.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Test.Vstring)
 	}
 }
 
-func TestDecode_EmbeddedPointerSquashWithNestedMapstructure_FromStructToMap(t *testing.T) {
+func TestDecodeFrom_BasicSquash(t *testing.T) {
 	t.Parallel()
 
-	vTime := time.Now()
+	var v interface{}
+	var ok bool
 
-	input := EmbeddedPointerSquashWithNestedMapstructure{
-		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{
-			Vbar: &BasicMapStructure{
-				Vunique: "bar",
-				Vtime:   &vTime,
-			},
+	input := BasicSquash{
+		Test: Basic{
+			Vstring: "foo",
 		},
-		Vunique: "foo",
 	}
 
 	var result map[string]interface{}
@@ -771,1175 +1018,3401 @@ func TestDecode_EmbeddedPointerSquashWithNestedMapstructure_FromStructToMap(t *t
 	if err != nil {
 		t.Fatalf("got an err: %s", err.Error())
 	}
-	expected := map[string]interface{}{
-		"vbar": map[string]interface{}{
-			"vunique": "bar",
-			"time":    &vTime,
-		},
-		"Vunique": "foo",
+
+	if _, ok = result["Test"]; ok {
+		t.Error("test should not be present in map")
 	}
 
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("result should be %#v: got %#v", expected, result)
+	v, ok = result["Vstring"]
+	if !ok {
+		t.Error("vstring should be present in map")
+	} else if !reflect.DeepEqual(v, "foo") {
+		t.Errorf("vstring value should be 'foo': %#v", v)
 	}
 }
 
-func TestDecode_EmbeddedPointerSquashWithNestedMapstructure_FromMapToStruct(t *testing.T) {
+func TestDecode_SquashMap(t *testing.T) {
 	t.Parallel()
 
-	vTime := time.Now()
+	type Config struct {
+		Name  string
+		Extra map[string]interface{} `mapstructure:",squash"`
+	}
 
 	input := map[string]interface{}{
-		"vbar": map[string]interface{}{
-			"vunique": "bar",
-			"time":    &vTime,
-		},
-		"Vunique": "foo",
+		"name": "foo",
+		"bar":  "baz",
+		"num":  42,
 	}
 
-	result := EmbeddedPointerSquashWithNestedMapstructure{
-		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{},
-	}
-	err := Decode(input, &result)
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
-	expected := EmbeddedPointerSquashWithNestedMapstructure{
-		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{
-			Vbar: &BasicMapStructure{
-				Vunique: "bar",
-				Vtime:   &vTime,
-			},
-		},
-		Vunique: "foo",
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("result should be %#v: got %#v", expected, result)
+	if result.Name != "foo" {
+		t.Errorf("name should be foo: %#v", result.Name)
+	}
+
+	expected := map[string]interface{}{"bar": "baz", "num": 42}
+	if !reflect.DeepEqual(result.Extra, expected) {
+		t.Errorf("bad: %#v", result.Extra)
 	}
 }
 
-func TestDecode_EmbeddedSquashConfig(t *testing.T) {
+func TestDecode_SquashMapWithRemain(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
-		"vunique": "bar",
-		"Named": map[string]interface{}{
-			"vstring": "baz",
-		},
+	type Config struct {
+		Name   string
+		Extra  map[string]interface{} `mapstructure:",squash"`
+		Remain map[string]interface{} `mapstructure:",remain"`
 	}
 
-	var result EmbeddedAndNamed
-	config := &DecoderConfig{
-		Squash: true,
-		Result: &result,
+	input := map[string]interface{}{
+		"name": "foo",
+		"bar":  "baz",
 	}
 
-	decoder, err := NewDecoder(config)
-	if err != nil {
+	var result Config
+	if err := Decode(input, &result); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
-	}
-
-	if result.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
-	}
-
-	if result.Vunique != "bar" {
-		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	if result.Extra != nil {
+		t.Errorf("squashed map should be empty: %#v", result.Extra)
 	}
 
-	if result.Named.Vstring != "baz" {
-		t.Errorf("Named.vstring value should be 'baz': %#v", result.Named.Vstring)
+	expected := map[string]interface{}{"bar": "baz"}
+	if !reflect.DeepEqual(result.Remain, expected) {
+		t.Errorf("bad: %#v", result.Remain)
 	}
 }
 
-func TestDecodeFrom_EmbeddedSquashConfig(t *testing.T) {
+func TestDecodeFrom_SquashMap(t *testing.T) {
 	t.Parallel()
 
-	input := EmbeddedAndNamed{
-		Basic:   Basic{Vstring: "foo"},
-		Named:   Basic{Vstring: "baz"},
-		Vunique: "bar",
+	type Config struct {
+		Name  string
+		Extra map[string]interface{} `mapstructure:",squash"`
 	}
 
-	result := map[string]interface{}{}
-	config := &DecoderConfig{
-		Squash: true,
-		Result: &result,
-	}
-	decoder, err := NewDecoder(config)
-	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+	input := Config{
+		Name: "foo",
+		Extra: map[string]interface{}{
+			"Name": "ignored",
+			"bar":  "baz",
+		},
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+	var result map[string]interface{}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	if _, ok := result["Basic"]; ok {
-		t.Error("basic should not be present in map")
+	expected := map[string]interface{}{
+		"Name": "foo",
+		"bar":  "baz",
 	}
-
-	v, ok := result["Vstring"]
-	if !ok {
-		t.Error("vstring should be present in map")
-	} else if !reflect.DeepEqual(v, "foo") {
-		t.Errorf("vstring value should be 'foo': %#v", v)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
 	}
+}
 
-	v, ok = result["Vunique"]
-	if !ok {
-		t.Error("vunique should be present in map")
-	} else if !reflect.DeepEqual(v, "bar") {
-		t.Errorf("vunique value should be 'bar': %#v", v)
-	}
+func TestDecode_SquashMapSortMapKeys(t *testing.T) {
+	t.Parallel()
 
-	v, ok = result["Named"]
-	if !ok {
-		t.Error("Named should be present in map")
-	} else {
-		named := v.(map[string]interface{})
-		v, ok := named["Vstring"]
-		if !ok {
-			t.Error("Named: vstring should be present in map")
-		} else if !reflect.DeepEqual(v, "baz") {
-			t.Errorf("Named: vstring should be 'baz': %#v", v)
+	type Config struct {
+		Name  string
+		Extra map[string]interface{} `mapstructure:",squash"`
+	}
+
+	input := map[string]interface{}{"name": "foo"}
+	expected := []string{"Name"}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		input[k] = k
+		expected = append(expected, "Extra["+k+"]")
+	}
+
+	for i := 0; i < 10; i++ {
+		var names []string
+		var result Config
+		decoder, err := NewDecoder(&DecoderConfig{
+			DecodeHook: DecodeHookFuncValueNamed(func(from, to reflect.Value, name string) (interface{}, error) {
+				if from.Kind() == reflect.String && (len(names) == 0 || names[len(names)-1] != name) {
+					names = append(names, name)
+				}
+				return from.Interface(), nil
+			}),
+			SortMapKeys: true,
+			Result:      &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("bad order: %#v", names)
 		}
 	}
 }
 
-func TestDecodeFrom_EmbeddedSquashConfig_WithTags(t *testing.T) {
+func TestDecode_InlineMap(t *testing.T) {
 	t.Parallel()
 
-	var v interface{}
-	var ok bool
+	type Config struct {
+		Name  string                 `mapstructure:"name"`
+		Extra map[string]interface{} `mapstructure:",inline"`
+	}
 
-	input := EmbeddedSquash{
-		Basic: Basic{
-			Vstring: "foo",
-		},
-		Vunique: "bar",
+	input := map[string]interface{}{
+		"name":  "foo",
+		"other": "bar",
 	}
 
-	result := map[string]interface{}{}
-	config := &DecoderConfig{
-		Squash: true,
-		Result: &result,
+	var result Config
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	decoder, err := NewDecoder(config)
-	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+
+	// The named field takes the overlapping key and the inline map only
+	// gets what's left.
+	if result.Name != "foo" {
+		t.Errorf("name should be foo: %#v", result.Name)
+	}
+	if !reflect.DeepEqual(result.Extra, map[string]interface{}{"other": "bar"}) {
+		t.Errorf("bad: %#v", result.Extra)
 	}
+}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+func TestDecodeFrom_InlineMap(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Name  string                 `mapstructure:"name"`
+		Extra map[string]interface{} `mapstructure:",inline"`
 	}
 
-	if _, ok = result["Basic"]; ok {
-		t.Error("basic should not be present in map")
+	input := Config{
+		Name: "foo",
+		Extra: map[string]interface{}{
+			"name":  "ignored",
+			"other": "bar",
+		},
 	}
 
-	v, ok = result["Vstring"]
-	if !ok {
-		t.Error("vstring should be present in map")
-	} else if !reflect.DeepEqual(v, "foo") {
-		t.Errorf("vstring value should be 'foo': %#v", v)
+	var result map[string]interface{}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	v, ok = result["Vunique"]
-	if !ok {
-		t.Error("vunique should be present in map")
-	} else if !reflect.DeepEqual(v, "bar") {
-		t.Errorf("vunique value should be 'bar': %#v", v)
+	expected := map[string]interface{}{
+		"name":  "foo",
+		"other": "bar",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
 	}
 }
 
-func TestDecode_SquashOnNonStructType(t *testing.T) {
-	t.Parallel()
+type PetNamer interface {
+	name() string
+}
 
-	input := map[string]interface{}{
-		"InvalidSquashType": 42,
-	}
+type squashPet struct {
+	Name  string
+	Breed string
+}
 
-	var result SquashOnNonStructType
-	err := Decode(input, &result)
-	if err == nil {
-		t.Fatal("unexpected success decoding invalid squash field type")
-	} else if !strings.Contains(err.Error(), "unsupported type for squash") {
-		t.Fatalf("unexpected error message for invalid squash field type: %s", err)
-	}
+func (p squashPet) name() string { return p.Name }
+
+type squashOwner struct {
+	PetNamer `mapstructure:",squash"`
+	Age      int
 }
 
-func TestDecode_DecodeHook(t *testing.T) {
+func TestDecode_SquashInterface(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vint": "WHAT",
+		"name":  "rex",
+		"breed": "collie",
+		"age":   3,
 	}
 
-	decodeHook := func(from reflect.Kind, to reflect.Kind, v interface{}) (interface{}, error) {
-		if from == reflect.String && to != reflect.String {
-			return 5, nil
-		}
-
-		return v, nil
+	// Pointer dynamic values are decoded into directly.
+	pet := &squashPet{Breed: "unknown"}
+	result := squashOwner{PetNamer: pet}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.PetNamer != pet || pet.Name != "rex" || pet.Breed != "collie" || result.Age != 3 {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	var result Basic
-	config := &DecoderConfig{
-		DecodeHook: decodeHook,
-		Result:     &result,
+	// Struct dynamic values are replaced with the decoded copy.
+	result = squashOwner{PetNamer: squashPet{}}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result.PetNamer, squashPet{Name: "rex", Breed: "collie"}) {
+		t.Fatalf("bad: %#v", result.PetNamer)
 	}
 
-	decoder, err := NewDecoder(config)
-	if err != nil {
+	// A nil interface is left alone.
+	result = squashOwner{}
+	if err := Decode(input, &result); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if result.PetNamer != nil || result.Age != 3 {
+		t.Fatalf("bad: %#v", result)
+	}
 
-	err = decoder.Decode(input)
+	// Unless a default type is configured for it.
+	result = squashOwner{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		DefaultInterfaceTypes: map[reflect.Type]reflect.Type{
+			reflect.TypeOf((*PetNamer)(nil)).Elem(): reflect.TypeOf(&squashPet{}),
+		},
+		Result: &result,
+	})
 	if err != nil {
-		t.Fatalf("got an err: %s", err)
+		t.Fatalf("err: %s", err)
 	}
-
-	if result.Vint != 5 {
-		t.Errorf("vint should be 5: %#v", result.Vint)
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result.PetNamer, &squashPet{Name: "rex", Breed: "collie"}) {
+		t.Fatalf("bad: %#v", result.PetNamer)
 	}
 }
 
-func TestDecode_DecodeHookType(t *testing.T) {
+func TestDecodeFrom_SquashInterface(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vint": "WHAT",
+	input := squashOwner{
+		PetNamer: &squashPet{Name: "rex", Breed: "collie"},
+		Age:      3,
 	}
 
-	decodeHook := func(from reflect.Type, to reflect.Type, v interface{}) (interface{}, error) {
-		if from.Kind() == reflect.String &&
-			to.Kind() != reflect.String {
-			return 5, nil
-		}
-
-		return v, nil
+	var result map[string]interface{}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	var result Basic
-	config := &DecoderConfig{
-		DecodeHook: decodeHook,
-		Result:     &result,
+	expected := map[string]interface{}{
+		"Name":  "rex",
+		"Breed": "collie",
+		"Age":   3,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	decoder, err := NewDecoder(config)
-	if err != nil {
+	input.PetNamer = nil
+	result = nil
+	if err := Decode(input, &result); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if !reflect.DeepEqual(result, map[string]interface{}{"Age": 3}) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecode_Embedded(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"Basic": map[string]interface{}{
+			"vstring": "innerfoo",
+		},
+		"vunique": "bar",
+	}
 
-	err = decoder.Decode(input)
+	var result Embedded
+	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an err: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vint != 5 {
-		t.Errorf("vint should be 5: %#v", result.Vint)
+	if result.Vstring != "innerfoo" {
+		t.Errorf("vstring value should be 'innerfoo': %#v", result.Vstring)
+	}
+
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 }
 
-func TestDecode_Nil(t *testing.T) {
+func TestDecode_EmbeddedPointer(t *testing.T) {
 	t.Parallel()
 
-	var input interface{}
-	result := Basic{
-		Vstring: "foo",
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"Basic": map[string]interface{}{
+			"vstring": "innerfoo",
+		},
+		"vunique": "bar",
 	}
 
+	var result EmbeddedPointer
 	err := Decode(input, &result)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vstring != "foo" {
-		t.Fatalf("bad: %#v", result.Vstring)
+	expected := EmbeddedPointer{
+		Basic: &Basic{
+			Vstring: "innerfoo",
+		},
+		Vunique: "bar",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestDecode_NilInterfaceHook(t *testing.T) {
+func TestDecode_EmbeddedSlice(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"w": "",
+		"slice_alias": []string{"foo", "bar"},
+		"vunique":     "bar",
 	}
 
-	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
-		if t.String() == "io.Writer" {
-			return nil, nil
-		}
+	var result EmbeddedSlice
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
 
-		return v, nil
+	if !reflect.DeepEqual(result.SliceAlias, SliceAlias([]string{"foo", "bar"})) {
+		t.Errorf("slice value: %#v", result.SliceAlias)
 	}
 
-	var result NilInterface
-	config := &DecoderConfig{
-		DecodeHook: decodeHook,
-		Result:     &result,
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
+}
 
-	decoder, err := NewDecoder(config)
-	if err != nil {
-		t.Fatalf("err: %s", err)
+func TestDecode_EmbeddedArray(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"array_alias": [2]string{"foo", "bar"},
+		"vunique":     "bar",
 	}
 
-	err = decoder.Decode(input)
+	var result EmbeddedArray
+	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an err: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.W != nil {
-		t.Errorf("W should be nil: %#v", result.W)
+	if !reflect.DeepEqual(result.ArrayAlias, ArrayAlias([2]string{"foo", "bar"})) {
+		t.Errorf("array value: %#v", result.ArrayAlias)
+	}
+
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 }
 
-func TestDecode_NilPointerHook(t *testing.T) {
+func TestDecode_decodeSliceWithArray(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"value": "",
+	var result []int
+	input := [1]int{1}
+	expected := []int{1}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
-		if typed, ok := v.(string); ok {
-			if typed == "" {
-				return nil, nil
-			}
-		}
-		return v, nil
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("wanted %+v, got %+v", expected, result)
 	}
+}
 
-	var result NilPointer
-	config := &DecoderConfig{
-		DecodeHook: decodeHook,
-		Result:     &result,
+func TestDecode_EmbeddedNoSquash(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"vunique": "bar",
 	}
 
-	decoder, err := NewDecoder(config)
+	var result Embedded
+	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("err: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	if result.Vstring != "" {
+		t.Errorf("vstring value should be empty: %#v", result.Vstring)
 	}
 
-	if result.Value != nil {
-		t.Errorf("W should be nil: %#v", result.Value)
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 }
 
-func TestDecode_FuncHook(t *testing.T) {
+func TestDecode_EmbeddedPointerNoSquash(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"foo": "baz",
-	}
-
-	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
-		if t.Kind() != reflect.Func {
-			return v, nil
-		}
-		val := v.(string)
-		return func() string { return val }, nil
+		"vstring": "foo",
+		"vunique": "bar",
 	}
 
-	var result Func
-	config := &DecoderConfig{
-		DecodeHook: decodeHook,
-		Result:     &result,
+	result := EmbeddedPointer{
+		Basic: &Basic{},
 	}
 
-	decoder, err := NewDecoder(config)
+	err := Decode(input, &result)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	if result.Vstring != "" {
+		t.Errorf("vstring value should be empty: %#v", result.Vstring)
 	}
 
-	if result.Foo() != "baz" {
-		t.Errorf("Foo call result should be 'baz': %s", result.Foo())
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 }
 
-func TestDecode_NonStruct(t *testing.T) {
+func TestDecode_EmbeddedPointerNoSquashNil(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"foo": "bar",
-		"bar": "baz",
+		"vstring": "x",
+		"vunique": "y",
 	}
 
-	var result map[string]string
-	err := Decode(input, &result)
-	if err != nil {
+	var md Metadata
+	var result EmbeddedPointer
+	if err := DecodeMetadata(input, &result, &md); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if result["foo"] != "bar" {
-		t.Fatal("foo is not bar")
+	// Without squashing, the fields of the embedded struct aren't promoted,
+	// so there is nothing to allocate it for.
+	if result.Basic != nil {
+		t.Errorf("embedded pointer should be nil: %#v", result.Basic)
+	}
+	if result.Vunique != "y" {
+		t.Errorf("vunique value should be 'y': %#v", result.Vunique)
+	}
+	if !reflect.DeepEqual(md.Unused, []string{"vstring"}) {
+		t.Errorf("bad unused: %#v", md.Unused)
+	}
+
+	result = EmbeddedPointer{}
+	if err := DecodeMetadata(map[string]interface{}{"basic": input}, &result, &md); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Basic == nil || result.Basic.Vstring != "x" {
+		t.Errorf("embedded pointer should be allocated: %#v", result.Basic)
 	}
 }
 
-func TestDecode_StructMatch(t *testing.T) {
+func TestDecode_EmbeddedSquash(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vbar": Basic{
-			Vstring: "foo",
-		},
+		"vstring": "foo",
+		"vunique": "bar",
 	}
 
-	var result Nested
+	var result EmbeddedSquash
 	err := Decode(input, &result)
 	if err != nil {
 		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vbar.Vstring != "foo" {
-		t.Errorf("bad: %#v", result)
-	}
-}
-
-func TestDecode_TypeConversion(t *testing.T) {
-	input := map[string]interface{}{
-		"IntToFloat":         42,
-		"IntToUint":          42,
-		"IntToBool":          1,
-		"IntToString":        42,
-		"UintToInt":          42,
-		"UintToFloat":        42,
-		"UintToBool":         42,
-		"UintToString":       42,
-		"BoolToInt":          true,
-		"BoolToUint":         true,
-		"BoolToFloat":        true,
-		"BoolToString":       true,
-		"FloatToInt":         42.42,
-		"FloatToUint":        42.42,
-		"FloatToBool":        42.42,
-		"FloatToString":      42.42,
-		"SliceUint8ToString": []uint8("foo"),
-		"StringToSliceUint8": "foo",
-		"ArrayUint8ToString": [3]uint8{'f', 'o', 'o'},
-		"StringToInt":        "42",
-		"StringToUint":       "42",
-		"StringToBool":       "1",
-		"StringToFloat":      "42.42",
-		"StringToStrSlice":   "A",
-		"StringToIntSlice":   "42",
-		"StringToStrArray":   "A",
-		"StringToIntArray":   "42",
-		"SliceToMap":         []interface{}{},
-		"MapToSlice":         map[string]interface{}{},
-		"ArrayToMap":         []interface{}{},
-		"MapToArray":         map[string]interface{}{},
-	}
-
-	expectedResultStrict := TypeConversionResult{
-		IntToFloat:  42.0,
-		IntToUint:   42,
-		UintToInt:   42,
-		UintToFloat: 42,
-		BoolToInt:   0,
-		BoolToUint:  0,
-		BoolToFloat: 0,
-		FloatToInt:  42,
-		FloatToUint: 42,
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
 	}
 
-	expectedResultWeak := TypeConversionResult{
-		IntToFloat:         42.0,
-		IntToUint:          42,
-		IntToBool:          true,
-		IntToString:        "42",
-		UintToInt:          42,
-		UintToFloat:        42,
-		UintToBool:         true,
-		UintToString:       "42",
-		BoolToInt:          1,
-		BoolToUint:         1,
-		BoolToFloat:        1,
-		BoolToString:       "1",
-		FloatToInt:         42,
-		FloatToUint:        42,
-		FloatToBool:        true,
-		FloatToString:      "42.42",
-		SliceUint8ToString: "foo",
-		StringToSliceUint8: []byte("foo"),
-		ArrayUint8ToString: "foo",
-		StringToInt:        42,
-		StringToUint:       42,
-		StringToBool:       true,
-		StringToFloat:      42.42,
-		StringToStrSlice:   []string{"A"},
-		StringToIntSlice:   []int{42},
-		StringToStrArray:   [1]string{"A"},
-		StringToIntArray:   [1]int{42},
-		SliceToMap:         map[string]interface{}{},
-		MapToSlice:         []interface{}{},
-		ArrayToMap:         map[string]interface{}{},
-		MapToArray:         [1]interface{}{},
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
+}
 
-	// Test strict type conversion
-	var resultStrict TypeConversionResult
-	err := Decode(input, &resultStrict)
-	if err == nil {
-		t.Errorf("should return an error")
-	}
-	if !reflect.DeepEqual(resultStrict, expectedResultStrict) {
-		t.Errorf("expected %v, got: %v", expectedResultStrict, resultStrict)
-	}
+func TestDecodeFrom_EmbeddedSquash(t *testing.T) {
+	t.Parallel()
 
-	// Test weak type conversion
-	var decoder *Decoder
-	var resultWeak TypeConversionResult
+	var v interface{}
+	var ok bool
 
-	config := &DecoderConfig{
-		WeaklyTypedInput: true,
-		Result:           &resultWeak,
+	input := EmbeddedSquash{
+		Basic: Basic{
+			Vstring: "foo",
+		},
+		Vunique: "bar",
 	}
 
-	decoder, err = NewDecoder(config)
+	var result map[string]interface{}
+	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("err: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("got an err: %s", err)
+	if _, ok = result["Basic"]; ok {
+		t.Error("basic should not be present in map")
 	}
 
-	if !reflect.DeepEqual(resultWeak, expectedResultWeak) {
-		t.Errorf("expected \n%#v, got: \n%#v", expectedResultWeak, resultWeak)
+	v, ok = result["Vstring"]
+	if !ok {
+		t.Error("vstring should be present in map")
+	} else if !reflect.DeepEqual(v, "foo") {
+		t.Errorf("vstring value should be 'foo': %#v", v)
 	}
-}
 
-func TestDecoder_ErrorUnused(t *testing.T) {
-	t.Parallel()
-
-	input := map[string]interface{}{
-		"vstring": "hello",
-		"foo":     "bar",
-	}
-
-	var result Basic
-	config := &DecoderConfig{
-		ErrorUnused: true,
-		Result:      &result,
-	}
-
-	decoder, err := NewDecoder(config)
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
-	err = decoder.Decode(input)
-	if err == nil {
-		t.Fatal("expected error")
+	v, ok = result["Vunique"]
+	if !ok {
+		t.Error("vunique should be present in map")
+	} else if !reflect.DeepEqual(v, "bar") {
+		t.Errorf("vunique value should be 'bar': %#v", v)
 	}
 }
 
-func TestDecoder_ErrorUnused_NotSetable(t *testing.T) {
+func TestDecode_EmbeddedPointerSquash_FromStructToMap(t *testing.T) {
 	t.Parallel()
 
-	// lowercase vsilent is unexported and cannot be set
-	input := map[string]interface{}{
-		"vsilent": "false",
+	input := EmbeddedPointerSquash{
+		Basic: &Basic{
+			Vstring: "foo",
+		},
+		Vunique: "bar",
 	}
 
-	var result Basic
-	config := &DecoderConfig{
-		ErrorUnused: true,
-		Result:      &result,
+	var result map[string]interface{}
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	decoder, err := NewDecoder(config)
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if result["Vstring"] != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result["Vstring"])
 	}
 
-	err = decoder.Decode(input)
-	if err == nil {
-		t.Fatal("expected error")
+	if result["Vunique"] != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result["Vunique"])
 	}
 }
-func TestDecoder_ErrorUnset(t *testing.T) {
+
+func TestDecode_EmbeddedPointerSquash_FromMapToStruct(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vstring": "hello",
-		"foo":     "bar",
+		"Vstring": "foo",
+		"Vunique": "bar",
 	}
 
-	var result Basic
-	config := &DecoderConfig{
-		ErrorUnset: true,
-		Result:     &result,
+	result := EmbeddedPointerSquash{
+		Basic: &Basic{},
 	}
-
-	decoder, err := NewDecoder(config)
+	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("err: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	err = decoder.Decode(input)
-	if err == nil {
-		t.Fatal("expected error")
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
+	}
+
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 }
 
-func TestMap(t *testing.T) {
+func TestDecode_EmbeddedPointerSquashWithNestedMapstructure_FromStructToMap(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vother": map[interface{}]interface{}{
-			"foo": "foo",
-			"bar": "bar",
+	vTime := time.Now()
+
+	input := EmbeddedPointerSquashWithNestedMapstructure{
+		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{
+			Vbar: &BasicMapStructure{
+				Vunique: "bar",
+				Vtime:   &vTime,
+			},
 		},
+		Vunique: "foo",
 	}
 
-	var result Map
+	var result map[string]interface{}
 	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an error: %s", err)
-	}
-
-	if result.Vfoo != "foo" {
-		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
-	}
-
-	if result.Vother == nil {
-		t.Fatal("vother should not be nil")
-	}
-
-	if len(result.Vother) != 2 {
-		t.Error("vother should have two items")
+		t.Fatalf("got an err: %s", err.Error())
 	}
-
-	if result.Vother["foo"] != "foo" {
-		t.Errorf("'foo' key should be foo, got: %#v", result.Vother["foo"])
+	expected := map[string]interface{}{
+		"vbar": map[string]interface{}{
+			"vunique": "bar",
+			"time":    &vTime,
+		},
+		"Vunique": "foo",
 	}
 
-	if result.Vother["bar"] != "bar" {
-		t.Errorf("'bar' key should be bar, got: %#v", result.Vother["bar"])
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("result should be %#v: got %#v", expected, result)
 	}
 }
 
-func TestMapMerge(t *testing.T) {
+func TestDecode_EmbeddedPointerSquashWithNestedMapstructure_FromMapToStruct(t *testing.T) {
 	t.Parallel()
 
+	vTime := time.Now()
+
 	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vother": map[interface{}]interface{}{
-			"foo": "foo",
-			"bar": "bar",
+		"vbar": map[string]interface{}{
+			"vunique": "bar",
+			"time":    &vTime,
 		},
+		"Vunique": "foo",
 	}
 
-	var result Map
-	result.Vother = map[string]string{"hello": "world"}
+	result := EmbeddedPointerSquashWithNestedMapstructure{
+		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{},
+	}
 	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got an error: %s", err)
+		t.Fatalf("got an err: %s", err.Error())
 	}
-
-	if result.Vfoo != "foo" {
-		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	expected := EmbeddedPointerSquashWithNestedMapstructure{
+		NestedPointerWithMapstructure: &NestedPointerWithMapstructure{
+			Vbar: &BasicMapStructure{
+				Vunique: "bar",
+				Vtime:   &vTime,
+			},
+		},
+		Vunique: "foo",
 	}
 
-	expected := map[string]string{
-		"foo":   "foo",
-		"bar":   "bar",
-		"hello": "world",
-	}
-	if !reflect.DeepEqual(result.Vother, expected) {
-		t.Errorf("bad: %#v", result.Vother)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("result should be %#v: got %#v", expected, result)
 	}
 }
 
-func TestMapOfStruct(t *testing.T) {
+func TestDecode_EmbeddedSquashConfig(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"value": map[string]interface{}{
-			"foo": map[string]string{"vstring": "one"},
-			"bar": map[string]string{"vstring": "two"},
+		"vstring": "foo",
+		"vunique": "bar",
+		"Named": map[string]interface{}{
+			"vstring": "baz",
 		},
 	}
 
-	var result MapOfStruct
-	err := Decode(input, &result)
+	var result EmbeddedAndNamed
+	config := &DecoderConfig{
+		Squash: true,
+		Result: &result,
+	}
+
+	decoder, err := NewDecoder(config)
 	if err != nil {
-		t.Fatalf("got an err: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Value == nil {
-		t.Fatal("value should not be nil")
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
 
-	if len(result.Value) != 2 {
-		t.Error("value should have two items")
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
 	}
 
-	if result.Value["foo"].Vstring != "one" {
-		t.Errorf("foo value should be 'one', got: %s", result.Value["foo"].Vstring)
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
 
-	if result.Value["bar"].Vstring != "two" {
-		t.Errorf("bar value should be 'two', got: %s", result.Value["bar"].Vstring)
+	if result.Named.Vstring != "baz" {
+		t.Errorf("Named.vstring value should be 'baz': %#v", result.Named.Vstring)
 	}
 }
 
-func TestNestedType(t *testing.T) {
+func TestDecodeFrom_EmbeddedSquashConfig(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": map[string]interface{}{
-			"vstring": "foo",
-			"vint":    42,
-			"vbool":   true,
-		},
+	input := EmbeddedAndNamed{
+		Basic:   Basic{Vstring: "foo"},
+		Named:   Basic{Vstring: "baz"},
+		Vunique: "bar",
 	}
 
-	var result Nested
-	err := Decode(input, &result)
+	result := map[string]interface{}{}
+	config := &DecoderConfig{
+		Squash: true,
+		Result: &result,
+	}
+	decoder, err := NewDecoder(config)
 	if err != nil {
 		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vfoo != "foo" {
-		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
-	}
-
-	if result.Vbar.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vbar.Vint != 42 {
-		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	if _, ok := result["Basic"]; ok {
+		t.Error("basic should not be present in map")
 	}
 
-	if result.Vbar.Vbool != true {
-		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
+	v, ok := result["Vstring"]
+	if !ok {
+		t.Error("vstring should be present in map")
+	} else if !reflect.DeepEqual(v, "foo") {
+		t.Errorf("vstring value should be 'foo': %#v", v)
 	}
 
-	if result.Vbar.Vextra != "" {
-		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	v, ok = result["Vunique"]
+	if !ok {
+		t.Error("vunique should be present in map")
+	} else if !reflect.DeepEqual(v, "bar") {
+		t.Errorf("vunique value should be 'bar': %#v", v)
 	}
-}
-
-func TestNestedTypePointer(t *testing.T) {
-	t.Parallel()
 
-	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": &map[string]interface{}{
-			"vstring": "foo",
-			"vint":    42,
-			"vbool":   true,
+	v, ok = result["Named"]
+	if !ok {
+		t.Error("Named should be present in map")
+	} else {
+		named := v.(map[string]interface{})
+		v, ok := named["Vstring"]
+		if !ok {
+			t.Error("Named: vstring should be present in map")
+		} else if !reflect.DeepEqual(v, "baz") {
+			t.Errorf("Named: vstring should be 'baz': %#v", v)
+		}
+	}
+}
+
+func TestDecodeFrom_EmbeddedSquashConfig_WithTags(t *testing.T) {
+	t.Parallel()
+
+	var v interface{}
+	var ok bool
+
+	input := EmbeddedSquash{
+		Basic: Basic{
+			Vstring: "foo",
 		},
+		Vunique: "bar",
 	}
 
-	var result NestedPointer
-	err := Decode(input, &result)
+	result := map[string]interface{}{}
+	config := &DecoderConfig{
+		Squash: true,
+		Result: &result,
+	}
+	decoder, err := NewDecoder(config)
 	if err != nil {
 		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vfoo != "foo" {
-		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
-	}
-
-	if result.Vbar.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
 	}
 
-	if result.Vbar.Vint != 42 {
-		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	if _, ok = result["Basic"]; ok {
+		t.Error("basic should not be present in map")
 	}
 
-	if result.Vbar.Vbool != true {
-		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
+	v, ok = result["Vstring"]
+	if !ok {
+		t.Error("vstring should be present in map")
+	} else if !reflect.DeepEqual(v, "foo") {
+		t.Errorf("vstring value should be 'foo': %#v", v)
 	}
 
-	if result.Vbar.Vextra != "" {
-		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	v, ok = result["Vunique"]
+	if !ok {
+		t.Error("vunique should be present in map")
+	} else if !reflect.DeepEqual(v, "bar") {
+		t.Errorf("vunique value should be 'bar': %#v", v)
 	}
 }
 
-// Test for issue #46.
-func TestNestedTypeInterface(t *testing.T) {
+func TestDecode_EmbeddedSquashConfig_NoTags(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": &map[string]interface{}{
-			"vstring": "foo",
-			"vint":    42,
-			"vbool":   true,
+		"vstring": "foo",
+		"vunique": "bar",
+	}
 
-			"vdata": map[string]interface{}{
-				"vstring": "bar",
-			},
-		},
+	var result Embedded
+	config := &DecoderConfig{
+		Squash: true,
+		Result: &result,
 	}
 
-	var result NestedPointer
-	result.Vbar = new(Basic)
-	result.Vbar.Vdata = new(Basic)
-	err := Decode(input, &result)
+	decoder, err := NewDecoder(config)
 	if err != nil {
-		t.Fatalf("got an err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Vfoo != "foo" {
-		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
 
-	if result.Vbar.Vstring != "foo" {
-		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
 	}
 
-	if result.Vbar.Vint != 42 {
-		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
 	}
+}
 
-	if result.Vbar.Vbool != true {
-		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
-	}
+func TestDecode_EmbeddedPointerSquashConfig_NoTags(t *testing.T) {
+	t.Parallel()
 
-	if result.Vbar.Vextra != "" {
-		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"vunique": "bar",
 	}
 
-	if result.Vbar.Vdata.(*Basic).Vstring != "bar" {
-		t.Errorf("vstring value should be 'bar': %#v", result.Vbar.Vdata.(*Basic).Vstring)
+	var result EmbeddedPointer
+	config := &DecoderConfig{
+		Squash: true,
+		Result: &result,
 	}
-}
 
-func TestSlice(t *testing.T) {
-	t.Parallel()
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	inputStringSlice := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": []string{"foo", "bar", "baz"},
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
 
-	inputStringSlicePointer := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": &[]string{"foo", "bar", "baz"},
+	if result.Basic == nil {
+		t.Fatal("embedded pointer should be allocated")
 	}
 
-	outputStringSlice := &Slice{
-		"foo",
-		[]string{"foo", "bar", "baz"},
+	if result.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vstring)
 	}
 
-	testSliceInput(t, inputStringSlice, outputStringSlice)
-	testSliceInput(t, inputStringSlicePointer, outputStringSlice)
+	if result.Vunique != "bar" {
+		t.Errorf("vunique value should be 'bar': %#v", result.Vunique)
+	}
 }
 
-func TestNotEmptyByteSlice(t *testing.T) {
+func TestDecodeFrom_EmbeddedPointerSquashConfig_NoTags(t *testing.T) {
 	t.Parallel()
 
-	inputByteSlice := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": []byte(`{"bar": "bar"}`),
+	cases := []struct {
+		name     string
+		input    EmbeddedPointer
+		expected map[string]interface{}
+	}{
+		{
+			"allocated pointer",
+			EmbeddedPointer{
+				Basic:   &Basic{Vstring: "foo"},
+				Vunique: "bar",
+			},
+			map[string]interface{}{
+				"Vstring": "foo",
+				"Vunique": "bar",
+			},
+		},
+		{
+			"nil pointer",
+			EmbeddedPointer{
+				Vunique: "bar",
+			},
+			map[string]interface{}{
+				"Vunique": "bar",
+			},
+		},
 	}
 
-	result := SliceOfByte{
-		Vfoo: "another foo",
-		Vbar: []byte(`{"bar": "bar bar bar bar bar bar bar bar"}`),
-	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := map[string]interface{}{}
+			config := &DecoderConfig{
+				Squash: true,
+				Result: &result,
+			}
+			decoder, err := NewDecoder(config)
+			if err != nil {
+				t.Fatalf("got an err: %s", err.Error())
+			}
 
-	err := Decode(inputByteSlice, &result)
-	if err != nil {
-		t.Fatalf("got unexpected error: %s", err)
-	}
+			err = decoder.Decode(tc.input)
+			if err != nil {
+				t.Fatalf("got an err: %s", err.Error())
+			}
 
-	expected := SliceOfByte{
-		Vfoo: "foo",
-		Vbar: []byte(`{"bar": "bar"}`),
-	}
+			if _, ok := result["Basic"]; ok {
+				t.Error("basic should not be present in map")
+			}
 
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("bad: %#v", result)
+			for k, expected := range tc.expected {
+				if v := result[k]; !reflect.DeepEqual(v, expected) {
+					t.Errorf("%s value should be %#v: %#v", k, expected, v)
+				}
+			}
+		})
 	}
 }
 
-func TestInvalidSlice(t *testing.T) {
+func TestDecode_SquashOnNonStructType(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": 42,
+		"InvalidSquashType": 42,
 	}
 
-	result := Slice{}
+	var result SquashOnNonStructType
 	err := Decode(input, &result)
 	if err == nil {
-		t.Errorf("expected failure")
+		t.Fatal("unexpected success decoding invalid squash field type")
+	} else if !strings.Contains(err.Error(), "unsupported type for squash") {
+		t.Fatalf("unexpected error message for invalid squash field type: %s", err)
 	}
 }
 
-func TestSliceOfStruct(t *testing.T) {
+func TestDecode_DecodeHook(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"value": []map[string]interface{}{
-			{"vstring": "one"},
-			{"vstring": "two"},
-		},
-	}
-
-	var result SliceOfStruct
-	err := Decode(input, &result)
-	if err != nil {
-		t.Fatalf("got unexpected error: %s", err)
+		"vint": "WHAT",
 	}
 
-	if len(result.Value) != 2 {
-		t.Fatalf("expected two values, got %d", len(result.Value))
-	}
+	decodeHook := func(from reflect.Kind, to reflect.Kind, v interface{}) (interface{}, error) {
+		if from == reflect.String && to != reflect.String {
+			return 5, nil
+		}
 
-	if result.Value[0].Vstring != "one" {
-		t.Errorf("first value should be 'one', got: %s", result.Value[0].Vstring)
+		return v, nil
 	}
 
-	if result.Value[1].Vstring != "two" {
-		t.Errorf("second value should be 'two', got: %s", result.Value[1].Vstring)
+	var result Basic
+	config := &DecoderConfig{
+		DecodeHook: decodeHook,
+		Result:     &result,
 	}
-}
-
-func TestSliceCornerCases(t *testing.T) {
-	t.Parallel()
 
-	// Input with a map with zero values
-	input := map[string]interface{}{}
-	var resultWeak []Basic
-
-	err := WeakDecode(input, &resultWeak)
+	decoder, err := NewDecoder(config)
 	if err != nil {
-		t.Fatalf("got unexpected error: %s", err)
-	}
-
-	if len(resultWeak) != 0 {
-		t.Errorf("length should be 0")
-	}
-	// Input with more values
-	input = map[string]interface{}{
-		"Vstring": "foo",
+		t.Fatalf("err: %s", err)
 	}
 
-	resultWeak = nil
-	err = WeakDecode(input, &resultWeak)
+	err = decoder.Decode(input)
 	if err != nil {
-		t.Fatalf("got unexpected error: %s", err)
+		t.Fatalf("got an err: %s", err)
 	}
 
-	if resultWeak[0].Vstring != "foo" {
-		t.Errorf("value does not match")
+	if result.Vint != 5 {
+		t.Errorf("vint should be 5: %#v", result.Vint)
 	}
 }
 
-func TestSliceToMap(t *testing.T) {
+func TestDecode_DecodeHookType(t *testing.T) {
 	t.Parallel()
 
-	input := []map[string]interface{}{
-		{
-			"foo": "bar",
-		},
-		{
-			"bar": "baz",
-		},
+	input := map[string]interface{}{
+		"vint": "WHAT",
 	}
 
-	var result map[string]interface{}
-	err := WeakDecode(input, &result)
+	decodeHook := func(from reflect.Type, to reflect.Type, v interface{}) (interface{}, error) {
+		if from.Kind() == reflect.String &&
+			to.Kind() != reflect.String {
+			return 5, nil
+		}
+
+		return v, nil
+	}
+
+	var result Basic
+	config := &DecoderConfig{
+		DecodeHook: decodeHook,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
 	if err != nil {
-		t.Fatalf("got an error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	expected := map[string]interface{}{
-		"foo": "bar",
-		"bar": "baz",
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("bad: %#v", result)
+
+	if result.Vint != 5 {
+		t.Errorf("vint should be 5: %#v", result.Vint)
 	}
 }
 
-func TestArray(t *testing.T) {
+func TestDecodeTo(t *testing.T) {
 	t.Parallel()
 
-	inputStringArray := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": [2]string{"foo", "bar"},
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"vint":    42,
 	}
 
-	inputStringArrayPointer := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": &[2]string{"foo", "bar"},
+	result, err := DecodeTo[Basic](input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
-
-	outputStringArray := &Array{
-		"foo",
-		[2]string{"foo", "bar"},
+	if result.Vstring != "foo" || result.Vint != 42 {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	testArrayInput(t, inputStringArray, outputStringArray)
-	testArrayInput(t, inputStringArrayPointer, outputStringArray)
+	ptr, err := DecodeTo[*Basic](input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if ptr == nil || ptr.Vstring != "foo" || ptr.Vint != 42 {
+		t.Fatalf("bad: %#v", ptr)
+	}
 }
 
-func TestInvalidArray(t *testing.T) {
+func TestDecodeToWithConfig(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": 42,
+		"vstring": 42,
 	}
 
-	result := Array{}
-	err := Decode(input, &result)
+	config := &DecoderConfig{
+		WeaklyTypedInput: true,
+	}
+
+	result, err := DecodeToWithConfig[Basic](input, config)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.Vstring != "42" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if config.Result != nil {
+		t.Fatalf("config should not be modified: %#v", config.Result)
+	}
+
+	if _, err := DecodeToWithConfig[Basic](input, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecodeSlice(t *testing.T) {
+	t.Parallel()
+
+	input := []interface{}{
+		map[string]interface{}{"vstring": "one", "vint": 1},
+		map[string]interface{}{"vstring": "two", "vint": 2},
+	}
+
+	result, err := DecodeSlice[Basic](input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []Basic{{Vstring: "one", Vint: 1}, {Vstring: "two", Vint: 2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	empty, err := DecodeSlice[Basic](nil)
+	if err != nil || empty != nil {
+		t.Fatalf("expected nil result, got %#v, %v", empty, err)
+	}
+}
+
+func TestDecodeSlice_BadElement(t *testing.T) {
+	t.Parallel()
+
+	input := []interface{}{
+		map[string]interface{}{"vstring": "one"},
+		map[string]interface{}{"vstring": "two"},
+		map[string]interface{}{"vint": "three"},
+	}
+
+	result, err := DecodeSlice[Basic](input)
 	if err == nil {
-		t.Errorf("expected failure")
+		t.Fatal("expected error")
+	}
+
+	var derr *DecodeError
+	if !errors.As(err, &derr) || derr.Path != "[2].Vint" {
+		t.Fatalf("bad error: %#v", err)
+	}
+	if len(result) != 3 || result[1].Vstring != "two" {
+		t.Fatalf("other elements should be decoded: %#v", result)
 	}
 }
 
-func TestArrayOfStruct(t *testing.T) {
+func TestDecode_Nil(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"value": []map[string]interface{}{
-			{"vstring": "one"},
-			{"vstring": "two"},
-		},
+	var input interface{}
+	result := Basic{
+		Vstring: "foo",
 	}
 
-	var result ArrayOfStruct
 	err := Decode(input, &result)
 	if err != nil {
-		t.Fatalf("got unexpected error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	if len(result.Value) != 2 {
-		t.Fatalf("expected two values, got %d", len(result.Value))
+	if result.Vstring != "foo" {
+		t.Fatalf("bad: %#v", result.Vstring)
 	}
+}
 
-	if result.Value[0].Vstring != "one" {
-		t.Errorf("first value should be 'one', got: %s", result.Value[0].Vstring)
+func TestDecode_NilInterfaceHook(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"w": "",
 	}
 
-	if result.Value[1].Vstring != "two" {
-		t.Errorf("second value should be 'two', got: %s", result.Value[1].Vstring)
+	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
+		if t.String() == "io.Writer" {
+			return nil, nil
+		}
+
+		return v, nil
+	}
+
+	var result NilInterface
+	config := &DecoderConfig{
+		DecodeHook: decodeHook,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.W != nil {
+		t.Errorf("W should be nil: %#v", result.W)
 	}
 }
 
-func TestArrayToMap(t *testing.T) {
+func TestDecode_NilPointerHook(t *testing.T) {
 	t.Parallel()
 
-	input := []map[string]interface{}{
-		{
-			"foo": "bar",
-		},
-		{
-			"bar": "baz",
-		},
+	input := map[string]interface{}{
+		"value": "",
 	}
 
-	var result map[string]interface{}
-	err := WeakDecode(input, &result)
+	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
+		if typed, ok := v.(string); ok {
+			if typed == "" {
+				return nil, nil
+			}
+		}
+		return v, nil
+	}
+
+	var result NilPointer
+	config := &DecoderConfig{
+		DecodeHook: decodeHook,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
 	if err != nil {
-		t.Fatalf("got an error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	expected := map[string]interface{}{
-		"foo": "bar",
-		"bar": "baz",
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
 	}
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("bad: %#v", result)
+
+	if result.Value != nil {
+		t.Errorf("W should be nil: %#v", result.Value)
 	}
 }
 
-func TestDecodeTable(t *testing.T) {
+func TestDecode_FuncHook(t *testing.T) {
 	t.Parallel()
 
-	// We need to make new types so that we don't get the short-circuit
-	// copy functionality. We want to test the deep copying functionality.
-	type BasicCopy Basic
-	type NestedPointerCopy NestedPointer
-	type MapCopy Map
+	input := map[string]interface{}{
+		"foo": "baz",
+	}
 
-	tests := []struct {
-		name    string
-		in      interface{}
-		target  interface{}
-		out     interface{}
-		wantErr bool
-	}{
-		{
-			"basic struct input",
-			&Basic{
-				Vstring: "vstring",
-				Vint:    2,
-				Vint8:   2,
-				Vint16:  2,
-				Vint32:  2,
-				Vint64:  2,
-				Vuint:   3,
-				Vbool:   true,
-				Vfloat:  4.56,
-				Vextra:  "vextra",
-				vsilent: true,
-				Vdata:   []byte("data"),
-			},
-			&map[string]interface{}{},
-			&map[string]interface{}{
-				"Vstring":     "vstring",
-				"Vint":        2,
-				"Vint8":       int8(2),
-				"Vint16":      int16(2),
-				"Vint32":      int32(2),
-				"Vint64":      int64(2),
-				"Vuint":       uint(3),
-				"Vbool":       true,
-				"Vfloat":      4.56,
-				"Vextra":      "vextra",
-				"Vdata":       []byte("data"),
-				"VjsonInt":    0,
-				"VjsonUint":   uint(0),
-				"VjsonUint64": uint64(0),
-				"VjsonFloat":  0.0,
-				"VjsonNumber": json.Number(""),
-			},
-			false,
-		},
-		{
-			"embedded struct input",
-			&Embedded{
-				Vunique: "vunique",
-				Basic: Basic{
+	decodeHook := func(f, t reflect.Type, v interface{}) (interface{}, error) {
+		if t.Kind() != reflect.Func {
+			return v, nil
+		}
+		val := v.(string)
+		return func() string { return val }, nil
+	}
+
+	var result Func
+	config := &DecoderConfig{
+		DecodeHook: decodeHook,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.Foo() != "baz" {
+		t.Errorf("Foo call result should be 'baz': %s", result.Foo())
+	}
+}
+
+func TestDecode_UnsupportedTypes(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		Foo func() string
+		Ch  chan int
+	}
+
+	var result Target
+	if err := Decode(map[string]interface{}{"foo": nil, "ch": nil}, &result); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if result.Foo != nil || result.Ch != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	err := Decode(map[string]interface{}{"foo": "baz", "ch": 1}, &result)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, expected := range []string{
+		"Foo: cannot decode string into unsupported type func() string",
+		"Ch: cannot decode int into unsupported type chan int",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in error: %s", expected, err)
+		}
+	}
+
+	var p uintptr
+	err = Decode(1, &p)
+	if err == nil || err.Error() != "cannot decode into unsupported type uintptr" {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestDecode_ScalarToSingleField(t *testing.T) {
+	t.Parallel()
+
+	type Port struct {
+		Value int
+		label string
+	}
+
+	type Config struct {
+		Port  Port
+		Ports []Port
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ScalarToSingleField: true,
+		Result:              &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	input := map[string]interface{}{
+		"port":  5,
+		"ports": []interface{}{80, map[string]interface{}{"value": 443}},
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Port.Value != 5 {
+		t.Errorf("port value should be 5: %#v", result.Port)
+	}
+	if !reflect.DeepEqual(result.Ports, []Port{{Value: 80}, {Value: 443}}) {
+		t.Errorf("bad ports: %#v", result.Ports)
+	}
+
+	// Without the option scalars aren't accepted.
+	var port Port
+	if err := Decode(5, &port); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecode_ScalarToSingleFieldMultipleFields(t *testing.T) {
+	t.Parallel()
+
+	type Endpoint struct {
+		Host string
+		Port int
+	}
+
+	var result Endpoint
+	decoder, err := NewDecoder(&DecoderConfig{
+		ScalarToSingleField: true,
+		Result:              &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(5)
+	if err == nil || err.Error() != "expected a map, got 'int'" {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestDecode_ArrayToStructPositional(t *testing.T) {
+	t.Parallel()
+
+	type Addr struct {
+		Host string
+		Port int
+	}
+
+	type Config struct {
+		Listen  Addr
+		Backend Addr
+	}
+
+	input := map[string]interface{}{
+		"listen":  []interface{}{"localhost", 8080},
+		"backend": []interface{}{"db"},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeArrayToStructPositional: true,
+		Result:                        &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Config{
+		Listen:  Addr{Host: "localhost", Port: 8080},
+		Backend: Addr{Host: "db"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	var addr Addr
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeArrayToStructPositional: true,
+		Result:                        &addr,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode([]interface{}{"localhost", 8080, true})
+	if err == nil || !strings.Contains(err.Error(), "expected at most 2 elements") {
+		t.Fatalf("bad err: %v", err)
+	}
+
+	err = decoder.Decode([]interface{}{"localhost", "http"})
+	if err == nil || !strings.Contains(err.Error(), "Port: expected type 'int'") {
+		t.Fatalf("bad err: %v", err)
+	}
+
+	// Without the option, slices can't be decoded into structs.
+	if err := Decode([]interface{}{"localhost", 8080}, &addr); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecode_NonStruct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"foo": "bar",
+		"bar": "baz",
+	}
+
+	var result map[string]string
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result["foo"] != "bar" {
+		t.Fatal("foo is not bar")
+	}
+}
+
+func TestDecode_StructMatch(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vbar": Basic{
+			Vstring: "foo",
+		},
+	}
+
+	var result Nested
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+
+	if result.Vbar.Vstring != "foo" {
+		t.Errorf("bad: %#v", result)
+	}
+}
+
+func TestDecode_TypeConversion(t *testing.T) {
+	input := map[string]interface{}{
+		"IntToFloat":         42,
+		"IntToUint":          42,
+		"IntToBool":          1,
+		"IntToString":        42,
+		"UintToInt":          42,
+		"UintToFloat":        42,
+		"UintToBool":         42,
+		"UintToString":       42,
+		"BoolToInt":          true,
+		"BoolToUint":         true,
+		"BoolToFloat":        true,
+		"BoolToString":       true,
+		"FloatToInt":         42.42,
+		"FloatToUint":        42.42,
+		"FloatToBool":        42.42,
+		"FloatToString":      42.42,
+		"SliceUint8ToString": []uint8("foo"),
+		"StringToSliceUint8": "foo",
+		"ArrayUint8ToString": [3]uint8{'f', 'o', 'o'},
+		"StringToInt":        "42",
+		"StringToUint":       "42",
+		"StringToBool":       "1",
+		"StringToFloat":      "42.42",
+		"StringToStrSlice":   "A",
+		"StringToIntSlice":   "42",
+		"StringToStrArray":   "A",
+		"StringToIntArray":   "42",
+		"SliceToMap":         []interface{}{},
+		"MapToSlice":         map[string]interface{}{},
+		"ArrayToMap":         []interface{}{},
+		"MapToArray":         map[string]interface{}{},
+	}
+
+	expectedResultStrict := TypeConversionResult{
+		IntToFloat:  42.0,
+		IntToUint:   42,
+		UintToInt:   42,
+		UintToFloat: 42,
+		BoolToInt:   0,
+		BoolToUint:  0,
+		BoolToFloat: 0,
+		FloatToInt:  42,
+		FloatToUint: 42,
+	}
+
+	expectedResultWeak := TypeConversionResult{
+		IntToFloat:         42.0,
+		IntToUint:          42,
+		IntToBool:          true,
+		IntToString:        "42",
+		UintToInt:          42,
+		UintToFloat:        42,
+		UintToBool:         true,
+		UintToString:       "42",
+		BoolToInt:          1,
+		BoolToUint:         1,
+		BoolToFloat:        1,
+		BoolToString:       "1",
+		FloatToInt:         42,
+		FloatToUint:        42,
+		FloatToBool:        true,
+		FloatToString:      "42.42",
+		SliceUint8ToString: "foo",
+		StringToSliceUint8: []byte("foo"),
+		ArrayUint8ToString: "foo",
+		StringToInt:        42,
+		StringToUint:       42,
+		StringToBool:       true,
+		StringToFloat:      42.42,
+		StringToStrSlice:   []string{"A"},
+		StringToIntSlice:   []int{42},
+		StringToStrArray:   [1]string{"A"},
+		StringToIntArray:   [1]int{42},
+		SliceToMap:         map[string]interface{}{},
+		MapToSlice:         []interface{}{},
+		ArrayToMap:         map[string]interface{}{},
+		MapToArray:         [1]interface{}{},
+	}
+
+	// Test strict type conversion
+	var resultStrict TypeConversionResult
+	err := Decode(input, &resultStrict)
+	if err == nil {
+		t.Errorf("should return an error")
+	}
+	if !reflect.DeepEqual(resultStrict, expectedResultStrict) {
+		t.Errorf("expected %v, got: %v", expectedResultStrict, resultStrict)
+	}
+
+	// Test weak type conversion
+	var decoder *Decoder
+	var resultWeak TypeConversionResult
+
+	config := &DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           &resultWeak,
+	}
+
+	decoder, err = NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if !reflect.DeepEqual(resultWeak, expectedResultWeak) {
+		t.Errorf("expected \n%#v, got: \n%#v", expectedResultWeak, resultWeak)
+	}
+}
+
+func TestDecode_TypeConversionStructToStruct(t *testing.T) {
+	t.Parallel()
+
+	type Source struct {
+		IntToFloat    int
+		IntToUint     int
+		IntToBool     int
+		IntToString   int
+		UintToInt     uint
+		UintToString  uint
+		BoolToInt     bool
+		BoolToString  bool
+		FloatToInt    float64
+		FloatToString float64
+		StringToInt   string
+		StringToBool  string
+		StringToFloat string
+	}
+
+	input := Source{
+		IntToFloat:    42,
+		IntToUint:     42,
+		IntToBool:     42,
+		IntToString:   42,
+		UintToInt:     42,
+		UintToString:  42,
+		BoolToInt:     true,
+		BoolToString:  true,
+		FloatToInt:    42.42,
+		FloatToString: 42.42,
+		StringToInt:   "42",
+		StringToBool:  "1",
+		StringToFloat: "42.42",
+	}
+
+	var result TypeConversionResult
+	if err := WeakDecode(input, &result); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := TypeConversionResult{
+		IntToFloat:    42.0,
+		IntToUint:     42,
+		IntToBool:     true,
+		IntToString:   "42",
+		UintToInt:     42,
+		UintToString:  "42",
+		BoolToInt:     1,
+		BoolToString:  "1",
+		FloatToInt:    42,
+		FloatToString: "42.42",
+		StringToInt:   42,
+		StringToBool:  true,
+		StringToFloat: 42.42,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %#v, got: %#v", expected, result)
+	}
+
+	// The result matches weakly decoding the equivalent map.
+	var m map[string]interface{}
+	if err := Decode(input, &m); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	var fromMap TypeConversionResult
+	if err := WeakDecode(m, &fromMap); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if !reflect.DeepEqual(result, fromMap) {
+		t.Errorf("expected %#v, got: %#v", fromMap, result)
+	}
+
+	// Without weak typing the mismatched fields are errors.
+	if err := Decode(input, &TypeConversionResult{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecode_DisallowBoolNumericCoercion(t *testing.T) {
+	t.Parallel()
+
+	cases := []map[string]interface{}{
+		{"IntToBool": 1},
+		{"UintToBool": uint(1)},
+		{"FloatToBool": 1.0},
+		{"BoolToInt": true},
+		{"BoolToUint": true},
+		{"BoolToFloat": true},
+	}
+
+	for i, input := range cases {
+		var result TypeConversionResult
+		decoder, err := NewDecoder(&DecoderConfig{
+			WeaklyTypedInput:            true,
+			DisallowBoolNumericCoercion: true,
+			Result:                      &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = decoder.Decode(input)
+		if err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+		if !strings.Contains(err.Error(), "unconvertible type") {
+			t.Fatalf("case %d: bad err: %s", i, err)
+		}
+	}
+
+	input := map[string]interface{}{
+		"IntToString":   42,
+		"StringToInt":   "42",
+		"StringToBool":  "1",
+		"StringToFloat": "42.42",
+		"BoolToString":  true,
+	}
+
+	var result TypeConversionResult
+	decoder, err := NewDecoder(&DecoderConfig{
+		WeaklyTypedInput:            true,
+		DisallowBoolNumericCoercion: true,
+		Result:                      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	expected := TypeConversionResult{
+		IntToString:   "42",
+		StringToInt:   42,
+		StringToBool:  true,
+		StringToFloat: 42.42,
+		BoolToString:  "1",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_ErrorUnused(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "hello",
+		"foo":     "bar",
+	}
+
+	var result Basic
+	config := &DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_ErrorUnused_NotSetable(t *testing.T) {
+	t.Parallel()
+
+	// lowercase vsilent is unexported and cannot be set
+	input := map[string]interface{}{
+		"vsilent": "false",
+	}
+
+	var result Basic
+	config := &DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_UnusedNonStringKeys(t *testing.T) {
+	t.Parallel()
+
+	input := map[interface{}]interface{}{
+		"name": "a",
+		5:      1,
+	}
+
+	var result struct{ Name string }
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Name != "a" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	var md Metadata
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Metadata:    &md,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	var unusedErr *UnusedKeysError
+	if !errors.As(err, &unusedErr) {
+		t.Fatalf("expected UnusedKeysError, got %v", err)
+	}
+	if !reflect.DeepEqual(unusedErr.Keys, []string{"5"}) {
+		t.Fatalf("bad keys: %#v", unusedErr.Keys)
+	}
+}
+
+func TestDecoder_ErrorUnusedNested(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"z":    1,
+		"a":    2,
+		"vbar": map[string]interface{}{
+			"vstring": "bar",
+			"q":       true,
+		},
+	}
+
+	var result Nested
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The extra keys of both structs are reported in one error.
+	err = decoder.Decode(input)
+	var unusedErr *UnusedKeysError
+	if !errors.As(err, &unusedErr) {
+		t.Fatalf("expected UnusedKeysError, got %v", err)
+	}
+	if !reflect.DeepEqual(unusedErr.Keys, []string{"Vbar.q", "a", "z"}) {
+		t.Fatalf("bad keys: %#v", unusedErr.Keys)
+	}
+	if strings.Count(err.Error(), "invalid keys") != 1 {
+		t.Fatalf("expected a single error, got: %s", err)
+	}
+}
+
+func TestDecoder_OnUnused(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo":   "foo",
+		"extra1": 1,
+		"extra2": "two",
+		"vbar": map[string]interface{}{
+			"vstring": "bar",
+			"extra3":  true,
+		},
+	}
+
+	unused := map[string]interface{}{}
+	var result Nested
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		OnUnused: func(path string, value interface{}) error {
+			unused[path] = value
+			return nil
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"extra1":      1,
+		"extra2":      "two",
+		"Vbar.extra3": true,
+	}
+	if !reflect.DeepEqual(unused, expected) {
+		t.Fatalf("bad: %#v", unused)
+	}
+	if result.Vfoo != "foo" || result.Vbar.Vstring != "bar" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_OnUnusedError(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"bad":     1,
+		"worse":   2,
+	}
+
+	var calls int
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		OnUnused: func(path string, value interface{}) error {
+			calls++
+			return errors.New("unexpected key " + path)
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil || !strings.Contains(err.Error(), "unexpected key bad") {
+		t.Fatalf("bad error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("callback should stop after the first error, called %d times", calls)
+	}
+}
+func TestDecoder_ErrorUnset(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "hello",
+		"foo":     "bar",
+	}
+
+	var result Basic
+	config := &DecoderConfig{
+		ErrorUnset: true,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_ErrorUnset_Fields(t *testing.T) {
+	t.Parallel()
+
+	type Embedded struct {
+		Region string
+		Zone   string
+	}
+
+	type Nested struct {
+		Host string
+		Port int
+	}
+
+	type Config struct {
+		Embedded `mapstructure:",squash"`
+		Name     string
+		Ignored  string `mapstructure:"-"`
+		Optional string `mapstructure:"optional,omitempty"`
+		Nested   Nested
+		private  string
+	}
+
+	input := map[string]interface{}{
+		"name":   "foo",
+		"region": "us-east",
+		"nested": map[string]interface{}{
+			"host": "localhost",
+		},
+	}
+
+	var result Config
+	config := &DecoderConfig{
+		ErrorUnset: true,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	derr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+
+	expected := []string{
+		"Nested: unset fields: Port",
+		"unset fields: Zone",
+	}
+	actual := append([]string(nil), derr.Errors...)
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, actual)
+	}
+}
+
+func TestDecoder_DefaultTag(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host    string        `mapstructure:"host,default=localhost"`
+		Port    int           `mapstructure:"port,omitempty,default=8080"`
+		Debug   bool          `mapstructure:"debug,default=true"`
+		Ratio   float64       `mapstructure:"ratio,default=0.5"`
+		Timeout time.Duration `mapstructure:"timeout,default=5s"`
+		Name    string
+	}
+
+	input := map[string]interface{}{
+		"debug": false,
+		"name":  "web",
+	}
+
+	var result Server
+	config := &DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+		ErrorUnset: true,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Server{
+		Host:    "localhost",
+		Port:    8080,
+		Debug:   false,
+		Ratio:   0.5,
+		Timeout: 5 * time.Second,
+		Name:    "web",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, result)
+	}
+}
+
+func TestDecoder_DefaultTagInvalid(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Port int `mapstructure:"port,default=http"`
+	}
+
+	var result Server
+	err := Decode(map[string]interface{}{}, &result)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `port: invalid default "http"`) {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestDecoder_RequiredTag(t *testing.T) {
+	t.Parallel()
+
+	type Auth struct {
+		Token string `mapstructure:"token,required"`
+	}
+
+	type Server struct {
+		Auth `mapstructure:",squash"`
+		Port int    `mapstructure:"port,required"`
+		Host string `mapstructure:"host"`
+	}
+
+	cases := []struct {
+		name  string
+		input map[string]interface{}
+		err   string
+	}{
+		{
+			"all present",
+			map[string]interface{}{"port": 8080, "token": "x"},
+			"",
+		},
+		{
+			"present but zero",
+			map[string]interface{}{"port": 0, "token": ""},
+			"",
+		},
+		{
+			"missing",
+			map[string]interface{}{"token": "x"},
+			"port: required field 'Port' (key 'port') is missing",
+		},
+		{
+			"missing in squashed struct",
+			map[string]interface{}{"port": 8080},
+			"token: required field 'Token' (key 'token') is missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result Server
+			err := Decode(tc.input, &result)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			derr, ok := err.(*Error)
+			if !ok || len(derr.Errors) != 1 || derr.Errors[0] != tc.err {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestDecoder_IgnoreDefaults(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Port int `mapstructure:"port,default=8080"`
+	}
+
+	var result Server
+	config := &DecoderConfig{
+		IgnoreDefaults: true,
+		Result:         &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Port != 0 {
+		t.Fatalf("expected default to be ignored, got %d", result.Port)
+	}
+}
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vother": map[interface{}]interface{}{
+			"foo": "foo",
+			"bar": "bar",
+		},
+	}
+
+	var result Map
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an error: %s", err)
+	}
+
+	if result.Vfoo != "foo" {
+		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	}
+
+	if result.Vother == nil {
+		t.Fatal("vother should not be nil")
+	}
+
+	if len(result.Vother) != 2 {
+		t.Error("vother should have two items")
+	}
+
+	if result.Vother["foo"] != "foo" {
+		t.Errorf("'foo' key should be foo, got: %#v", result.Vother["foo"])
+	}
+
+	if result.Vother["bar"] != "bar" {
+		t.Errorf("'bar' key should be bar, got: %#v", result.Vother["bar"])
+	}
+}
+
+func TestMapMerge(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vother": map[interface{}]interface{}{
+			"foo": "foo",
+			"bar": "bar",
+		},
+	}
+
+	var result Map
+	result.Vother = map[string]string{"hello": "world"}
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an error: %s", err)
+	}
+
+	if result.Vfoo != "foo" {
+		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	}
+
+	expected := map[string]string{
+		"foo":   "foo",
+		"bar":   "bar",
+		"hello": "world",
+	}
+	if !reflect.DeepEqual(result.Vother, expected) {
+		t.Errorf("bad: %#v", result.Vother)
+	}
+}
+
+func TestSyncMap(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Values sync.Map
+	}
+
+	input := map[string]interface{}{
+		"values": map[string]interface{}{
+			"timeout": "5s",
+			"name":    "foo",
+		},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+			if s, ok := data.(string); ok && strings.HasSuffix(s, "s") {
+				return time.ParseDuration(s)
+			}
+			return data, nil
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if v, ok := result.Values.Load("timeout"); !ok || v != 5*time.Second {
+		t.Fatalf("bad timeout: %#v", v)
+	}
+	if v, ok := result.Values.Load("name"); !ok || v != "foo" {
+		t.Fatalf("bad name: %#v", v)
+	}
+
+	var ptr *sync.Map
+	if err := Decode(map[string]interface{}{"foo": "bar"}, &ptr); err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+	if v, ok := ptr.Load("foo"); !ok || v != "bar" {
+		t.Fatalf("bad foo: %#v", v)
+	}
+
+	if err := Decode("foo", new(sync.Map)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMapOfStruct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"value": map[string]interface{}{
+			"foo": map[string]string{"vstring": "one"},
+			"bar": map[string]string{"vstring": "two"},
+		},
+	}
+
+	var result MapOfStruct
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err)
+	}
+
+	if result.Value == nil {
+		t.Fatal("value should not be nil")
+	}
+
+	if len(result.Value) != 2 {
+		t.Error("value should have two items")
+	}
+
+	if result.Value["foo"].Vstring != "one" {
+		t.Errorf("foo value should be 'one', got: %s", result.Value["foo"].Vstring)
+	}
+
+	if result.Value["bar"].Vstring != "two" {
+		t.Errorf("bar value should be 'two', got: %s", result.Value["bar"].Vstring)
+	}
+}
+
+func TestMap_NonStringKeys(t *testing.T) {
+	t.Parallel()
+
+	var ints map[int]string
+	if err := Decode(map[string]interface{}{"1": "a", "42": "b"}, &ints); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ints, map[int]string{1: "a", 42: "b"}) {
+		t.Fatalf("bad: %#v", ints)
+	}
+
+	var bools map[bool]int
+	if err := Decode(map[string]interface{}{"true": 1, "false": 0}, &bools); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(bools, map[bool]int{true: 1, false: 0}) {
+		t.Fatalf("bad: %#v", bools)
+	}
+
+	var strs map[string]string
+	if err := Decode(map[int]string{7: "seven"}, &strs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(strs, map[string]string{"7": "seven"}) {
+		t.Fatalf("bad: %#v", strs)
+	}
+
+	type Key string
+	var named map[Key]interface{}
+	if err := Decode(struct{ Name string }{"foo"}, &named); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(named, map[Key]interface{}{"Name": "foo"}) {
+		t.Fatalf("bad: %#v", named)
+	}
+}
+
+func TestMap_NonStringKeysError(t *testing.T) {
+	t.Parallel()
+
+	var ints map[int]string
+	err := Decode(map[string]interface{}{"x": "a"}, &ints)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "[x]: cannot convert key x to int: cannot parse as int") {
+		t.Fatalf("bad error: %s", err)
+	}
+
+	var fromStruct map[int]interface{}
+	err = Decode(struct{ A int }{1}, &fromStruct)
+	if err == nil || !strings.Contains(err.Error(), "cannot decode struct into map with key type int") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestMap_InterfaceKeysFromStruct(t *testing.T) {
+	t.Parallel()
+
+	type Person struct {
+		Name string
+		Age  int
+	}
+
+	var result map[interface{}]interface{}
+	if err := Decode(Person{Name: "a", Age: 1}, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[interface{}]interface{}{"Name": "a", "Age": 1}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestMap_NonStringKeysLossy(t *testing.T) {
+	t.Parallel()
+
+	inputs := []interface{}{
+		map[string]interface{}{"": "a"},
+		map[string]interface{}{"1.5": "a"},
+		map[float64]interface{}{1.5: "a"},
+	}
+	for _, input := range inputs {
+		var ints map[int]string
+		if err := Decode(input, &ints); err == nil {
+			t.Fatalf("expected error for %#v, got %#v", input, ints)
+		}
+	}
+
+	var ints map[int]string
+	metadata := &Metadata{}
+	decoder, err := NewDecoder(&DecoderConfig{Metadata: metadata, Result: &ints})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[float64]interface{}{2: "a"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ints, map[int]string{2: "a"}) {
+		t.Fatalf("bad: %#v", ints)
+	}
+	if len(metadata.Coercions) != 0 {
+		t.Fatalf("bad coercions: %#v", metadata.Coercions)
+	}
+
+	// Keys that don't parse are still passed to the hooks.
+	var durations map[time.Duration]string
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+		Result:     &durations,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"5s": "a", "10": "b"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(durations, map[time.Duration]string{5 * time.Second: "a", 10: "b"}) {
+		t.Fatalf("bad: %#v", durations)
+	}
+}
+
+func TestNestedType(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+			"vint":    42,
+			"vbool":   true,
+		},
+	}
+
+	var result Nested
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+
+	if result.Vfoo != "foo" {
+		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	}
+
+	if result.Vbar.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	}
+
+	if result.Vbar.Vint != 42 {
+		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	}
+
+	if result.Vbar.Vbool != true {
+		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
+	}
+
+	if result.Vbar.Vextra != "" {
+		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	}
+}
+
+func TestNestedType_IgnoreFields(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+			"vint":    42,
+		},
+	}
+
+	for _, drop := range []bool{false, true} {
+		var md Metadata
+		result := Nested{Vbar: Basic{Vstring: "keep"}}
+		decoder, err := NewDecoder(&DecoderConfig{
+			IgnoreFields:      []string{"Vbar.Vstring"},
+			DropIgnoredFields: drop,
+			Metadata:          &md,
+			Result:            &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result.Vfoo != "foo" || result.Vbar.Vint != 42 {
+			t.Errorf("bad: %#v", result)
+		}
+		if result.Vbar.Vstring != "keep" {
+			t.Errorf("ignored field was decoded: %#v", result.Vbar.Vstring)
+		}
+
+		expectedUnused := []string{"Vbar.vstring"}
+		if drop {
+			expectedUnused = []string{}
+		}
+		if !reflect.DeepEqual(md.Unused, expectedUnused) {
+			t.Errorf("drop %t: bad unused: %#v", drop, md.Unused)
+		}
+	}
+}
+
+type unexportedSecret struct {
+	Name   string
+	secret string
+}
+
+func TestDecoder_FieldSetters(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Nested unexportedSecret
+	}
+
+	input := map[string]interface{}{
+		"nested": map[string]interface{}{
+			"name":   "db",
+			"secret": "hunter2",
+		},
+	}
+
+	var md Metadata
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		AllowUnexportedFields: true,
+		FieldSetters: map[string]func(target, value interface{}) error{
+			"Nested.secret": func(target, value interface{}) error {
+				s, ok := value.(string)
+				if !ok {
+					return errors.New("expected a string")
+				}
+				target.(*unexportedSecret).secret = s
+				return nil
+			},
+		},
+		ErrorUnused: true,
+		Metadata:    &md,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Nested.Name != "db" || result.Nested.secret != "hunter2" {
+		t.Fatalf("bad: %#v", result.Nested)
+	}
+	if !reflect.DeepEqual(md.Keys, []string{"Nested.Name", "Nested.secret", "Nested"}) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	input["nested"] = map[string]interface{}{"secret": 42}
+	err = decoder.Decode(input)
+	if err == nil || !strings.Contains(err.Error(), "Nested.secret: expected a string") {
+		t.Fatalf("bad err: %v", err)
+	}
+
+	// Without AllowUnexportedFields the setter isn't used.
+	result = Config{}
+	input["nested"] = map[string]interface{}{"secret": "hunter2"}
+	decoder, err = NewDecoder(&DecoderConfig{
+		FieldSetters: map[string]func(target, value interface{}) error{
+			"Nested.secret": func(target, value interface{}) error {
+				t.Fatal("setter should not be called")
+				return nil
+			},
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Nested.secret != "" {
+		t.Fatalf("bad: %#v", result.Nested)
+	}
+}
+
+type Box[T any] struct {
+	Value T
+}
+
+func TestNestedType_Generic(t *testing.T) {
+	t.Parallel()
+
+	type Outer struct {
+		Box   Box[int]
+		Names Box[[]string]
+	}
+
+	input := map[string]interface{}{
+		"box":   map[string]interface{}{"value": 7},
+		"names": map[string]interface{}{"value": []string{"a", "b"}},
+	}
+
+	var result Outer
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+
+	if result.Box.Value != 7 {
+		t.Errorf("box value should be 7: %#v", result.Box.Value)
+	}
+	if !reflect.DeepEqual(result.Names.Value, []string{"a", "b"}) {
+		t.Errorf("bad names: %#v", result.Names.Value)
+	}
+
+	type Squashed struct {
+		Box[int] `mapstructure:",squash"`
+	}
+
+	var squashed Squashed
+	if err := Decode(map[string]interface{}{"value": 8}, &squashed); err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+	if squashed.Value != 8 {
+		t.Errorf("squashed value should be 8: %#v", squashed.Value)
+	}
+
+	var m map[string]interface{}
+	if err := Decode(squashed, &m); err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"Value": 8}) {
+		t.Errorf("bad: %#v", m)
+	}
+}
+
+func TestNestedTypePointer(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": &map[string]interface{}{
+			"vstring": "foo",
+			"vint":    42,
+			"vbool":   true,
+		},
+	}
+
+	var result NestedPointer
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+
+	if result.Vfoo != "foo" {
+		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	}
+
+	if result.Vbar.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	}
+
+	if result.Vbar.Vint != 42 {
+		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	}
+
+	if result.Vbar.Vbool != true {
+		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
+	}
+
+	if result.Vbar.Vextra != "" {
+		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	}
+}
+
+// Test for issue #46.
+func TestNestedTypeInterface(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": &map[string]interface{}{
+			"vstring": "foo",
+			"vint":    42,
+			"vbool":   true,
+
+			"vdata": map[string]interface{}{
+				"vstring": "bar",
+			},
+		},
+	}
+
+	var result NestedPointer
+	result.Vbar = new(Basic)
+	result.Vbar.Vdata = new(Basic)
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got an err: %s", err.Error())
+	}
+
+	if result.Vfoo != "foo" {
+		t.Errorf("vfoo value should be 'foo': %#v", result.Vfoo)
+	}
+
+	if result.Vbar.Vstring != "foo" {
+		t.Errorf("vstring value should be 'foo': %#v", result.Vbar.Vstring)
+	}
+
+	if result.Vbar.Vint != 42 {
+		t.Errorf("vint value should be 42: %#v", result.Vbar.Vint)
+	}
+
+	if result.Vbar.Vbool != true {
+		t.Errorf("vbool value should be true: %#v", result.Vbar.Vbool)
+	}
+
+	if result.Vbar.Vextra != "" {
+		t.Errorf("vextra value should be empty: %#v", result.Vbar.Vextra)
+	}
+
+	if result.Vbar.Vdata.(*Basic).Vstring != "bar" {
+		t.Errorf("vstring value should be 'bar': %#v", result.Vbar.Vdata.(*Basic).Vstring)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	t.Parallel()
+
+	inputStringSlice := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": []string{"foo", "bar", "baz"},
+	}
+
+	inputStringSlicePointer := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": &[]string{"foo", "bar", "baz"},
+	}
+
+	outputStringSlice := &Slice{
+		"foo",
+		[]string{"foo", "bar", "baz"},
+	}
+
+	testSliceInput(t, inputStringSlice, outputStringSlice)
+	testSliceInput(t, inputStringSlicePointer, outputStringSlice)
+}
+
+func TestNotEmptyByteSlice(t *testing.T) {
+	t.Parallel()
+
+	inputByteSlice := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": []byte(`{"bar": "bar"}`),
+	}
+
+	result := SliceOfByte{
+		Vfoo: "another foo",
+		Vbar: []byte(`{"bar": "bar bar bar bar bar bar bar bar"}`),
+	}
+
+	err := Decode(inputByteSlice, &result)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	expected := SliceOfByte{
+		Vfoo: "foo",
+		Vbar: []byte(`{"bar": "bar"}`),
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
+	}
+}
+
+func TestInvalidSlice(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": 42,
+	}
+
+	result := Slice{}
+	err := Decode(input, &result)
+	if err == nil {
+		t.Errorf("expected failure")
+	}
+}
+
+func TestSliceGrowExisting(t *testing.T) {
+	t.Parallel()
+
+	input := []map[string]interface{}{
+		{"vstring": "one"},
+		{"vint": 2},
+		{"vstring": "three"},
+	}
+
+	result := []Basic{{Vstring: "existing", Vint: 1}}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	expected := []Basic{
+		{Vstring: "one", Vint: 1},
+		{Vint: 2},
+		{Vstring: "three"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
+	}
+}
+
+func TestSliceOfPointersWithNil(t *testing.T) {
+	t.Parallel()
+
+	input := []interface{}{
+		map[string]interface{}{"vstring": "a"},
+		nil,
+		map[string]interface{}{"vstring": "b"},
+	}
+
+	var result []*Basic
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if len(result) != 3 {
+		t.Fatalf("bad length: %d", len(result))
+	}
+	if result[0] == nil || result[0].Vstring != "a" {
+		t.Errorf("bad: %#v", result[0])
+	}
+	if result[1] != nil {
+		t.Errorf("result[1] should be nil: %#v", result[1])
+	}
+	if result[2] == nil || result[2].Vstring != "b" {
+		t.Errorf("bad: %#v", result[2])
+	}
+
+	// A nil element also clears the pointer in an existing slice.
+	result = []*Basic{{Vstring: "x"}, {Vstring: "y"}, {Vstring: "z"}}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if result[1] != nil {
+		t.Errorf("result[1] should be nil: %#v", result[1])
+	}
+}
+
+func TestSliceOfStruct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"value": []map[string]interface{}{
+			{"vstring": "one"},
+			{"vstring": "two"},
+		},
+	}
+
+	var result SliceOfStruct
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if len(result.Value) != 2 {
+		t.Fatalf("expected two values, got %d", len(result.Value))
+	}
+
+	if result.Value[0].Vstring != "one" {
+		t.Errorf("first value should be 'one', got: %s", result.Value[0].Vstring)
+	}
+
+	if result.Value[1].Vstring != "two" {
+		t.Errorf("second value should be 'two', got: %s", result.Value[1].Vstring)
+	}
+}
+
+func TestSliceCornerCases(t *testing.T) {
+	t.Parallel()
+
+	// Input with a map with zero values
+	input := map[string]interface{}{}
+	var resultWeak []Basic
+
+	err := WeakDecode(input, &resultWeak)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if len(resultWeak) != 0 {
+		t.Errorf("length should be 0")
+	}
+	// Input with more values
+	input = map[string]interface{}{
+		"Vstring": "foo",
+	}
+
+	resultWeak = nil
+	err = WeakDecode(input, &resultWeak)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if resultWeak[0].Vstring != "foo" {
+		t.Errorf("value does not match")
+	}
+}
+
+func TestSliceToMap(t *testing.T) {
+	t.Parallel()
+
+	input := []map[string]interface{}{
+		{
+			"foo": "bar",
+		},
+		{
+			"bar": "baz",
+		},
+	}
+
+	var result map[string]interface{}
+	err := WeakDecode(input, &result)
+	if err != nil {
+		t.Fatalf("got an error: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"foo": "bar",
+		"bar": "baz",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
+	}
+}
+
+func TestArray(t *testing.T) {
+	t.Parallel()
+
+	inputStringArray := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": [2]string{"foo", "bar"},
+	}
+
+	inputStringArrayPointer := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": &[2]string{"foo", "bar"},
+	}
+
+	outputStringArray := &Array{
+		"foo",
+		[2]string{"foo", "bar"},
+	}
+
+	testArrayInput(t, inputStringArray, outputStringArray)
+	testArrayInput(t, inputStringArrayPointer, outputStringArray)
+}
+
+func TestInvalidArray(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": 42,
+	}
+
+	result := Array{}
+	err := Decode(input, &result)
+	if err == nil {
+		t.Errorf("expected failure")
+	}
+}
+
+func TestArrayTooLongForExisting(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vbar": []string{"a", "b", "c"},
+	}
+
+	result := Array{Vbar: [2]string{"x", "y"}}
+	err := Decode(input, &result)
+	if err == nil {
+		t.Fatal("expected failure")
+	}
+	if result.Vbar != [2]string{"x", "y"} {
+		t.Errorf("array should be unchanged: %#v", result.Vbar)
+	}
+}
+
+func TestArrayLength(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input    []string
+		exact    bool
+		expected [2]string
+		err      string
+	}{
+		{[]string{"a"}, false, [2]string{"a", ""}, ""},
+		{[]string{"a", "b"}, false, [2]string{"a", "b"}, ""},
+		{[]string{"a", "b", "c"}, false, [2]string{}, "expected source data to have length less or equal to 2, got 3"},
+		{[]string{"a"}, true, [2]string{}, "expected source data to have length 2, got 1"},
+		{[]string{"a", "b"}, true, [2]string{"a", "b"}, ""},
+		{[]string{"a", "b", "c"}, true, [2]string{}, "expected source data to have length 2, got 3"},
+	}
+
+	for i, tc := range cases {
+		var result Array
+		decoder, err := NewDecoder(&DecoderConfig{
+			ArrayFillExact: tc.exact,
+			Result:         &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = decoder.Decode(map[string]interface{}{"vbar": tc.input})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), "Vbar: "+tc.err) {
+				t.Fatalf("case %d: expected err %q, got %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: err: %s", i, err)
+		}
+		if result.Vbar != tc.expected {
+			t.Fatalf("case %d: expected %#v, got %#v", i, tc.expected, result.Vbar)
+		}
+	}
+}
+
+func TestDecodeIndexedMapToArray(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{"0": "a", "2": "c"}
+
+	var array [4]string
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeIndexedMapToArray: true,
+		Result:                  &array,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if array != [4]string{"a", "", "c", ""} {
+		t.Errorf("bad: %#v", array)
+	}
+
+	var slice []string
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeIndexedMapToArray: true,
+		Result:                  &slice,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(slice, []string{"a", "", "c"}) {
+		t.Errorf("bad: %#v", slice)
+	}
+
+	// Without the option the map isn't accepted.
+	var plain [4]string
+	if err := Decode(input, &plain); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecodeIndexedMapToArray_Error(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input    map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"0": "a", "2": "c"},
+			"index 2 out of range for array of length 2",
+		},
+		{
+			map[string]interface{}{"first": "a"},
+			"cannot use key 'first' as an index",
+		},
+		{
+			map[string]interface{}{"-1": "a"},
+			"cannot use key '-1' as an index",
+		},
+	}
+
+	for i, tc := range cases {
+		var result [2]string
+		decoder, err := NewDecoder(&DecoderConfig{
+			DecodeIndexedMapToArray: true,
+			Result:                  &result,
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		err = decoder.Decode(tc.input)
+		if err == nil {
+			t.Fatalf("case %d: expected error", i)
+		}
+		if !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("case %d: expected %q, got: %s", i, tc.expected, err)
+		}
+	}
+}
+
+func TestDecodeIndexedMapToArray_Limits(t *testing.T) {
+	t.Parallel()
+
+	config := func(result interface{}) *DecoderConfig {
+		return &DecoderConfig{
+			DecodeIndexedMapToArray: true,
+			Result:                  result,
+		}
+	}
+
+	// A single large index can't grow a slice without bound.
+	var slice []string
+	decoder, err := NewDecoder(config(&slice))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = decoder.Decode(map[string]interface{}{"100000000000": "x"})
+	if err == nil || !strings.Contains(err.Error(), "index 100000000000 too large for map with 1 entries") {
+		t.Fatalf("bad error: %v", err)
+	}
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected DecodeError, got %#v", err)
+	}
+
+	// Maps with interface keys, such as from YAML, are accepted.
+	slice = nil
+	decoder, err = NewDecoder(config(&slice))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	input := map[interface{}]interface{}{"0": "a", 2: "c"}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(slice, []string{"a", "", "c"}) {
+		t.Errorf("bad: %#v", slice)
+	}
+
+	var array [2]string
+	decoder, err = NewDecoder(config(&array))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = decoder.Decode(map[interface{}]interface{}{true: "a"})
+	if err == nil || !strings.Contains(err.Error(), "cannot use key 'true' as an index") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+type orderedStub struct {
+	keys   []interface{}
+	values []interface{}
+}
+
+func (o *orderedStub) Set(key, value interface{}) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+type mapItem struct {
+	Key, Value interface{}
+}
+
+func TestDecode_OrderedMap(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Rules orderedStub
+		Other *orderedStub
+	}
+
+	input := map[string]interface{}{
+		"rules": []mapItem{
+			{Key: "zeta", Value: "deny"},
+			{Key: "alpha", Value: "allow"},
+			{Key: "mu", Value: 3},
+		},
+		"other": map[string]interface{}{
+			"b": 2,
+			"a": 1,
+		},
+	}
+
+	var result Config
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expectedKeys := []interface{}{"zeta", "alpha", "mu"}
+	if !reflect.DeepEqual(result.Rules.keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", result.Rules.keys)
+	}
+	expectedValues := []interface{}{"deny", "allow", 3}
+	if !reflect.DeepEqual(result.Rules.values, expectedValues) {
+		t.Fatalf("bad values: %#v", result.Rules.values)
+	}
+
+	if result.Other == nil {
+		t.Fatal("other should not be nil")
+	}
+	if !reflect.DeepEqual(result.Other.keys, []interface{}{"a", "b"}) {
+		t.Fatalf("bad keys: %#v", result.Other.keys)
+	}
+	if !reflect.DeepEqual(result.Other.values, []interface{}{1, 2}) {
+		t.Fatalf("bad values: %#v", result.Other.values)
+	}
+}
+
+func TestDecode_OrderedMapInvalid(t *testing.T) {
+	t.Parallel()
+
+	var result orderedStub
+	err := Decode([]interface{}{"foo"}, &result)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "expected a struct with Key and Value fields") {
+		t.Fatalf("bad err: %s", err)
+	}
+
+	err = Decode("foo", &result)
+	if err == nil || !strings.Contains(err.Error(), "expected a map, got 'string'") {
+		t.Fatalf("bad err: %v", err)
+	}
+}
+
+func TestArrayOfStruct(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"value": []map[string]interface{}{
+			{"vstring": "one"},
+			{"vstring": "two"},
+		},
+	}
+
+	var result ArrayOfStruct
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if len(result.Value) != 2 {
+		t.Fatalf("expected two values, got %d", len(result.Value))
+	}
+
+	if result.Value[0].Vstring != "one" {
+		t.Errorf("first value should be 'one', got: %s", result.Value[0].Vstring)
+	}
+
+	if result.Value[1].Vstring != "two" {
+		t.Errorf("second value should be 'two', got: %s", result.Value[1].Vstring)
+	}
+}
+
+func TestArrayToMap(t *testing.T) {
+	t.Parallel()
+
+	input := []map[string]interface{}{
+		{
+			"foo": "bar",
+		},
+		{
+			"bar": "baz",
+		},
+	}
+
+	var result map[string]interface{}
+	err := WeakDecode(input, &result)
+	if err != nil {
+		t.Fatalf("got an error: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"foo": "bar",
+		"bar": "baz",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("bad: %#v", result)
+	}
+}
+
+func TestDecodeTable(t *testing.T) {
+	t.Parallel()
+
+	// We need to make new types so that we don't get the short-circuit
+	// copy functionality. We want to test the deep copying functionality.
+	type BasicCopy Basic
+	type NestedPointerCopy NestedPointer
+	type MapCopy Map
+
+	tests := []struct {
+		name    string
+		in      interface{}
+		target  interface{}
+		out     interface{}
+		wantErr bool
+	}{
+		{
+			"basic struct input",
+			&Basic{
+				Vstring: "vstring",
+				Vint:    2,
+				Vint8:   2,
+				Vint16:  2,
+				Vint32:  2,
+				Vint64:  2,
+				Vuint:   3,
+				Vbool:   true,
+				Vfloat:  4.56,
+				Vextra:  "vextra",
+				vsilent: true,
+				Vdata:   []byte("data"),
+			},
+			&map[string]interface{}{},
+			&map[string]interface{}{
+				"Vstring":     "vstring",
+				"Vint":        2,
+				"Vint8":       int8(2),
+				"Vint16":      int16(2),
+				"Vint32":      int32(2),
+				"Vint64":      int64(2),
+				"Vuint":       uint(3),
+				"Vbool":       true,
+				"Vfloat":      4.56,
+				"Vextra":      "vextra",
+				"Vdata":       []byte("data"),
+				"VjsonInt":    0,
+				"VjsonUint":   uint(0),
+				"VjsonUint64": uint64(0),
+				"VjsonFloat":  0.0,
+				"VjsonNumber": json.Number(""),
+			},
+			false,
+		},
+		{
+			"embedded struct input",
+			&Embedded{
+				Vunique: "vunique",
+				Basic: Basic{
 					Vstring: "vstring",
 					Vint:    2,
 					Vint8:   2,
@@ -1990,395 +4463,1814 @@ func TestDecodeTable(t *testing.T) {
 				Vdata:   []byte("data"),
 				vsilent: true,
 			},
-			&BasicCopy{},
-			&BasicCopy{
-				Vstring: "vstring",
-				Vint:    2,
-				Vuint:   3,
-				Vbool:   true,
-				Vfloat:  4.56,
-				Vextra:  "vextra",
-				Vdata:   []byte("data"),
+			&BasicCopy{},
+			&BasicCopy{
+				Vstring: "vstring",
+				Vint:    2,
+				Vuint:   3,
+				Vbool:   true,
+				Vfloat:  4.56,
+				Vextra:  "vextra",
+				Vdata:   []byte("data"),
+			},
+			false,
+		},
+		{
+			"struct => struct with pointers",
+			&NestedPointer{
+				Vfoo: "hello",
+				Vbar: nil,
+			},
+			&NestedPointerCopy{},
+			&NestedPointerCopy{
+				Vfoo: "hello",
+			},
+			false,
+		},
+		{
+			"basic pointer to non-pointer",
+			&BasicPointer{
+				Vstring: stringPtr("vstring"),
+				Vint:    intPtr(2),
+				Vuint:   uintPtr(3),
+				Vbool:   boolPtr(true),
+				Vfloat:  floatPtr(4.56),
+				Vdata:   interfacePtr([]byte("data")),
+			},
+			&Basic{},
+			&Basic{
+				Vstring: "vstring",
+				Vint:    2,
+				Vuint:   3,
+				Vbool:   true,
+				Vfloat:  4.56,
+				Vdata:   []byte("data"),
+			},
+			false,
+		},
+		{
+			"slice non-pointer to pointer",
+			&Slice{},
+			&SlicePointer{},
+			&SlicePointer{},
+			false,
+		},
+		{
+			"slice non-pointer to pointer, zero field",
+			&Slice{},
+			&SlicePointer{
+				Vbar: &[]string{"yo"},
+			},
+			&SlicePointer{},
+			false,
+		},
+		{
+			"slice to slice alias",
+			&Slice{},
+			&SliceOfAlias{},
+			&SliceOfAlias{},
+			false,
+		},
+		{
+			"nil map to map",
+			&Map{},
+			&MapCopy{},
+			&MapCopy{},
+			false,
+		},
+		{
+			"nil map to non-empty map",
+			&Map{},
+			&MapCopy{Vother: map[string]string{"foo": "bar"}},
+			&MapCopy{},
+			false,
+		},
+
+		{
+			"slice input - should error",
+			[]string{"foo", "bar"},
+			&map[string]interface{}{},
+			&map[string]interface{}{},
+			true,
+		},
+		{
+			"struct with slice property",
+			&Slice{
+				Vfoo: "vfoo",
+				Vbar: []string{"foo", "bar"},
+			},
+			&map[string]interface{}{},
+			&map[string]interface{}{
+				"Vfoo": "vfoo",
+				"Vbar": []string{"foo", "bar"},
+			},
+			false,
+		},
+		{
+			"struct with empty slice",
+			&map[string]interface{}{
+				"Vbar": []string{},
+			},
+			&Slice{},
+			&Slice{
+				Vbar: []string{},
+			},
+			false,
+		},
+		{
+			"struct with slice of struct property",
+			&SliceOfStruct{
+				Value: []Basic{
+					Basic{
+						Vstring: "vstring",
+						Vint:    2,
+						Vuint:   3,
+						Vbool:   true,
+						Vfloat:  4.56,
+						Vextra:  "vextra",
+						vsilent: true,
+						Vdata:   []byte("data"),
+					},
+				},
+			},
+			&map[string]interface{}{},
+			&map[string]interface{}{
+				"Value": []Basic{
+					Basic{
+						Vstring: "vstring",
+						Vint:    2,
+						Vuint:   3,
+						Vbool:   true,
+						Vfloat:  4.56,
+						Vextra:  "vextra",
+						vsilent: true,
+						Vdata:   []byte("data"),
+					},
+				},
+			},
+			false,
+		},
+		{
+			"struct with map property",
+			&Map{
+				Vfoo:   "vfoo",
+				Vother: map[string]string{"vother": "vother"},
+			},
+			&map[string]interface{}{},
+			&map[string]interface{}{
+				"Vfoo": "vfoo",
+				"Vother": map[string]string{
+					"vother": "vother",
+				}},
+			false,
+		},
+		{
+			"tagged struct",
+			&Tagged{
+				Extra: "extra",
+				Value: "value",
+			},
+			&map[string]string{},
+			&map[string]string{
+				"bar": "extra",
+				"foo": "value",
+			},
+			false,
+		},
+		{
+			"omit tag struct",
+			&struct {
+				Value string `mapstructure:"value"`
+				Omit  string `mapstructure:"-"`
+			}{
+				Value: "value",
+				Omit:  "omit",
+			},
+			&map[string]string{},
+			&map[string]string{
+				"value": "value",
+			},
+			false,
+		},
+		{
+			"decode to wrong map type",
+			&struct {
+				Value string
+			}{
+				Value: "string",
+			},
+			&map[string]int{},
+			&map[string]int{},
+			true,
+		},
+		{
+			"remainder",
+			map[string]interface{}{
+				"A": "hello",
+				"B": "goodbye",
+				"C": "yo",
+			},
+			&Remainder{},
+			&Remainder{
+				A: "hello",
+				Extra: map[string]interface{}{
+					"B": "goodbye",
+					"C": "yo",
+				},
 			},
 			false,
 		},
 		{
-			"struct => struct with pointers",
-			&NestedPointer{
-				Vfoo: "hello",
-				Vbar: nil,
+			"remainder with no extra",
+			map[string]interface{}{
+				"A": "hello",
 			},
-			&NestedPointerCopy{},
-			&NestedPointerCopy{
-				Vfoo: "hello",
+			&Remainder{},
+			&Remainder{
+				A:     "hello",
+				Extra: nil,
 			},
 			false,
 		},
 		{
-			"basic pointer to non-pointer",
-			&BasicPointer{
-				Vstring: stringPtr("vstring"),
-				Vint:    intPtr(2),
-				Vuint:   uintPtr(3),
-				Vbool:   boolPtr(true),
-				Vfloat:  floatPtr(4.56),
-				Vdata:   interfacePtr([]byte("data")),
-			},
-			&Basic{},
-			&Basic{
-				Vstring: "vstring",
-				Vint:    2,
-				Vuint:   3,
-				Vbool:   true,
-				Vfloat:  4.56,
-				Vdata:   []byte("data"),
+			"struct with omitempty tag return non-empty values",
+			&struct {
+				VisibleField interface{} `mapstructure:"visible"`
+				OmitField    interface{} `mapstructure:"omittable,omitempty"`
+			}{
+				VisibleField: nil,
+				OmitField:    "string",
 			},
+			&map[string]interface{}{},
+			&map[string]interface{}{"visible": nil, "omittable": "string"},
 			false,
 		},
 		{
-			"slice non-pointer to pointer",
-			&Slice{},
-			&SlicePointer{},
-			&SlicePointer{},
+			"struct with omitempty tag ignore empty values",
+			&struct {
+				VisibleField interface{} `mapstructure:"visible"`
+				OmitField    interface{} `mapstructure:"omittable,omitempty"`
+			}{
+				VisibleField: nil,
+				OmitField:    nil,
+			},
+			&map[string]interface{}{},
+			&map[string]interface{}{"visible": nil},
 			false,
 		},
-		{
-			"slice non-pointer to pointer, zero field",
-			&Slice{},
-			&SlicePointer{
-				Vbar: &[]string{"yo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Decode(tt.in, tt.target); (err != nil) != tt.wantErr {
+				t.Fatalf("%q: TestMapOutputForStructuredInputs() unexpected error: %s", tt.name, err)
+			}
+
+			if !reflect.DeepEqual(tt.out, tt.target) {
+				t.Fatalf("%q: TestMapOutputForStructuredInputs() expected: %#v, got: %#v", tt.name, tt.out, tt.target)
+			}
+		})
+	}
+}
+
+func TestInvalidType(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": 42,
+	}
+
+	var result Basic
+	err := Decode(input, &result)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	derr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("error should be kind of Error, instead: %#v", err)
+	}
+
+	if derr.Errors[0] !=
+		"Vstring: expected type 'string', got unconvertible type 'int', value: '42'" {
+		t.Errorf("got unexpected error: %s", err)
+	}
+
+	inputNegIntUint := map[string]interface{}{
+		"vuint": -42,
+	}
+
+	err = Decode(inputNegIntUint, &result)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	derr, ok = err.(*Error)
+	if !ok {
+		t.Fatalf("error should be kind of Error, instead: %#v", err)
+	}
+
+	if derr.Errors[0] != "Vuint: -42 overflows uint" {
+		t.Errorf("got unexpected error: %s", err)
+	}
+
+	inputNegFloatUint := map[string]interface{}{
+		"vuint": -42.0,
+	}
+
+	err = Decode(inputNegFloatUint, &result)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	derr, ok = err.(*Error)
+	if !ok {
+		t.Fatalf("error should be kind of Error, instead: %#v", err)
+	}
+
+	if derr.Errors[0] != "Vuint: -42.000000 overflows uint" {
+		t.Errorf("got unexpected error: %s", err)
+	}
+}
+
+func TestDecode_NegativeToUint(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		Vuint  uint
+		Vuint8 uint8
+	}
+
+	cases := []struct {
+		input    map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"vuint": -1}, "Vuint: -1 overflows uint"},
+		{map[string]interface{}{"vuint8": int8(-1)}, "Vuint8: -1 overflows uint8"},
+		{map[string]interface{}{"vuint": -0.5}, "Vuint: -0.500000 overflows uint"},
+		{map[string]interface{}{"vuint": json.Number("-1")}, "Vuint: -1 overflows uint"},
+	}
+
+	for _, weak := range []bool{false, true} {
+		for i, tc := range cases {
+			var result Target
+			decoder, err := NewDecoder(&DecoderConfig{
+				WeaklyTypedInput: weak,
+				Result:           &result,
+			})
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			err = decoder.Decode(tc.input)
+			if err == nil {
+				t.Fatalf("weak %t, case %d: expected error", weak, i)
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("weak %t, case %d: expected %q, got: %s", weak, i, tc.expected, err)
+			}
+		}
+	}
+
+	var result Target
+	err := WeakDecode(map[string]interface{}{"vuint": "-1"}, &result)
+	if err == nil || !strings.Contains(err.Error(), "Vuint: -1 overflows uint") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+			"Vuint":   42,
+			"vsilent": "false",
+			"foo":     "bar",
+		},
+		"bar": "nil",
+	}
+
+	var md Metadata
+	var result Nested
+
+	err := DecodeMetadata(input, &result, &md)
+	if err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+
+	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(md.Keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	expectedUnused := []string{"Vbar.foo", "Vbar.vsilent", "bar"}
+	sort.Strings(md.Unused)
+	if !reflect.DeepEqual(md.Unused, expectedUnused) {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+
+	type testResult struct {
+		Vfoo string
+		Vbar BasicPointer
+	}
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+			"Vuint":   42,
+			"vsilent": "false",
+			"foo":     "bar",
+		},
+		"bar": "nil",
+	}
+
+	var md Metadata
+	var result testResult
+	config := &DecoderConfig{
+		Metadata: &md,
+		Result:   &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+
+	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(md.Keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	expectedUnused := []string{"Vbar.foo", "Vbar.vsilent", "bar"}
+	sort.Strings(md.Unused)
+	if !reflect.DeepEqual(md.Unused, expectedUnused) {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+
+	expectedUnset := []string{
+		"Vbar.Vbool", "Vbar.Vdata", "Vbar.Vextra", "Vbar.Vfloat", "Vbar.Vint",
+		"Vbar.VjsonFloat", "Vbar.VjsonInt", "Vbar.VjsonNumber"}
+	sort.Strings(md.Unset)
+	if !reflect.DeepEqual(md.Unset, expectedUnset) {
+		t.Fatalf("bad unset: %#v", md.Unset)
+	}
+}
+
+func TestMetadata_Unset(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Vstring string
+		Vint    int
+	}
+
+	type Outer struct {
+		Inner
+	}
+
+	type testResult struct {
+		Outer   `mapstructure:",squash"`
+		Vfoo    string
+		Vnested struct {
+			Vinner Inner
+			Vbool  bool
+		}
+	}
+
+	input := map[string]interface{}{
+		"inner": map[string]interface{}{
+			"vstring": "foo",
+		},
+		"vnested": map[string]interface{}{
+			"vinner": map[string]interface{}{
+				"vint": 42,
 			},
-			&SlicePointer{},
-			false,
 		},
+	}
+
+	var md Metadata
+	var result testResult
+	if err := DecodeMetadata(input, &result, &md); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expectedUnset := []string{
+		"Inner.Vint", "Vfoo", "Vnested.Vbool", "Vnested.Vinner.Vstring"}
+	sort.Strings(md.Unset)
+	if !reflect.DeepEqual(md.Unset, expectedUnset) {
+		t.Fatalf("bad unset: %#v", md.Unset)
+	}
+}
+
+func TestMetadata_DecodeMerge(t *testing.T) {
+	t.Parallel()
+
+	type testResult struct {
+		Vfoo    string
+		Vbar    string
+		Vnested struct {
+			Vint  int
+			Vbool bool
+		}
+	}
+
+	var md Metadata
+	var result testResult
+	decoder, err := NewDecoder(&DecoderConfig{
+		Metadata: &md,
+		Result:   &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	inputs := []map[string]interface{}{
 		{
-			"slice to slice alias",
-			&Slice{},
-			&SliceOfAlias{},
-			&SliceOfAlias{},
-			false,
+			"vfoo":    "foo",
+			"vnested": map[string]interface{}{"vint": 42},
+			"extra":   "x",
 		},
 		{
-			"nil map to map",
-			&Map{},
-			&MapCopy{},
-			&MapCopy{},
-			false,
+			"vfoo":  "bar",
+			"vbar":  "baz",
+			"extra": "y",
 		},
-		{
-			"nil map to non-empty map",
-			&Map{},
-			&MapCopy{Vother: map[string]string{"foo": "bar"}},
-			&MapCopy{},
-			false,
+	}
+	for _, input := range inputs {
+		if err := decoder.DecodeMerge(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if result.Vfoo != "bar" || result.Vbar != "baz" || result.Vnested.Vint != 42 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	expectedKeys := []string{"Vbar", "Vfoo", "Vnested", "Vnested.Vint"}
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(md.Keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	if !reflect.DeepEqual(md.Unused, []string{"extra"}) {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+
+	if !reflect.DeepEqual(md.Unset, []string{"Vnested.Vbool"}) {
+		t.Fatalf("bad unset: %#v", md.Unset)
+	}
+}
+
+func TestMetadata_Coercions(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": 42,
+		"vint":    42.9,
+		"vint8":   int8(7),
+		"vbool":   "true",
+		"vfloat":  42,
+	}
+
+	var md Metadata
+	var result Basic
+	if err := WeakDecodeMetadata(input, &result, &md); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"Vbool: string(true) -> bool(true)",
+		"Vint: float64(42.9) -> int(42)",
+		"Vstring: int(42) -> string(42)",
+	}
+	sort.Strings(md.Coercions)
+	if !reflect.DeepEqual(md.Coercions, expected) {
+		t.Fatalf("bad coercions: %#v", md.Coercions)
+	}
+}
+
+func TestDecode_NestedRemain(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Name  string
+		Extra map[string]interface{} `mapstructure:",remain"`
+	}
+
+	type Outer struct {
+		Inner Inner
+		Extra map[string]interface{} `mapstructure:",remain"`
+	}
+
+	input := map[string]interface{}{
+		"inner": map[string]interface{}{
+			"name":  "foo",
+			"color": "red",
+		},
+		"size": 42,
+	}
+
+	var md Metadata
+	var result Outer
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Metadata:    &md,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Outer{
+		Inner: Inner{
+			Name:  "foo",
+			Extra: map[string]interface{}{"color": "red"},
 		},
+		Extra: map[string]interface{}{"size": 42},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	if len(md.Unused) != 0 {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+
+	for _, key := range []string{"Extra[size]", "Inner.Extra[color]"} {
+		found := false
+		for _, k := range md.Keys {
+			found = found || k == key
+		}
+		if !found {
+			t.Fatalf("missing key %q: %#v", key, md.Keys)
+		}
+	}
+}
+
+func TestDecode_TypedRemain(t *testing.T) {
+	t.Parallel()
+
+	type Limits struct {
+		Name  string
+		Other map[string]int `mapstructure:",remain"`
+	}
+
+	input := map[string]interface{}{
+		"name":  "quota",
+		"cpu":   4,
+		"mem":   uint8(16),
+		"disks": "2",
+	}
+
+	var result Limits
+	decoder, err := NewDecoder(&DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Limits{
+		Name:  "quota",
+		Other: map[string]int{"cpu": 4, "mem": 16, "disks": 2},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	input["disks"] = "two"
+	err = Decode(input, &Limits{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "Other[disks]: expected type 'int'") {
+		t.Fatalf("bad err: %s", err)
+	}
+}
+
+func TestMetadata_Embedded(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"vunique": "bar",
+	}
+
+	var md Metadata
+	var result EmbeddedSquash
+	config := &DecoderConfig{
+		Metadata: &md,
+		Result:   &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+
+	expectedKeys := []string{"Vstring", "Vunique"}
+
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(md.Keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	expectedUnused := []string{}
+	if !reflect.DeepEqual(md.Unused, expectedUnused) {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+}
+
+func TestNonPtrValue(t *testing.T) {
+	t.Parallel()
+
+	err := Decode(map[string]interface{}{}, Basic{})
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	if err.Error() != "result must be a pointer" {
+		t.Errorf("got unexpected error: %s", err)
+	}
+}
+
+func TestTagged(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"foo": "bar",
+		"bar": "value",
+	}
+
+	var result Tagged
+	err := Decode(input, &result)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Value != "bar" {
+		t.Errorf("value should be 'bar', got: %#v", result.Value)
+	}
+
+	if result.Extra != "value" {
+		t.Errorf("extra should be 'value', got: %#v", result.Extra)
+	}
+}
+
+func TestWeakDecode(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"foo": "4",
+		"bar": "value",
+	}
+
+	var result struct {
+		Foo int
+		Bar string
+	}
+
+	if err := WeakDecode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Foo != 4 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result.Bar != "value" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestWeakDecodeMetadata(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"foo":        "4",
+		"bar":        "value",
+		"unused":     "value",
+		"unexported": "value",
+	}
 
+	var md Metadata
+	var result struct {
+		Foo        int
+		Bar        string
+		unexported string
+	}
+
+	if err := WeakDecodeMetadata(input, &result, &md); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Foo != 4 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result.Bar != "value" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	expectedKeys := []string{"Bar", "Foo"}
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(md.Keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+
+	expectedUnused := []string{"unexported", "unused"}
+	sort.Strings(md.Unused)
+	if !reflect.DeepEqual(md.Unused, expectedUnused) {
+		t.Fatalf("bad unused: %#v", md.Unused)
+	}
+}
+
+func TestDecode_StructTaggedWithOmitempty_OmitEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	input := &StructWithOmitEmpty{}
+
+	var emptySlice []interface{}
+	var emptyMap map[string]interface{}
+	var emptyNested *Nested
+	expected := &map[string]interface{}{
+		"visible-string": "",
+		"visible-int":    0,
+		"visible-float":  0.0,
+		"visible-slice":  emptySlice,
+		"visible-map":    emptyMap,
+		"visible-nested": emptyNested,
+	}
+
+	actual := &map[string]interface{}{}
+	Decode(input, actual)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	}
+}
+
+func TestDecode_StructTaggedWithOmitempty_KeepNonEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	input := &StructWithOmitEmpty{
+		VisibleStringField: "",
+		OmitStringField:    "string",
+		VisibleIntField:    0,
+		OmitIntField:       1,
+		VisibleFloatField:  0.0,
+		OmitFloatField:     1.0,
+		VisibleSliceField:  nil,
+		OmitSliceField:     []interface{}{1},
+		VisibleMapField:    nil,
+		OmitMapField:       map[string]interface{}{"k": "v"},
+		NestedField:        nil,
+		OmitNestedField:    &Nested{},
+	}
+
+	var emptySlice []interface{}
+	var emptyMap map[string]interface{}
+	var emptyNested *Nested
+	expected := &map[string]interface{}{
+		"visible-string":   "",
+		"omittable-string": "string",
+		"visible-int":      0,
+		"omittable-int":    1,
+		"visible-float":    0.0,
+		"omittable-float":  1.0,
+		"visible-slice":    emptySlice,
+		"omittable-slice":  []interface{}{1},
+		"visible-map":      emptyMap,
+		"omittable-map":    map[string]interface{}{"k": "v"},
+		"visible-nested":   emptyNested,
+		"omittable-nested": &Nested{},
+	}
+
+	actual := &map[string]interface{}{}
+	Decode(input, actual)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	}
+}
+
+func TestDecode_StructTaggedWithOmitzero(t *testing.T) {
+	t.Parallel()
+
+	type Source struct {
+		CreatedAt time.Time  `mapstructure:"created_at,omitzero"`
+		UpdatedAt *time.Time `mapstructure:"updated_at,omitzero"`
+		Count     int        `mapstructure:"count,omitzero"`
+		Tags      []string   `mapstructure:"tags,omitzero"`
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		input Source
+		keys  []string
+	}{
 		{
-			"slice input - should error",
-			[]string{"foo", "bar"},
-			&map[string]interface{}{},
-			&map[string]interface{}{},
-			true,
-		},
-		{
-			"struct with slice property",
-			&Slice{
-				Vfoo: "vfoo",
-				Vbar: []string{"foo", "bar"},
-			},
-			&map[string]interface{}{},
-			&map[string]interface{}{
-				"Vfoo": "vfoo",
-				"Vbar": []string{"foo", "bar"},
-			},
-			false,
-		},
-		{
-			"struct with empty slice",
-			&map[string]interface{}{
-				"Vbar": []string{},
-			},
-			&Slice{},
-			&Slice{
-				Vbar: []string{},
-			},
-			false,
+			"zero values are omitted",
+			Source{},
+			[]string{},
 		},
 		{
-			"struct with slice of struct property",
-			&SliceOfStruct{
-				Value: []Basic{
-					Basic{
-						Vstring: "vstring",
-						Vint:    2,
-						Vuint:   3,
-						Vbool:   true,
-						Vfloat:  4.56,
-						Vextra:  "vextra",
-						vsilent: true,
-						Vdata:   []byte("data"),
-					},
-				},
-			},
-			&map[string]interface{}{},
-			&map[string]interface{}{
-				"Value": []Basic{
-					Basic{
-						Vstring: "vstring",
-						Vint:    2,
-						Vuint:   3,
-						Vbool:   true,
-						Vfloat:  4.56,
-						Vextra:  "vextra",
-						vsilent: true,
-						Vdata:   []byte("data"),
-					},
-				},
+			"non-zero values are kept",
+			Source{
+				CreatedAt: created,
+				UpdatedAt: &created,
+				Count:     1,
+				Tags:      []string{},
 			},
-			false,
+			[]string{"count", "created_at", "tags", "updated_at"},
 		},
 		{
-			"struct with map property",
-			&Map{
-				Vfoo:   "vfoo",
-				Vother: map[string]string{"vother": "vother"},
+			"pointer to zero time is omitted",
+			Source{
+				UpdatedAt: &time.Time{},
 			},
-			&map[string]interface{}{},
-			&map[string]interface{}{
-				"Vfoo": "vfoo",
-				"Vother": map[string]string{
-					"vother": "vother",
-				}},
-			false,
+			[]string{},
 		},
-		{
-			"tagged struct",
-			&Tagged{
-				Extra: "extra",
-				Value: "value",
-			},
-			&map[string]string{},
-			&map[string]string{
-				"bar": "extra",
-				"foo": "value",
-			},
-			false,
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := map[string]interface{}{}
+			if err := Decode(tc.input, &actual); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			keys := make([]string, 0, len(actual))
+			for k := range actual {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			if !reflect.DeepEqual(keys, tc.keys) {
+				t.Fatalf("expected keys %#v, got %#v", tc.keys, keys)
+			}
+		})
+	}
+}
+
+func TestDecode_mapToStruct(t *testing.T) {
+	type Target struct {
+		String    string
+		StringPtr *string
+	}
+
+	expected := Target{
+		String: "hello",
+	}
+
+	var target Target
+	err := Decode(map[string]interface{}{
+		"string":    "hello",
+		"StringPtr": "goodbye",
+	}, &target)
+	if err != nil {
+		t.Fatalf("got error: %s", err)
+	}
+
+	// Pointers fail reflect test so do those manually
+	if target.StringPtr == nil || *target.StringPtr != "goodbye" {
+		t.Fatalf("bad: %#v", target)
+	}
+	target.StringPtr = nil
+
+	if !reflect.DeepEqual(target, expected) {
+		t.Fatalf("bad: %#v", target)
+	}
+}
+
+func TestDecoder_MatchName(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		FirstMatch  string `mapstructure:"first_match"`
+		SecondMatch string
+		NoMatch     string `mapstructure:"no_match"`
+	}
+
+	input := map[string]interface{}{
+		"first_match": "foo",
+		"SecondMatch": "bar",
+		"NO_MATCH":    "baz",
+	}
+
+	expected := Target{
+		FirstMatch:  "foo",
+		SecondMatch: "bar",
+	}
+
+	var actual Target
+	config := &DecoderConfig{
+		Result: &actual,
+		MatchName: func(mapKey, fieldName string) bool {
+			return mapKey == fieldName
 		},
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	}
+}
+
+func TestDecoder_CaseInsensitive(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		Vstring string
+		Vtagged string `mapstructure:"ünïcode"`
+	}
+
+	cases := []struct {
+		input    map[string]interface{}
+		expected Target
+		err      string
+	}{
 		{
-			"omit tag struct",
-			&struct {
-				Value string `mapstructure:"value"`
-				Omit  string `mapstructure:"-"`
-			}{
-				Value: "value",
-				Omit:  "omit",
-			},
-			&map[string]string{},
-			&map[string]string{
-				"value": "value",
-			},
-			false,
+			map[string]interface{}{"VSTRING": "x", "ÜNÏCODE": "y"},
+			Target{Vstring: "x", Vtagged: "y"},
+			"",
 		},
 		{
-			"decode to wrong map type",
-			&struct {
-				Value string
-			}{
-				Value: "string",
-			},
-			&map[string]int{},
-			&map[string]int{},
-			true,
+			map[string]interface{}{"Vstring": "exact", "VSTRING": "x", "vstring": "y"},
+			Target{Vstring: "exact"},
+			"",
 		},
 		{
-			"remainder",
-			map[string]interface{}{
-				"A": "hello",
-				"B": "goodbye",
-				"C": "yo",
-			},
-			&Remainder{},
-			&Remainder{
-				A: "hello",
-				Extra: map[string]interface{}{
-					"B": "goodbye",
-					"C": "yo",
-				},
-			},
-			false,
+			map[string]interface{}{"VSTRING": "x", "vstring": "y"},
+			Target{},
+			"Vstring: ambiguous keys: VSTRING, vstring",
 		},
+	}
+
+	for i, tc := range cases {
+		var result Target
+		decoder, err := NewDecoder(&DecoderConfig{
+			CaseInsensitive: true,
+			// CaseInsensitive takes precedence over MatchName.
+			MatchName: func(mapKey, fieldName string) bool { return mapKey == fieldName },
+			Result:    &result,
+		})
+		if err != nil {
+			t.Fatalf("case %d: err: %s", i, err)
+		}
+
+		err = decoder.Decode(tc.input)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("case %d: expected error %q, got: %v", i, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: err: %s", i, err)
+		}
+		if result != tc.expected {
+			t.Fatalf("case %d: bad: %#v", i, result)
+		}
+	}
+	// Fields whose names fold to the same key.
+	type Folded struct {
+		Vstring string
+		VString string
+	}
+
+	foldedCases := []struct {
+		input    map[string]interface{}
+		expected Folded
+		err      string
+	}{
 		{
-			"remainder with no extra",
-			map[string]interface{}{
-				"A": "hello",
-			},
-			&Remainder{},
-			&Remainder{
-				A:     "hello",
-				Extra: nil,
-			},
-			false,
+			map[string]interface{}{"Vstring": "x"},
+			Folded{Vstring: "x"},
+			"",
 		},
 		{
-			"struct with omitempty tag return non-empty values",
-			&struct {
-				VisibleField interface{} `mapstructure:"visible"`
-				OmitField    interface{} `mapstructure:"omittable,omitempty"`
-			}{
-				VisibleField: nil,
-				OmitField:    "string",
-			},
-			&map[string]interface{}{},
-			&map[string]interface{}{"visible": nil, "omittable": "string"},
-			false,
+			map[string]interface{}{"Vstring": "x", "VString": "y"},
+			Folded{Vstring: "x", VString: "y"},
+			"",
 		},
 		{
-			"struct with omitempty tag ignore empty values",
-			&struct {
-				VisibleField interface{} `mapstructure:"visible"`
-				OmitField    interface{} `mapstructure:"omittable,omitempty"`
-			}{
-				VisibleField: nil,
-				OmitField:    nil,
-			},
-			&map[string]interface{}{},
-			&map[string]interface{}{"visible": nil},
-			false,
+			map[string]interface{}{"VSTRING": "x"},
+			Folded{},
+			"ambiguous keys: VSTRING matches fields VString, Vstring",
+		},
+	}
+
+	for i, tc := range foldedCases {
+		var result Folded
+		decoder, err := NewDecoder(&DecoderConfig{
+			CaseInsensitive: true,
+			Result:          &result,
+		})
+		if err != nil {
+			t.Fatalf("folded case %d: err: %s", i, err)
+		}
+
+		err = decoder.Decode(tc.input)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("folded case %d: expected error %q, got: %v", i, tc.err, err)
+			}
+			if strings.Count(err.Error(), "ambiguous keys") != 1 {
+				t.Fatalf("folded case %d: expected one error, got: %s", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("folded case %d: err: %s", i, err)
+		}
+		if result != tc.expected {
+			t.Fatalf("folded case %d: bad: %#v", i, result)
+		}
+	}
+}
+
+func TestDecoder_CaseInsensitiveOff(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		Name string
+	}
+
+	// Without CaseInsensitive, MatchName picks one of the matching keys.
+	var result Target
+	input := map[string]interface{}{"NAME": "x", "nAmE": "x"}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Name != "x" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_DecodeKeyFunc(t *testing.T) {
+	type Target struct {
+		FirstName string
+		LastName  string
+		UserID    int `mapstructure:"id"`
+	}
+
+	input := map[string]interface{}{
+		"first_name": "Jane",
+		"last_name":  "Doe",
+		"id":         42,
+		"UserID":     7,
+	}
+
+	snakeCase := func(fieldName string) string {
+		var b strings.Builder
+		for i, r := range fieldName {
+			if i > 0 && r >= 'A' && r <= 'Z' {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		}
+		return strings.ToLower(b.String())
+	}
+
+	var result Target
+	config := &DecoderConfig{
+		DecodeKeyFunc: snakeCase,
+		Result:        &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Target{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		UserID:    42,
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Fatalf("Decode() expected: %#v\ngot: %#v", expected, result)
+	}
+}
+
+func TestDecoder_Reuse(t *testing.T) {
+	t.Parallel()
+
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		input := map[string]interface{}{
+			"vint": strconv.Itoa(i),
+		}
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if result.Vint != i {
+			t.Fatalf("expected %d, got %d", i, result.Vint)
+		}
+	}
+}
+
+func TestDecoder_Clone(t *testing.T) {
+	t.Parallel()
+
+	var md Metadata
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		WeaklyTypedInput: true,
+		Metadata:         &md,
+		Result:           &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := decoder.Clone(result); err == nil {
+		t.Fatal("expected error for non-pointer result")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Basic, 10)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			clone, err := decoder.Clone(&results[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			errs[i] = clone.Decode(map[string]interface{}{
+				"vint": strconv.Itoa(i),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("%d: err: %s", i, errs[i])
+		}
+		if results[i].Vint != i {
+			t.Fatalf("%d: expected %d, got %d", i, i, results[i].Vint)
+		}
+	}
+
+	if len(md.Keys) != 0 {
+		t.Fatalf("clones should not collect metadata: %#v", md.Keys)
+	}
+}
+
+func TestDecoderConfig_Clone(t *testing.T) {
+	t.Parallel()
+
+	base := &DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+	}
+
+	strict := base.Clone()
+	strict.ErrorUnused = true
+
+	if base.ErrorUnused {
+		t.Fatal("base config should not be changed")
+	}
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"extra":   "bar",
+	}
+
+	var lenient Basic
+	config := base.Clone()
+	config.Result = &lenient
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var result Basic
+	strict.Result = &result
+	decoder, err = NewDecoder(strict)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err == nil {
+		t.Fatal("expected error for unused key")
+	}
+
+	if base.Result != nil {
+		t.Fatalf("base config should not be changed: %#v", base.Result)
+	}
+}
+
+func TestDecoder_Reset(t *testing.T) {
+	t.Parallel()
+
+	var md Metadata
+	var first Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		Metadata: &md,
+		Result:   &first,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := []*Basic{&first, {}, {}}
+	var keys [][]string
+	for i, result := range results {
+		if i > 0 {
+			if err := decoder.Reset(result); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+
+		input := map[string]interface{}{"vstring": "foo" + strconv.Itoa(i)}
+		if i == 1 {
+			input = map[string]interface{}{"vint": 1}
+		}
+		if err := decoder.Decode(input); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		keys = append(keys, md.Keys)
+	}
+
+	// Metadata kept from earlier calls isn't overwritten by Reset.
+	expectedKeys := [][]string{{"Vstring"}, {"Vint"}, {"Vstring"}}
+	if !reflect.DeepEqual(keys, expectedKeys) {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+
+	if first.Vstring != "foo0" || results[1].Vint != 1 || results[2].Vstring != "foo2" {
+		t.Fatalf("bad results: %#v, %#v, %#v", first, *results[1], *results[2])
+	}
+
+	if err := decoder.Reset(Basic{}); err == nil {
+		t.Fatal("expected error for non-pointer result")
+	}
+}
+
+type notifier interface {
+	notify() string
+}
+
+type emailNotifier struct {
+	Type    string
+	Address string
+}
+
+func (n emailNotifier) notify() string { return "email:" + n.Address }
+
+type smsNotifier struct {
+	Type   string
+	Number string
+}
+
+func (n *smsNotifier) notify() string { return "sms:" + n.Number }
+
+func TestDecoder_TypeResolver(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Notifiers []notifier
+		Primary   notifier
+		Extra     interface{}
+	}
+
+	input := map[string]interface{}{
+		"notifiers": []interface{}{
+			map[string]interface{}{"type": "email", "address": "a@example.com"},
+			map[string]interface{}{"type": "sms", "number": "555"},
 		},
+		"primary": map[string]interface{}{"type": "sms", "number": "123"},
+		"extra":   map[string]interface{}{"type": "unknown"},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := Decode(tt.in, tt.target); (err != nil) != tt.wantErr {
-				t.Fatalf("%q: TestMapOutputForStructuredInputs() unexpected error: %s", tt.name, err)
+	var result Config
+	config := &DecoderConfig{
+		TypeResolver: func(input map[string]interface{}) (reflect.Type, bool) {
+			switch input["type"] {
+			case "email":
+				return reflect.TypeOf(emailNotifier{}), true
+			case "sms":
+				return reflect.TypeOf(&smsNotifier{}), true
 			}
+			return nil, false
+		},
+		Result: &result,
+	}
 
-			if !reflect.DeepEqual(tt.out, tt.target) {
-				t.Fatalf("%q: TestMapOutputForStructuredInputs() expected: %#v, got: %#v", tt.name, tt.out, tt.target)
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(result.Notifiers) != 2 {
+		t.Fatalf("bad: %#v", result.Notifiers)
+	}
+	if v := result.Notifiers[0].notify(); v != "email:a@example.com" {
+		t.Fatalf("bad: %s", v)
+	}
+	if v := result.Notifiers[1].notify(); v != "sms:555" {
+		t.Fatalf("bad: %s", v)
+	}
+	if v := result.Primary.notify(); v != "sms:123" {
+		t.Fatalf("bad: %s", v)
+	}
+	if !reflect.DeepEqual(result.Extra, map[string]interface{}{"type": "unknown"}) {
+		t.Fatalf("bad: %#v", result.Extra)
+	}
+}
+
+func TestDecoder_TypeResolverNotAssignable(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Primary notifier
+	}
+
+	input := map[string]interface{}{
+		"primary": map[string]interface{}{"type": "sms", "number": "123"},
+	}
+
+	var result Config
+	config := &DecoderConfig{
+		TypeResolver: func(input map[string]interface{}) (reflect.Type, bool) {
+			return reflect.TypeOf(smsNotifier{}), true
+		},
+		Result: &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_TypeResolverSliceOfInterfaces(t *testing.T) {
+	t.Parallel()
+
+	input := []interface{}{
+		map[string]interface{}{"kind": "email", "address": "a@example.com"},
+		map[string]interface{}{"kind": "sms", "number": "555"},
+		map[string]interface{}{"kind": "unknown"},
+		"plain",
+	}
+
+	var result []interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		TypeResolver: func(input map[string]interface{}) (reflect.Type, bool) {
+			switch input["kind"] {
+			case "email":
+				return reflect.TypeOf(emailNotifier{}), true
+			case "sms":
+				return reflect.TypeOf(&smsNotifier{}), true
 			}
-		})
+			return nil, false
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []interface{}{
+		emailNotifier{Address: "a@example.com"},
+		&smsNotifier{Number: "555"},
+		map[string]interface{}{"kind": "unknown"},
+		"plain",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestInvalidType(t *testing.T) {
+type prefixWriter struct {
+	Prefix string
+	out    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.out = append(w.out, w.Prefix...)
+	w.out = append(w.out, p...)
+	return len(p), nil
+}
+
+func TestDecoder_DefaultInterfaceTypes(t *testing.T) {
 	t.Parallel()
 
 	input := map[string]interface{}{
-		"vstring": 42,
+		"w": map[string]interface{}{"prefix": "> "},
 	}
 
-	var result Basic
-	err := Decode(input, &result)
-	if err == nil {
-		t.Fatal("error should exist")
+	var result NilInterface
+	config := &DecoderConfig{
+		DefaultInterfaceTypes: map[reflect.Type]reflect.Type{
+			reflect.TypeOf((*io.Writer)(nil)).Elem(): reflect.TypeOf(&prefixWriter{}),
+		},
+		Result: &result,
 	}
 
-	derr, ok := err.(*Error)
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	w, ok := result.W.(*prefixWriter)
 	if !ok {
-		t.Fatalf("error should be kind of Error, instead: %#v", err)
+		t.Fatalf("bad: %#v", result.W)
+	}
+	if w.Prefix != "> " {
+		t.Fatalf("bad prefix: %q", w.Prefix)
 	}
 
-	if derr.Errors[0] !=
-		"'Vstring' expected type 'string', got unconvertible type 'int', value: '42'" {
-		t.Errorf("got unexpected error: %s", err)
+	// An interface that already holds a value is decoded into instead.
+	existing := &prefixWriter{Prefix: "old"}
+	result = NilInterface{W: existing}
+	if err := decoder.Decode(map[string]interface{}{"w": map[string]interface{}{}}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.W != existing || existing.Prefix != "old" {
+		t.Fatalf("bad: %#v", result.W)
 	}
+}
 
-	inputNegIntUint := map[string]interface{}{
-		"vuint": -42,
+func TestDecoder_MaxDepth(t *testing.T) {
+	t.Parallel()
+
+	type Node struct {
+		Name string
+		Next *Node
 	}
 
-	err = Decode(inputNegIntUint, &result)
+	nested := func(n int) map[string]interface{} {
+		root := map[string]interface{}{"name": "0"}
+		cur := root
+		for i := 1; i < n; i++ {
+			next := map[string]interface{}{"name": strconv.Itoa(i)}
+			cur["next"] = next
+			cur = next
+		}
+		return root
+	}
+
+	var result Node
+	decoder, err := NewDecoder(&DecoderConfig{MaxDepth: 5, Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(nested(5)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Next.Next.Next.Next.Name != "4" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	err = decoder.Decode(nested(10))
 	if err == nil {
-		t.Fatal("error should exist")
+		t.Fatal("expected error")
+	}
+	expected := "Next.Next.Next.Next.Next.Next: maximum decode depth 5 exceeded"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q, got: %s", expected, err)
 	}
 
-	derr, ok = err.(*Error)
-	if !ok {
-		t.Fatalf("error should be kind of Error, instead: %#v", err)
+	// A cyclic input must fail rather than recurse forever.
+	cyclic := map[string]interface{}{"name": "loop"}
+	cyclic["next"] = cyclic
+	if err := decoder.Decode(cyclic); err == nil {
+		t.Fatal("expected error")
 	}
+}
 
-	if derr.Errors[0] != "cannot parse 'Vuint', -42 overflows uint" {
-		t.Errorf("got unexpected error: %s", err)
+func TestDecoder_Validate(t *testing.T) {
+	t.Parallel()
+
+	type Window struct {
+		Start int
+		End   int
 	}
 
-	inputNegFloatUint := map[string]interface{}{
-		"vuint": -42.0,
+	errInvalid := errors.New("start must be before end")
+	calls := 0
+
+	var result Window
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Validate: func(result interface{}) error {
+			calls++
+			w := result.(*Window)
+			if w.Start >= w.End {
+				return errInvalid
+			}
+			return nil
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	err = Decode(inputNegFloatUint, &result)
-	if err == nil {
-		t.Fatal("error should exist")
+	if err := decoder.Decode(map[string]interface{}{"start": 1, "end": 2}); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	derr, ok = err.(*Error)
-	if !ok {
-		t.Fatalf("error should be kind of Error, instead: %#v", err)
+	err = decoder.Decode(map[string]interface{}{"start": 5, "end": 3})
+	if err != errInvalid {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+	if result != (Window{Start: 5, End: 3}) {
+		t.Fatalf("result should still be written: %#v", result)
 	}
 
-	if derr.Errors[0] != "cannot parse 'Vuint', -42.000000 overflows uint" {
-		t.Errorf("got unexpected error: %s", err)
+	// Validation doesn't run when decoding itself fails.
+	if err := decoder.Decode(map[string]interface{}{"start": 1, "extra": true}); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
 	}
 }
 
-func TestDecodeMetadata(t *testing.T) {
+func TestDecoder_PreprocessInput(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": map[string]interface{}{
-			"vstring": "foo",
-			"Vuint":   42,
-			"vsilent": "false",
-			"foo":     "bar",
-		},
-		"bar": "nil",
+	type Headers struct {
+		Foo string
+		Bar int
 	}
 
-	var md Metadata
-	var result Nested
+	preprocess := func(input interface{}) (interface{}, error) {
+		m, ok := input.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expected a map")
+		}
 
-	err := DecodeMetadata(input, &result, &md)
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[strings.ToLower(strings.TrimPrefix(k, "X-"))] = v
+		}
+		return result, nil
+	}
+
+	var result Headers
+	decoder, err := NewDecoder(&DecoderConfig{
+		PreprocessInput: preprocess,
+		ErrorUnused:     true,
+		Result:          &result,
+	})
 	if err != nil {
-		t.Fatalf("err: %s", err.Error())
+		t.Fatalf("err: %s", err)
 	}
 
-	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
-	sort.Strings(md.Keys)
-	if !reflect.DeepEqual(md.Keys, expectedKeys) {
-		t.Fatalf("bad keys: %#v", md.Keys)
+	input := map[string]interface{}{
+		"X-Foo": "foo",
+		"X-Bar": 42,
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Foo != "foo" || result.Bar != 42 {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	expectedUnused := []string{"Vbar.foo", "Vbar.vsilent", "bar"}
-	sort.Strings(md.Unused)
-	if !reflect.DeepEqual(md.Unused, expectedUnused) {
-		t.Fatalf("bad unused: %#v", md.Unused)
+	result = Headers{}
+	err = decoder.Decode([]string{"X-Foo"})
+	if err == nil || err.Error() != "expected a map" {
+		t.Fatalf("bad error: %v", err)
+	}
+	if result != (Headers{}) {
+		t.Fatalf("nothing should be decoded: %#v", result)
 	}
 }
 
-func TestMetadata(t *testing.T) {
+func TestDecoder_RootKey(t *testing.T) {
 	t.Parallel()
 
-	type testResult struct {
-		Vfoo string
-		Vbar BasicPointer
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		RootKey: "data",
+		Result:  &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
 	input := map[string]interface{}{
-		"vfoo": "foo",
-		"vbar": map[string]interface{}{
-			"vstring": "foo",
-			"Vuint":   42,
-			"vsilent": "false",
-			"foo":     "bar",
+		"data": map[string]interface{}{
+			"vstring": "x",
+		},
+		"meta": map[string]interface{}{
+			"vstring": "y",
 		},
-		"bar": "nil",
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vstring != "x" {
+		t.Fatalf("bad: %#v", result.Vstring)
 	}
 
-	var md Metadata
-	var result testResult
+	err = decoder.Decode(map[string]interface{}{"vstring": "x"})
+	if err == nil || err.Error() != "root key 'data' not found in input" {
+		t.Fatalf("bad err: %v", err)
+	}
+
+	err = decoder.Decode("x")
+	if err == nil || !strings.Contains(err.Error(), "expected a map") {
+		t.Fatalf("bad err: %v", err)
+	}
+}
+
+func TestDecoder_IgnoreUntaggedFields(t *testing.T) {
+	type Input struct {
+		UntaggedNumber int
+		TaggedNumber   int `mapstructure:"tagged_number"`
+		UntaggedString string
+		TaggedString   string `mapstructure:"tagged_string"`
+	}
+	input := &Input{
+		UntaggedNumber: 31,
+		TaggedNumber:   42,
+		UntaggedString: "hidden",
+		TaggedString:   "visible",
+	}
+
+	actual := make(map[string]interface{})
 	config := &DecoderConfig{
-		Metadata: &md,
-		Result:   &result,
+		Result:               &actual,
+		IgnoreUntaggedFields: true,
 	}
 
 	decoder, err := NewDecoder(config)
@@ -2388,347 +6280,353 @@ func TestMetadata(t *testing.T) {
 
 	err = decoder.Decode(input)
 	if err != nil {
-		t.Fatalf("err: %s", err.Error())
-	}
-
-	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
-	sort.Strings(md.Keys)
-	if !reflect.DeepEqual(md.Keys, expectedKeys) {
-		t.Fatalf("bad keys: %#v", md.Keys)
+		t.Fatalf("err: %s", err)
 	}
 
-	expectedUnused := []string{"Vbar.foo", "Vbar.vsilent", "bar"}
-	sort.Strings(md.Unused)
-	if !reflect.DeepEqual(md.Unused, expectedUnused) {
-		t.Fatalf("bad unused: %#v", md.Unused)
+	expected := map[string]interface{}{
+		"tagged_number": 42,
+		"tagged_string": "visible",
 	}
 
-	expectedUnset := []string{
-		"Vbar.Vbool", "Vbar.Vdata", "Vbar.Vextra", "Vbar.Vfloat", "Vbar.Vint",
-		"Vbar.VjsonFloat", "Vbar.VjsonInt", "Vbar.VjsonNumber"}
-	sort.Strings(md.Unset)
-	if !reflect.DeepEqual(md.Unset, expectedUnset) {
-		t.Fatalf("bad unset: %#v", md.Unset)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Decode() expected: %#v\ngot: %#v", expected, actual)
 	}
 }
 
-func TestMetadata_Embedded(t *testing.T) {
+func TestDecoder_TagNameFallbacks(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"vstring": "foo",
-		"vunique": "bar",
-	}
-
-	var md Metadata
-	var result EmbeddedSquash
-	config := &DecoderConfig{
-		Metadata: &md,
-		Result:   &result,
+	type Input struct {
+		MyKey    string `json:"my_key"`
+		Both     string `mapstructure:"ms_both" json:"json_both"`
+		Skipped  string `json:"-"`
+		Untagged string
 	}
 
-	decoder, err := NewDecoder(config)
+	input := map[string]interface{}{
+		"my_key":    "foo",
+		"ms_both":   "bar",
+		"json_both": "wrong",
+		"skipped":   "nope",
+		"untagged":  "baz",
+	}
+
+	var result Input
+	decoder, err := NewDecoder(&DecoderConfig{
+		TagNameFallbacks: []string{"json"},
+		Result:           &result,
+	})
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
-		t.Fatalf("err: %s", err.Error())
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	expectedKeys := []string{"Vstring", "Vunique"}
+	expected := Input{MyKey: "foo", Both: "bar", Untagged: "baz"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
 
-	sort.Strings(md.Keys)
-	if !reflect.DeepEqual(md.Keys, expectedKeys) {
-		t.Fatalf("bad keys: %#v", md.Keys)
+	var out map[string]interface{}
+	decoder, err = NewDecoder(&DecoderConfig{
+		TagNameFallbacks: []string{"json"},
+		Result:           &out,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(expected); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	expectedUnused := []string{}
-	if !reflect.DeepEqual(md.Unused, expectedUnused) {
-		t.Fatalf("bad unused: %#v", md.Unused)
+	expectedMap := map[string]interface{}{
+		"my_key":   "foo",
+		"ms_both":  "bar",
+		"Untagged": "baz",
+	}
+	if !reflect.DeepEqual(out, expectedMap) {
+		t.Fatalf("bad: %#v", out)
 	}
 }
 
-func TestNonPtrValue(t *testing.T) {
+func TestDecoder_TagHooks(t *testing.T) {
 	t.Parallel()
 
-	err := Decode(map[string]interface{}{}, Basic{})
-	if err == nil {
-		t.Fatal("error should exist")
+	type Input struct {
+		Name     string `mapstructure:"name,upper"`
+		Code     string `mapstructure:",upper,trim"`
+		Plain    string
+		Untagged []string `mapstructure:",trim"`
 	}
 
-	if err.Error() != "result must be a pointer" {
-		t.Errorf("got unexpected error: %s", err)
+	upper := func(f reflect.Kind, t reflect.Kind, data interface{}) (interface{}, error) {
+		if f != reflect.String {
+			return data, nil
+		}
+		return strings.ToUpper(data.(string)), nil
+	}
+	trim := func(f reflect.Kind, t reflect.Kind, data interface{}) (interface{}, error) {
+		if f != reflect.String {
+			return data, nil
+		}
+		return strings.TrimSpace(data.(string)), nil
 	}
-}
-
-func TestTagged(t *testing.T) {
-	t.Parallel()
 
 	input := map[string]interface{}{
-		"foo": "bar",
-		"bar": "value",
+		"name":     "foo",
+		"code":     " abc ",
+		"plain":    "bar",
+		"untagged": []string{" x "},
 	}
 
-	var result Tagged
-	err := Decode(input, &result)
+	var result Input
+	decoder, err := NewDecoder(&DecoderConfig{
+		TagHooks: map[string]DecodeHookFunc{
+			"upper": upper,
+			"trim":  trim,
+		},
+		Result: &result,
+	})
 	if err != nil {
-		t.Fatalf("unexpected error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Value != "bar" {
-		t.Errorf("value should be 'bar', got: %#v", result.Value)
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	if result.Extra != "value" {
-		t.Errorf("extra should be 'value', got: %#v", result.Extra)
+	expected := Input{Name: "FOO", Code: "ABC", Plain: "bar", Untagged: []string{" x "}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
 	}
 }
 
-func TestWeakDecode(t *testing.T) {
+func TestDecoder_TagHooksError(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"foo": "4",
-		"bar": "value",
-	}
-
-	var result struct {
-		Foo int
-		Bar string
+	type Input struct {
+		Secret string `mapstructure:"secret,encrypted"`
 	}
 
-	if err := WeakDecode(input, &result); err != nil {
+	var result Input
+	decoder, err := NewDecoder(&DecoderConfig{
+		TagHooks: map[string]DecodeHookFunc{
+			"encrypted": func(reflect.Type, reflect.Type, interface{}) (interface{}, error) {
+				return nil, errors.New("bad ciphertext")
+			},
+		},
+		Result: &result,
+	})
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	if result.Foo != 4 {
-		t.Fatalf("bad: %#v", result)
-	}
-	if result.Bar != "value" {
-		t.Fatalf("bad: %#v", result)
+
+	err = decoder.Decode(map[string]interface{}{"secret": "xyz"})
+	if err == nil || !strings.Contains(err.Error(), "secret: bad ciphertext") {
+		t.Fatalf("bad error: %v", err)
 	}
 }
 
-func TestWeakDecodeMetadata(t *testing.T) {
+func TestDecoder_EncodeHook(t *testing.T) {
 	t.Parallel()
 
-	input := map[string]interface{}{
-		"foo":        "4",
-		"bar":        "value",
-		"unused":     "value",
-		"unexported": "value",
+	type Event struct {
+		Name string
+		At   time.Time
+		Any  interface{}
 	}
 
-	var md Metadata
-	var result struct {
-		Foo        int
-		Bar        string
-		unexported string
+	at := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+	config := func(result interface{}) *DecoderConfig {
+		return &DecoderConfig{
+			DecodeHook: TextUnmarshallerHookFunc(),
+			EncodeHook: TextMarshallerHookFunc(),
+			Result:     result,
+		}
 	}
 
-	if err := WeakDecodeMetadata(input, &result, &md); err != nil {
+	// Encoding a struct into a map runs the EncodeHook on each field.
+	var m map[string]interface{}
+	decoder, err := NewDecoder(config(&m))
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	if result.Foo != 4 {
-		t.Fatalf("bad: %#v", result)
+	if err := decoder.Decode(Event{Name: "launch", At: at}); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	if result.Bar != "value" {
-		t.Fatalf("bad: %#v", result)
+	expected := map[string]interface{}{
+		"Name": "launch",
+		"At":   "2021-03-14T15:09:26Z",
+		"Any":  nil,
 	}
-
-	expectedKeys := []string{"Bar", "Foo"}
-	sort.Strings(md.Keys)
-	if !reflect.DeepEqual(md.Keys, expectedKeys) {
-		t.Fatalf("bad keys: %#v", md.Keys)
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("bad: %#v", m)
 	}
 
-	expectedUnused := []string{"unexported", "unused"}
-	sort.Strings(md.Unused)
-	if !reflect.DeepEqual(md.Unused, expectedUnused) {
-		t.Fatalf("bad unused: %#v", md.Unused)
+	// Decoding a map into a struct only runs the DecodeHook, so the
+	// time.Time in Any isn't turned into a string.
+	var event Event
+	decoder, err = NewDecoder(config(&event))
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-}
-
-func TestDecode_StructTaggedWithOmitempty_OmitEmptyValues(t *testing.T) {
-	t.Parallel()
-
-	input := &StructWithOmitEmpty{}
-
-	var emptySlice []interface{}
-	var emptyMap map[string]interface{}
-	var emptyNested *Nested
-	expected := &map[string]interface{}{
-		"visible-string": "",
-		"visible-int":    0,
-		"visible-float":  0.0,
-		"visible-slice":  emptySlice,
-		"visible-map":    emptyMap,
-		"visible-nested": emptyNested,
+	input := map[string]interface{}{
+		"name": "launch",
+		"at":   "2021-03-14T15:09:26Z",
+		"any":  at,
 	}
-
-	actual := &map[string]interface{}{}
-	Decode(input, actual)
-
-	if !reflect.DeepEqual(actual, expected) {
-		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !event.At.Equal(at) || event.Any != at {
+		t.Fatalf("bad: %#v", event)
 	}
 }
 
-func TestDecode_StructTaggedWithOmitempty_KeepNonEmptyValues(t *testing.T) {
+func TestDecoder_EncodeHookStruct(t *testing.T) {
 	t.Parallel()
 
-	input := &StructWithOmitEmpty{
-		VisibleStringField: "",
-		OmitStringField:    "string",
-		VisibleIntField:    0,
-		OmitIntField:       1,
-		VisibleFloatField:  0.0,
-		OmitFloatField:     1.0,
-		VisibleSliceField:  nil,
-		OmitSliceField:     []interface{}{1},
-		VisibleMapField:    nil,
-		OmitMapField:       map[string]interface{}{"k": "v"},
-		NestedField:        nil,
-		OmitNestedField:    &Nested{},
-	}
-
-	var emptySlice []interface{}
-	var emptyMap map[string]interface{}
-	var emptyNested *Nested
-	expected := &map[string]interface{}{
-		"visible-string":   "",
-		"omittable-string": "string",
-		"visible-int":      0,
-		"omittable-int":    1,
-		"visible-float":    0.0,
-		"omittable-float":  1.0,
-		"visible-slice":    emptySlice,
-		"omittable-slice":  []interface{}{1},
-		"visible-map":      emptyMap,
-		"omittable-map":    map[string]interface{}{"k": "v"},
-		"visible-nested":   emptyNested,
-		"omittable-nested": &Nested{},
+	var calls []string
+	hook := func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		calls = append(calls, f.String()+" -> "+t.String())
+		return data, nil
 	}
 
-	actual := &map[string]interface{}{}
-	Decode(input, actual)
-
-	if !reflect.DeepEqual(actual, expected) {
-		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	var m map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: hook,
+		Result:     &m,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
-}
-
-func TestDecode_mapToStruct(t *testing.T) {
-	type Target struct {
-		String    string
-		StringPtr *string
+	if err := decoder.Decode(Basic{Vstring: "foo"}); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-
-	expected := Target{
-		String: "hello",
+	if len(calls) == 0 || calls[0] != "mapstructure.Basic -> map[string]interface {}" {
+		t.Fatalf("bad calls: %#v", calls)
 	}
 
-	var target Target
-	err := Decode(map[string]interface{}{
-		"string":    "hello",
-		"StringPtr": "goodbye",
-	}, &target)
+	calls = nil
+	var b Basic
+	decoder, err = NewDecoder(&DecoderConfig{
+		EncodeHook: hook,
+		Result:     &b,
+	})
 	if err != nil {
-		t.Fatalf("got error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
-
-	// Pointers fail reflect test so do those manually
-	if target.StringPtr == nil || *target.StringPtr != "goodbye" {
-		t.Fatalf("bad: %#v", target)
+	if err := decoder.Decode(map[string]interface{}{"vstring": "foo"}); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	target.StringPtr = nil
-
-	if !reflect.DeepEqual(target, expected) {
-		t.Fatalf("bad: %#v", target)
+	if len(calls) != 0 {
+		t.Fatalf("EncodeHook should not run: %#v", calls)
 	}
 }
 
-func TestDecoder_MatchName(t *testing.T) {
+func TestDecoder_EncodeHookField(t *testing.T) {
 	t.Parallel()
 
-	type Target struct {
-		FirstMatch  string `mapstructure:"first_match"`
-		SecondMatch string
-		NoMatch     string `mapstructure:"no_match"`
+	type Inner struct {
+		Name string
 	}
-
-	input := map[string]interface{}{
-		"first_match": "foo",
-		"SecondMatch": "bar",
-		"NO_MATCH":    "baz",
+	type Outer struct {
+		Name  string
+		Inner Inner
 	}
 
-	expected := Target{
-		FirstMatch:  "foo",
-		SecondMatch: "bar",
+	var calls []string
+	hook := func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		calls = append(calls, f.String()+" -> "+t.String())
+		if s, ok := data.(string); ok {
+			return strings.ToUpper(s), nil
+		}
+		return data, nil
 	}
 
-	var actual Target
-	config := &DecoderConfig{
-		Result: &actual,
-		MatchName: func(mapKey, fieldName string) bool {
-			return mapKey == fieldName
+	var m map[string]interface{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		EncodeHook: hook,
+		DecodeHook: func(f reflect.Type, _ reflect.Type, data interface{}) (interface{}, error) {
+			calls = append(calls, "DecodeHook "+f.String())
+			return data, nil
 		},
-	}
-
-	decoder, err := NewDecoder(config)
+		Result: &m,
+	})
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
-	err = decoder.Decode(input)
-	if err != nil {
+	if err := decoder.Decode(Outer{Name: "foo", Inner: Inner{Name: "bar"}}); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !reflect.DeepEqual(expected, actual) {
-		t.Fatalf("Decode() expected: %#v, got: %#v", expected, actual)
+	// A hook result of the same type as the field replaces the field.
+	expected := map[string]interface{}{
+		"Name":  "FOO",
+		"Inner": map[string]interface{}{"Name": "BAR"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("bad: %#v", m)
 	}
-}
 
-func TestDecoder_IgnoreUntaggedFields(t *testing.T) {
-	type Input struct {
-		UntaggedNumber int
-		TaggedNumber   int `mapstructure:"tagged_number"`
-		UntaggedString string
-		TaggedString   string `mapstructure:"tagged_string"`
+	// The hook runs once for each value, including the nested struct.
+	expectedCalls := []string{
+		"mapstructure.Outer -> map[string]interface {}",
+		"string -> interface {}",
+		"mapstructure.Inner -> interface {}",
+		"string -> interface {}",
 	}
-	input := &Input{
-		UntaggedNumber: 31,
-		TaggedNumber:   42,
-		UntaggedString: "hidden",
-		TaggedString:   "visible",
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("bad calls: %#v", calls)
 	}
+}
 
-	actual := make(map[string]interface{})
-	config := &DecoderConfig{
-		Result:               &actual,
-		IgnoreUntaggedFields: true,
+func TestDecoder_TypeHooks(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Start   time.Time
+		Timeout time.Duration
+		Name    string
 	}
 
-	decoder, err := NewDecoder(config)
+	var decodeHookTypes []string
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+			decodeHookTypes = append(decodeHookTypes, t.String())
+			return data, nil
+		},
+		TypeHooks: map[reflect.Type]DecodeHookFunc{
+			reflect.TypeOf(time.Time{}):      StringToTimeHookFunc(time.RFC3339),
+			reflect.TypeOf(time.Duration(0)): StringToTimeDurationHookFunc(),
+		},
+		Result: &result,
+	})
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	err = decoder.Decode(input)
-	if err != nil {
+	input := map[string]interface{}{
+		"start":   "2021-03-14T15:09:26Z",
+		"timeout": "5s",
+		"name":    "foo",
+	}
+	if err := decoder.Decode(input); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	expected := map[string]interface{}{
-		"tagged_number": 42,
-		"tagged_string": "visible",
+	if !result.Start.Equal(time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)) ||
+		result.Timeout != 5*time.Second || result.Name != "foo" {
+		t.Fatalf("bad: %#v", result)
 	}
 
-	if !reflect.DeepEqual(expected, actual) {
-		t.Fatalf("Decode() expected: %#v\ngot: %#v", expected, actual)
+	sort.Strings(decodeHookTypes)
+	expected := []string{"mapstructure.Config", "string"}
+	if !reflect.DeepEqual(decodeHookTypes, expected) {
+		t.Fatalf("DecodeHook should only run for other types: %#v", decodeHookTypes)
 	}
 }
 